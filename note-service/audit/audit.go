@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"myproject/internal/logger"
+	"myproject/models"
+	"myproject/repository"
+)
+
+// Действия с заметками и вложениями, которые попадают в журнал
+const (
+	ActionNoteCreate = "note.create"
+	ActionNoteUpdate = "note.update"
+	ActionNoteDelete = "note.delete"
+	ActionNoteImport = "note.import"
+
+	ActionAttachmentCreate = "attachment.create"
+	ActionAttachmentDelete = "attachment.delete"
+)
+
+type metaKey struct{}
+
+// Meta — сведения о запросе, которые кладёт в контекст middleware
+type Meta struct {
+	RequestID string
+	IP        string
+	UserAgent string
+}
+
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, m)
+}
+
+func MetaFrom(ctx context.Context) Meta {
+	m, _ := ctx.Value(metaKey{}).(Meta)
+	return m
+}
+
+// Event — одно действие. Before/After сериализуются и хэшируются, сами данные
+// в журнал не попадают. Нулевые ActorID/UserID означают «неизвестен».
+type Event struct {
+	Action     string
+	ActorID    int
+	UserID     int
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+}
+
+// Hash — sha256 от JSON-представления; для nil пустая строка
+func Hash(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func optionalID(id int) *int {
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
+
+type Recorder struct {
+	repo *repository.AuditRepository
+}
+
+func NewRecorder(repo *repository.AuditRepository) *Recorder {
+	return &Recorder{repo: repo}
+}
+
+// Record пишет событие в журнал. Ошибка записи не ломает основной запрос,
+// но обязательно логируется.
+func (r *Recorder) Record(ctx context.Context, ev Event) {
+	if r == nil || r.repo == nil {
+		return
+	}
+
+	meta := MetaFrom(ctx)
+	entry := models.AuditEntry{
+		ActorID:    optionalID(ev.ActorID),
+		UserID:     optionalID(ev.UserID),
+		Action:     ev.Action,
+		TargetType: ev.TargetType,
+		TargetID:   ev.TargetID,
+		RequestID:  meta.RequestID,
+		IP:         meta.IP,
+		UserAgent:  meta.UserAgent,
+		BeforeHash: Hash(ev.Before),
+		AfterHash:  Hash(ev.After),
+	}
+
+	// запись не должна пропасть, если клиент уже отключился
+	if err := r.repo.Insert(context.WithoutCancel(ctx), entry); err != nil {
+		logger.Errorf("request_id=%s audit: %v", meta.RequestID, err)
+	}
+}
+
+func (r *Recorder) List(ctx context.Context, f repository.AuditFilter) ([]models.AuditEntry, error) {
+	return r.repo.List(ctx, f)
+}
+
+// RunRetention раз в сутки удаляет записи старше retentionDays, пока жив ctx
+func (r *Recorder) RunRetention(ctx context.Context, retentionDays int) {
+	if retentionDays <= 0 {
+		return
+	}
+
+	purge := func() {
+		n, err := r.repo.DeleteOlderThan(ctx, retentionDays)
+		if err != nil {
+			logger.Errorf("audit retention: %v", err)
+			return
+		}
+		if n > 0 {
+			logger.Infof("audit retention: removed %d entries older than %d days", n, retentionDays)
+		}
+	}
+
+	purge()
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
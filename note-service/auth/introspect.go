@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/internal/logger"
+)
+
+// Персональные токены (PAT) выпускает user-service; здесь мы их только проверяем
+const PATPrefix = "pat_"
+
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+)
+
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// JWT выдаётся после интерактивного входа и даёт полный доступ к заметкам
+var AllScopes = []string{ScopeNotesRead, ScopeNotesWrite}
+
+var ErrIntrospection = errors.New("token introspection failed")
+
+// Principal — кто выполняет запрос. У PAT роль пустая: токены для скриптов
+// не дают доступа к административным маршрутам. ExpiresAt — срок токена
+// (exp у JWT, expires_at у PAT); нулевой — бессрочный.
+type Principal struct {
+	UserID    int
+	Role      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func IsPAT(token string) bool {
+	return strings.HasPrefix(token, PATPrefix)
+}
+
+const (
+	introspectCacheTTL         = 30 * time.Second
+	introspectNegativeCacheTTL = 5 * time.Second
+	// сколько после introspectCacheTTL можно опираться на последний
+	// положительный ответ, пока user-service недоступен
+	introspectStaleTTL        = 5 * time.Minute
+	introspectCacheMaxEntries = 10000
+)
+
+// Запись кэша: до expires ответ свежий, до staleUntil — годится, только
+// если user-service не отвечает. У отрицательных ответов staleUntil = expires.
+type introspectCacheEntry struct {
+	principal  Principal
+	active     bool
+	expires    time.Time
+	staleUntil time.Time
+}
+
+var (
+	introspectCacheMu sync.Mutex
+	introspectCache   = map[[32]byte]introspectCacheEntry{}
+
+	introspectClient = &http.Client{Timeout: 3 * time.Second}
+)
+
+func userServiceURL() string {
+	if u := os.Getenv("USER_SERVICE_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://user-service:8082"
+}
+
+func internalKey() string {
+	k := os.Getenv("INTERNAL_API_KEY")
+	if k == "" {
+		// только для локальной разработки
+		k = "dev-internal-key"
+	}
+	return k
+}
+
+// Authenticate проверяет PAT или JWT. JWT проверяется локально (подпись,
+// срок, пользователь), а у user-service спрашиваем только состояние сессии:
+// не сменилась ли версия tv, не заблокирован ли аккаунт, какая сейчас роль.
+// Ответ кэшируется по паре (пользователь, tv), так что все токены одной
+// сессии делят одну запись. PAT целиком проверяет user-service.
+//
+// Отзыв доступа вступает в силу не позже чем через introspectCacheTTL. Если
+// user-service недоступен, ещё introspectStaleTTL действует последний
+// положительный ответ; дальше — ErrIntrospection.
+func Authenticate(ctx context.Context, token string) (Principal, error) {
+	now := time.Now()
+
+	if IsPAT(token) {
+		entry, err := introspectCached(ctx, sha256.Sum256([]byte(token)), token, now)
+		if err != nil {
+			return Principal{}, err
+		}
+		if !entry.active || entry.principal.expired(now) {
+			return Principal{}, ErrInvalidToken
+		}
+		return entry.principal, nil
+	}
+
+	claims, err := ParseClaims(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	if claims.UserID <= 0 {
+		return Principal{}, ErrInvalidToken
+	}
+
+	key := sha256.Sum256([]byte(fmt.Sprintf("jwt:%d:%d", claims.UserID, claims.TokenVersion)))
+	session, err := introspectCached(ctx, key, token, now)
+	if err != nil {
+		return Principal{}, err
+	}
+	if !session.active || session.principal.UserID != claims.UserID {
+		return Principal{}, ErrInvalidToken
+	}
+
+	p := Principal{UserID: claims.UserID, Role: session.principal.Role, Scopes: AllScopes}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return p, nil
+}
+
+// introspectCached отдаёт свежую запись из кэша или спрашивает user-service;
+// при его недоступности возвращает ещё не устаревшую запись
+func introspectCached(ctx context.Context, key [32]byte, token string, now time.Time) (introspectCacheEntry, error) {
+	introspectCacheMu.Lock()
+	entry, ok := introspectCache[key]
+	if ok && now.After(entry.staleUntil) {
+		delete(introspectCache, key)
+		ok = false
+	}
+	introspectCacheMu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry, nil
+	}
+
+	p, active, err := introspect(ctx, token)
+	if err != nil {
+		if ok {
+			logger.Errorf("token introspection failed, using cached result: %v", err)
+			return entry, nil
+		}
+		return introspectCacheEntry{}, err
+	}
+
+	entry = introspectCacheEntry{principal: p, active: active, expires: now.Add(introspectCacheTTL)}
+	entry.staleUntil = entry.expires.Add(introspectStaleTTL)
+	if !active {
+		entry.expires = now.Add(introspectNegativeCacheTTL)
+		entry.staleUntil = entry.expires
+	}
+
+	introspectCacheMu.Lock()
+	if len(introspectCache) >= introspectCacheMaxEntries {
+		// подчищаем протухшие записи, чтобы перебор случайных токенов не раздувал кэш
+		for k, e := range introspectCache {
+			if now.After(e.staleUntil) {
+				delete(introspectCache, k)
+			}
+		}
+	}
+	if len(introspectCache) < introspectCacheMaxEntries {
+		introspectCache[key] = entry
+	}
+	introspectCacheMu.Unlock()
+
+	return entry, nil
+}
+
+// запись кэша живёт introspectCacheTTL и может пережить срок токена
+func (p Principal) expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt)
+}
+
+func introspect(ctx context.Context, token string) (Principal, bool, error) {
+	body, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return Principal{}, false, fmt.Errorf("%w: %v", ErrIntrospection, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		userServiceURL()+"/internal/tokens/introspect", bytes.NewReader(body))
+	if err != nil {
+		return Principal{}, false, fmt.Errorf("%w: %v", ErrIntrospection, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Key", internalKey())
+
+	resp, err := introspectClient.Do(req)
+	if err != nil {
+		return Principal{}, false, fmt.Errorf("%w: %v", ErrIntrospection, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Principal{}, false, fmt.Errorf("%w: status %d", ErrIntrospection, resp.StatusCode)
+	}
+
+	var out struct {
+		Active    bool       `json:"active"`
+		TokenType string     `json:"token_type"`
+		UserID    int        `json:"user_id"`
+		Role      string     `json:"role"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Principal{}, false, fmt.Errorf("%w: decode: %v", ErrIntrospection, err)
+	}
+	if !out.Active || out.UserID <= 0 {
+		return Principal{}, false, nil
+	}
+
+	p := Principal{UserID: out.UserID, Scopes: out.Scopes}
+	if out.ExpiresAt != nil {
+		p.ExpiresAt = *out.ExpiresAt
+	}
+	if out.TokenType == "jwt" {
+		p.Role = out.Role
+	}
+	return p, true, nil
+}
@@ -11,7 +11,9 @@ import (
 var ErrInvalidToken = errors.New("invalid token")
 
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID       int    `json:"user_id"`
+	Role         string `json:"role,omitempty"`
+	TokenVersion int    `json:"tv,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -37,6 +39,14 @@ func GenerateToken(userID int) (string, error) {
 }
 
 func ParseToken(tokenStr string) (int, error) {
+	claims, err := ParseClaims(tokenStr)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+func ParseClaims(tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
@@ -44,13 +54,13 @@ func ParseToken(tokenStr string) (int, error) {
 		return secret(), nil
 	})
 	if err != nil {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
@@ -0,0 +1,52 @@
+// Package blob хранит файлы вложений. Хранилище выбирается через
+// BLOB_BACKEND: local — каталог на диске, s3 — любое S3-совместимое
+// (AWS, MinIO и т.п.). Метаданные файлов живут в БД, здесь — только байты.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore — плоское хранилище объектов по ключу. Ключи формирует сервис:
+// "users/{id}/{uuid}" и т.п.; слэш — разделитель, ".." недопустим.
+type BlobStore interface {
+	// Put записывает объект целиком; size — точная длина r
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект на чтение; нет объекта — ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет объект; удалить отсутствующий — не ошибка
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv собирает хранилище по BLOB_BACKEND (по умолчанию local)
+func FromEnv() (BlobStore, error) {
+	switch backend := getEnv("BLOB_BACKEND", "local"); backend {
+	case "local":
+		return NewLocalStore(getEnv("BLOB_LOCAL_DIR", "./data/blobs"))
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			// MinIO и большинство совместимых хранилищ понимают только path-style
+			PathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("blob: unknown BLOB_BACKEND %q", backend)
+	}
+}
+
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errBreakerOpen = errors.New("redis circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker — автомат «закрыт → открыт → пробный запрос». После maxFailures
+// ошибок подряд Redis обходится стороной cooldown; затем пропускается один
+// пробный запрос, и по его результату автомат закрывается или открывается снова.
+type breaker struct {
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	maxFailures int
+	cooldown    time.Duration
+	openedAt    time.Time
+}
+
+func newBreaker(maxFailures int, cooldown time.Duration) *breaker {
+	maxFailures = max(maxFailures, 1)
+	return &breaker{maxFailures: maxFailures, cooldown: cooldown}
+}
+
+// allow сообщает, можно ли сейчас идти в Redis
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		// пробный запрос: остальные ждут его результата
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *breaker) report(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.maxFailures {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// isOpen — для статистики
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+
+	"myproject/models"
+)
+
+// Формат значения заметки в Redis: первый байт — кодек.
+//
+//	codecBinary  — uvarint(id) uvarint(user_id) uvarint(len) title uvarint(len) content
+//	               [uvarint(len) format [uvarint(due_at) uvarint(remind_at)]]
+//	codecS2      — то же, сжатое s2; используется для значений от compressMinBytes
+//
+// Хвост необязателен: у значений, записанных до появления формата, его нет,
+// и такая заметка считается plain; у записанных до появления сроков нет
+// сроков. Срок — unix-время в микросекундах плюс один, 0 — срока нет.
+//
+// Значения, начинающиеся с '{', — JSON из прежних версий сервиса; их
+// по-прежнему читаем, пока не истечёт TTL.
+const (
+	codecBinary byte = 1
+	codecS2     byte = 2
+)
+
+var errBadEncoding = errors.New("malformed cached note")
+
+func encodeNote(n models.Note, compressMinBytes int) []byte {
+	buf := make([]byte, 0, 1+7*binary.MaxVarintLen64+len(n.Title)+len(n.Content)+len(n.Format))
+	buf = append(buf, codecBinary)
+	buf = binary.AppendUvarint(buf, uint64(n.Id))
+	buf = binary.AppendUvarint(buf, uint64(n.UserID))
+	buf = binary.AppendUvarint(buf, uint64(len(n.Title)))
+	buf = append(buf, n.Title...)
+	buf = binary.AppendUvarint(buf, uint64(len(n.Content)))
+	buf = append(buf, n.Content...)
+	buf = binary.AppendUvarint(buf, uint64(len(n.Format)))
+	buf = append(buf, n.Format...)
+	buf = binary.AppendUvarint(buf, encodeTime(n.DueAt))
+	buf = binary.AppendUvarint(buf, encodeTime(n.RemindAt))
+
+	if compressMinBytes > 0 && len(buf) >= compressMinBytes {
+		compressed := s2.Encode(nil, buf[1:])
+		if len(compressed)+1 < len(buf) {
+			return append([]byte{codecS2}, compressed...)
+		}
+	}
+	return buf
+}
+
+func decodeNote(data []byte) (models.Note, error) {
+	if len(data) == 0 {
+		return models.Note{}, errBadEncoding
+	}
+
+	switch data[0] {
+	case '{':
+		var n models.Note
+		if err := json.Unmarshal(data, &n); err != nil {
+			return models.Note{}, fmt.Errorf("unmarshal cached note: %w", err)
+		}
+		if n.Format == "" {
+			n.Format = models.FormatPlain
+		}
+		return n, nil
+	case codecS2:
+		raw, err := s2.Decode(nil, data[1:])
+		if err != nil {
+			return models.Note{}, fmt.Errorf("decompress cached note: %w", err)
+		}
+		return decodeBinary(raw)
+	case codecBinary:
+		return decodeBinary(data[1:])
+	}
+	return models.Note{}, errBadEncoding
+}
+
+func decodeBinary(b []byte) (models.Note, error) {
+	var n models.Note
+	var ok bool
+
+	readUint := func() uint64 {
+		v, k := binary.Uvarint(b)
+		if k <= 0 {
+			ok = false
+			return 0
+		}
+		b = b[k:]
+		return v
+	}
+	readString := func() string {
+		l := readUint()
+		if !ok || uint64(len(b)) < l {
+			ok = false
+			return ""
+		}
+		s := string(b[:l])
+		b = b[l:]
+		return s
+	}
+
+	ok = true
+	n.Id = int(readUint())
+	n.UserID = int(readUint())
+	n.Title = readString()
+	n.Content = readString()
+	n.Format = models.FormatPlain
+	if len(b) > 0 {
+		n.Format = readString()
+	}
+	if len(b) > 0 {
+		n.DueAt = decodeTime(readUint())
+		n.RemindAt = decodeTime(readUint())
+	}
+	if !ok || len(b) != 0 {
+		return models.Note{}, errBadEncoding
+	}
+	return n, nil
+}
+
+func encodeTime(t *time.Time) uint64 {
+	if t == nil {
+		return 0
+	}
+	return uint64(t.UnixMicro()) + 1
+}
+
+func decodeTime(v uint64) *time.Time {
+	if v == 0 {
+		return nil
+	}
+	t := time.UnixMicro(int64(v - 1)).UTC()
+	return &t
+}
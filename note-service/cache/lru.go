@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lru — локальный кэш процесса, ограниченный суммарным размером значений.
+// Размер считает вызывающий: хранить можно что угодно, но значения
+// разделяются между горутинами, поэтому менять их после Set нельзя.
+type lru struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List // спереди самые свежие
+
+	// растёт при каждой инвалидации; см. epoch/SetIfEpoch
+	generation uint64
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	size    int64
+	expires time.Time
+}
+
+func newLRU(maxBytes int64, ttl time.Duration) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (l *lru) Get(key string) (any, bool) {
+	if l == nil {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		l.removeElement(el)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return e.value, true
+}
+
+// epoch запоминается перед чтением из Redis: если за время чтения пришла
+// инвалидация, прочитанное значение уже может быть устаревшим
+func (l *lru) epoch() uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.generation
+}
+
+// SetIfEpoch кладёт значение, только если с момента epoch не было инвалидаций
+func (l *lru) SetIfEpoch(key string, value any, size int64, epoch uint64) {
+	if l == nil || size > l.maxBytes {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.generation != epoch {
+		return
+	}
+	if el, ok := l.items[key]; ok {
+		l.removeElement(el)
+	}
+
+	el := l.order.PushFront(&lruEntry{key: key, value: value, size: size, expires: time.Now().Add(l.ttl)})
+	l.items[key] = el
+	l.bytes += size
+
+	for l.bytes > l.maxBytes {
+		l.removeElement(l.order.Back())
+	}
+}
+
+func (l *lru) Remove(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.generation++
+	for _, k := range keys {
+		if el, ok := l.items[k]; ok {
+			l.removeElement(el)
+		}
+	}
+}
+
+// Len и Bytes — для статистики
+func (l *lru) Len() (int, int64) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.items), l.bytes
+}
+
+func (l *lru) removeElement(el *list.Element) {
+	e := el.Value.(*lruEntry)
+	l.order.Remove(el)
+	delete(l.items, e.key)
+	l.bytes -= e.size
+}
+
+// RemovePrefix удаляет все ключи с префиксом — O(n) по размеру кэша,
+// но вызывается только при сбросе всего списка пользователя
+func (l *lru) RemovePrefix(prefix string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.generation++
+	for k, el := range l.items {
+		if strings.HasPrefix(k, prefix) {
+			l.removeElement(el)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	mrand "math/rand/v2"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,29 +18,139 @@ import (
 	"myproject/models"
 )
 
+// Кэш двухуровневый: перед Redis стоит локальный LRU процесса (см. lru.go,
+// tiers.go). Локальные копии сбрасываются через Redis pub/sub.
+//
+// Раскладка ключей в Redis (фигурные скобки — hash tag: в Redis Cluster все
+// ключи пользователя попадают в один слот, поэтому MGET и MULTI работают):
+//
+//	note:{userID}:{id}    — заметка (см. codec.go) или notFoundMarker
+//	notes:{userID}:ids    — ZSET id заметок пользователя (score = id)
+//	notes:{userID}:fresh  — пока ключ жив, список считается свежим
+//	notes:{userID}:ver    — версия БД, по которой собран индекс
+//	notes:{userID}:gen    — последняя известная версия БД (см. versions.go)
+//	lock:notes:{userID}   — кто из реплик сейчас перечитывает список из БД
+//	html:{userID}:{key}   — отрендеренный HTML заметки (см. render_cache.go)
+//
+// Индекс либо полный, либо отсутствует: его целиком заполняет SetNotes
+// после чтения из БД. Индекс действителен, только пока ver == gen. Служебный элемент indexSentinel позволяет отличить
+// «заметок нет» от «индекса нет». Индекс живёт на staleTTL дольше, чем
+// fresh-ключ: в этом окне список отдаётся устаревшим, пока его обновляют.
+//
+// Каждая операция с Redis ограничена opTimeout и идёт через circuit breaker.
+// Пока Redis недоступен, чтения считаются промахами, а записи пропускаются;
+// затронутые ключи запоминаются и сбрасываются, когда Redis вернётся.
+const (
+	notFoundMarker = "-"
+	indexSentinel  = "0"
+	lockTTL        = 5 * time.Second
+
+	// больше не запоминаем: оставшееся устареет само по TTL
+	maxPendingInvalidations = 10000
+)
+
+// Снять блокировку, только если она всё ещё наша
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
 type NotesCache struct {
-	client *redis.Client
-	ttl    time.Duration
+	client      redis.UniversalClient
+	noteTTL     time.Duration
+	listTTL     time.Duration
+	negativeTTL time.Duration
+	staleTTL    time.Duration
+	renderTTL   time.Duration
+	jitter      float64
+
+	opTimeout        time.Duration
+	breaker          *breaker
+	compressMinBytes int
+
+	// что не удалось записать в Redis, пока он был недоступен
+	pendingMu    sync.Mutex
+	pendingUsers map[int]struct{}
+	pendingNotes map[[2]int]struct{}
+	hasPending   atomic.Bool
+
+	// локальный уровень; nil, если CACHE_LOCAL_MAX_BYTES=0
+	local         *lru
+	localMaxBytes int64
+	localStats    tierCounters
+	redisStats    tierCounters
 }
 
 func NewNotesCache() *NotesCache {
-	addr := getEnv("REDIS_ADDR", "redis:6379")
-	dbStr := getEnv("REDIS_DB", "0")
+	opTimeout := getDuration("CACHE_OP_TIMEOUT", 100*time.Millisecond)
+
+	c := &NotesCache{
+		client:      newRedisClient(opTimeout),
+		noteTTL:     getDuration("CACHE_NOTE_TTL", 90*time.Second),
+		listTTL:     getDuration("CACHE_LIST_TTL", 90*time.Second),
+		negativeTTL: getDuration("CACHE_NEGATIVE_TTL", 30*time.Second),
+		staleTTL:    getDuration("CACHE_STALE_TTL", 30*time.Second),
+		renderTTL:   getDuration("CACHE_RENDER_TTL", time.Hour),
+		jitter:      getFraction("CACHE_TTL_JITTER", 0.1),
+
+		opTimeout: opTimeout,
+		breaker: newBreaker(
+			getInt("CACHE_BREAKER_FAILURES", 5),
+			getDuration("CACHE_BREAKER_COOLDOWN", 10*time.Second),
+		),
+		compressMinBytes: getInt("CACHE_COMPRESS_MIN_BYTES", 1024),
+
+		pendingUsers: make(map[int]struct{}),
+		pendingNotes: make(map[[2]int]struct{}),
+	}
+
+	maxBytes, err := strconv.ParseInt(getEnv("CACHE_LOCAL_MAX_BYTES", "33554432"), 10, 64)
+	if err != nil || maxBytes < 0 {
+		maxBytes = 32 << 20
+	}
+	if maxBytes > 0 {
+		c.localMaxBytes = maxBytes
+		c.local = newLRU(maxBytes, getDuration("CACHE_LOCAL_TTL", 5*time.Second))
+	}
+	return c
+}
+
+// newRedisClient выбирает режим по окружению:
+//
+//	REDIS_MASTER_NAME задан        — Sentinel, REDIS_ADDR — адреса sentinel'ов
+//	REDIS_CLUSTER=true или >1 адреса — Redis Cluster (REDIS_DB игнорируется)
+//	иначе                          — одиночный Redis
+func newRedisClient(opTimeout time.Duration) redis.UniversalClient {
+	addrs := strings.Split(getEnv("REDIS_ADDR", "redis:6379"), ",")
+	for i := range addrs {
+		addrs[i] = strings.TrimSpace(addrs[i])
+	}
 
-	dbNum, err := strconv.Atoi(dbStr)
+	dbNum, err := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	if err != nil {
 		dbNum = 0
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr: addr,
-		DB:   dbNum,
+	return redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               dbNum,
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		IsClusterMode:    os.Getenv("REDIS_CLUSTER") == "true",
+
+		// таймауты операций задаёт контекст (см. run), здесь — только на соединение
+		ContextTimeoutEnabled: true,
+		DialTimeout:           5 * opTimeout,
 	})
+}
 
-	return &NotesCache{
-		client: client,
-		ttl:    90 * time.Second,
-	}
+// Redis — клиент кэша для других пакетов, которым нужен тот же Redis
+// (уведомления об изменениях): одно подключение и одни настройки
+func (c *NotesCache) Redis() redis.UniversalClient {
+	return c.client
 }
 
 func getEnv(key, def string) string {
@@ -45,54 +160,327 @@ func getEnv(key, def string) string {
 	return def
 }
 
-func (c *NotesCache) key(userID int) string {
-	return fmt.Sprintf("notes:%d", userID)
+// Длительность в формате time.ParseDuration ("90s", "5m")
+func getDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// Доля от 0 до 1, например "0.1"
+func getFraction(key string, def float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || f < 0 || f > 1 {
+		return def
+	}
+	return f
+}
+
+func getInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// ttl со случайным разбросом ±jitter, чтобы ключи, записанные одновременно,
+// не истекали тоже одновременно
+func (c *NotesCache) ttl(d time.Duration) time.Duration {
+	if c.jitter == 0 {
+		return d
+	}
+	delta := (mrand.Float64()*2 - 1) * c.jitter * float64(d)
+	return d + time.Duration(delta)
+}
+
+func (c *NotesCache) noteKey(userID, id int) string {
+	return fmt.Sprintf("note:{%d}:%d", userID, id)
+}
+
+func (c *NotesCache) indexKey(userID int) string {
+	return fmt.Sprintf("notes:{%d}:ids", userID)
+}
+
+func (c *NotesCache) freshKey(userID int) string {
+	return fmt.Sprintf("notes:{%d}:fresh", userID)
+}
+
+func (c *NotesCache) lockKey(userID int) string {
+	return fmt.Sprintf("lock:notes:{%d}", userID)
+}
+
+// run выполняет операцию с Redis с таймаутом и через circuit breaker.
+// Отмена клиентского запроса операцию не прерывает: её и так ограничивает
+// opTimeout, а оборванный пробный запрос оставил бы breaker в неопределённости.
+func (c *NotesCache) run(ctx context.Context, op func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		return errBreakerOpen
+	}
+
+	opCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.opTimeout)
+	defer cancel()
+
+	err := op(opCtx)
+	ok := err == nil || err == redis.Nil
+	c.breaker.report(ok)
+
+	// Redis снова отвечает — пора сбросить то, что не записалось во время сбоя
+	if ok && c.hasPending.CompareAndSwap(true, false) {
+		go c.flushPending()
+	}
+	return err
+}
+
+// markPending запоминает ключи, которые в Redis могли остаться устаревшими.
+// id=0 — только индекс пользователя.
+func (c *NotesCache) markPending(userID, id int) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if len(c.pendingUsers)+len(c.pendingNotes) >= maxPendingInvalidations {
+		return
+	}
+	c.hasPending.Store(true)
+	c.pendingUsers[userID] = struct{}{}
+	if id != 0 {
+		c.pendingNotes[[2]int{userID, id}] = struct{}{}
+	}
+}
+
+// flushPending сбрасывает в Redis всё, что не удалось записать во время сбоя
+func (c *NotesCache) flushPending() {
+	c.pendingMu.Lock()
+	users, notes := c.pendingUsers, c.pendingNotes
+	c.pendingUsers = make(map[int]struct{})
+	c.pendingNotes = make(map[[2]int]struct{})
+	c.pendingMu.Unlock()
+
+	if len(users) == 0 && len(notes) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	for userID := range users {
+		err := c.run(ctx, func(ctx context.Context) error {
+			return c.client.Del(ctx, c.indexKey(userID), c.freshKey(userID), c.versionKey(userID)).Err()
+		})
+		if err != nil {
+			c.markPending(userID, 0)
+		}
+	}
+	for k := range notes {
+		err := c.run(ctx, func(ctx context.Context) error {
+			return c.client.Del(ctx, c.noteKey(k[0], k[1])).Err()
+		})
+		if err != nil {
+			c.markPending(k[0], k[1])
+		}
+	}
+	fmt.Printf("[CACHE RECOVERED] flushed %d users, %d notes\n", len(users), len(notes))
+}
+
+// writeFailed решает, что вернуть из записи, которая не дошла до Redis
+func (c *NotesCache) writeFailed(userID, id int, err error, what string) error {
+	c.markPending(userID, id)
+	if err == errBreakerOpen {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", what, err)
 }
 
-func (c *NotesCache) GetNotes(ctx context.Context, userID int) ([]models.Note, bool, error) {
+// GetNote возвращает заметку из кэша. found=false при попадании означает,
+// что заметки нет и в БД (закэшированный промах).
+func (c *NotesCache) GetNote(ctx context.Context, userID, id int) (note models.Note, found, ok bool, err error) {
 	if c == nil || c.client == nil {
-		return nil, false, nil
+		return models.Note{}, false, false, nil
 	}
 
-	data, err := c.client.Get(ctx, c.key(userID)).Bytes()
+	key := c.noteKey(userID, id)
+	if v, hit := c.local.Get(key); hit {
+		c.localStats.record(true)
+		ln := v.(localNote)
+		return ln.note, ln.found, true, nil
+	}
+	c.localStats.record(false)
+	epoch := c.local.epoch()
+
+	var data []byte
+	err = c.run(ctx, func(ctx context.Context) error {
+		data, err = c.client.Get(ctx, key).Bytes()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
-			return nil, false, nil 
+			c.redisStats.record(false)
+			return models.Note{}, false, false, nil
+		}
+		if err == errBreakerOpen {
+			return models.Note{}, false, false, nil
 		}
-		return nil, false, fmt.Errorf("redis get: %w", err)
+		return models.Note{}, false, false, fmt.Errorf("redis get: %w", err)
 	}
+	c.redisStats.record(true)
 
-	var notes []models.Note
-	if err := json.Unmarshal(data, &notes); err != nil {
-		return nil, false, fmt.Errorf("unmarshal cached notes: %w", err)
+	if string(data) == notFoundMarker {
+		c.local.SetIfEpoch(key, localNote{}, noteSize(models.Note{}), epoch)
+		return models.Note{}, false, true, nil
 	}
-
-	return notes, true, nil
+	note, err = decodeNote(data)
+	if err != nil {
+		return models.Note{}, false, false, err
+	}
+	c.local.SetIfEpoch(key, localNote{note: note, found: true}, noteSize(note), epoch)
+	return note, true, true, nil
 }
 
-func (c *NotesCache) SetNotes(ctx context.Context, userID int, notes []models.Note) error {
+// GetNotes собирает список по индексу. Если индекса нет или какая-то
+// заметка уже вытеснена, это промах: список перечитывается из БД целиком.
+// stale=true — список устарел и его пора обновить, но отдавать его ещё можно.
+func (c *NotesCache) GetNotes(ctx context.Context, userID int) (notes []models.Note, ok, stale bool, err error) {
 	if c == nil || c.client == nil {
-		return nil
+		return nil, false, false, nil
+	}
+
+	// локально лежат только свежие списки
+	localKey := c.listLocalKey(userID)
+	if v, hit := c.local.Get(localKey); hit {
+		c.localStats.record(true)
+		return v.([]models.Note), true, false, nil
 	}
+	c.localStats.record(false)
+	epoch := c.local.epoch()
 
-	data, err := json.Marshal(notes)
+	err = c.run(ctx, func(ctx context.Context) error {
+		notes, ok, stale, err = c.getNotesRedis(ctx, userID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("marshal notes: %w", err)
+		if err == errBreakerOpen {
+			return nil, false, false, nil
+		}
+		return nil, false, false, err
+	}
+	c.redisStats.record(ok)
+	if ok && !stale {
+		c.local.SetIfEpoch(localKey, notes, notesSize(notes), epoch)
+	}
+	return notes, ok, stale, nil
+}
+
+func (c *NotesCache) getNotesRedis(ctx context.Context, userID int) (notes []models.Note, ok, stale bool, err error) {
+	pipe := c.client.Pipeline()
+	idsCmd := pipe.ZRangeByScore(ctx, c.indexKey(userID), &redis.ZRangeBy{Min: "1", Max: "+inf"})
+	indexCmd := pipe.Exists(ctx, c.indexKey(userID))
+	freshCmd := pipe.Exists(ctx, c.freshKey(userID))
+	verCmd := pipe.Get(ctx, c.versionKey(userID))
+	genCmd := pipe.Get(ctx, c.genKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, false, false, fmt.Errorf("redis get index: %w", err)
 	}
 
-	if err := c.client.Set(ctx, c.key(userID), data, c.ttl).Err(); err != nil {
-		return fmt.Errorf("redis set: %w", err)
+	// индекса нет вовсе — в нём всегда лежит хотя бы sentinel
+	if indexCmd.Val() == 0 {
+		return nil, false, false, nil
 	}
+	// индекс собран по версии, которая уже не последняя
+	if verCmd.Err() != nil || genCmd.Err() != nil || verCmd.Val() != genCmd.Val() {
+		return nil, false, false, nil
+	}
+	stale = freshCmd.Val() == 0
 
-	return nil
+	ids := idsCmd.Val()
+	if len(ids) == 0 {
+		return []models.Note{}, true, stale, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, s := range ids {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("redis index: bad id %q", s)
+		}
+		keys[i] = c.noteKey(userID, id)
+	}
+
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("redis mget: %w", err)
+	}
+
+	notes = make([]models.Note, 0, len(values))
+	for _, v := range values {
+		s, isString := v.(string)
+		if !isString || s == notFoundMarker {
+			return nil, false, false, nil
+		}
+		note, err := decodeNote([]byte(s))
+		if err != nil {
+			return nil, false, false, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, true, stale, nil
 }
 
+// Invalidate сбрасывает индекс пользователя; отдельные заметки доживают свой TTL
 func (c *NotesCache) Invalidate(ctx context.Context, userID int) error {
 	if c == nil || c.client == nil {
 		return nil
 	}
-	if err := c.client.Del(ctx, c.key(userID)).Err(); err != nil {
-		return fmt.Errorf("redis del: %w", err)
+
+	defer c.dropLocal(ctx, userID, 0)
+
+	err := c.run(ctx, func(ctx context.Context) error {
+		return c.client.Del(ctx, c.indexKey(userID), c.freshKey(userID), c.versionKey(userID)).Err()
+	})
+	if err != nil {
+		return c.writeFailed(userID, 0, err, "redis del")
 	}
 	return nil
 }
+
+// LockNotes берёт межрепликовую блокировку на перечитывание списка.
+// ok=false — список уже обновляет кто-то другой. release можно вызывать
+// всегда: чужую блокировку (если наша успела истечь) он не снимет.
+func (c *NotesCache) LockNotes(ctx context.Context, userID int) (release func(), ok bool, err error) {
+	noop := func() {}
+	if c == nil || c.client == nil {
+		return noop, true, nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return noop, false, fmt.Errorf("lock token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	key := c.lockKey(userID)
+
+	err = c.run(ctx, func(ctx context.Context) error {
+		ok, err = c.client.SetNX(ctx, key, token, lockTTL).Result()
+		return err
+	})
+	if err != nil {
+		if err == errBreakerOpen {
+			// Redis недоступен — координироваться не с кем
+			return noop, true, nil
+		}
+		return noop, false, fmt.Errorf("redis lock: %w", err)
+	}
+	if !ok {
+		return noop, false, nil
+	}
+
+	release = func() {
+		err := c.run(ctx, func(ctx context.Context) error {
+			return unlockScript.Run(ctx, c.client, []string{key}, token).Err()
+		})
+		if err != nil && err != redis.Nil && err != errBreakerOpen {
+			fmt.Printf("[CACHE UNLOCK ERROR] user=%d: %v\n", userID, err)
+		}
+	}
+	return release, true, nil
+}
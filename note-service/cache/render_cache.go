@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Отрендеренный HTML хранится рядом с заметками пользователя, но по ключу
+// от содержимого (render.Key), а не от id: правка заметки даёт новый ключ,
+// поэтому версии и инвалидация здесь не нужны — старые значения доживают TTL.
+
+func (c *NotesCache) renderKey(userID int, key string) string {
+	return fmt.Sprintf("html:{%d}:%s", userID, key)
+}
+
+// GetRendered — HTML по ключу содержимого; ok=false — промах
+func (c *NotesCache) GetRendered(ctx context.Context, userID int, key string) (html string, ok bool, err error) {
+	if c == nil || c.client == nil {
+		return "", false, nil
+	}
+
+	rkey := c.renderKey(userID, key)
+	if v, hit := c.local.Get(rkey); hit {
+		c.localStats.record(true)
+		return v.(string), true, nil
+	}
+	c.localStats.record(false)
+	epoch := c.local.epoch()
+
+	err = c.run(ctx, func(ctx context.Context) error {
+		html, err = c.client.Get(ctx, rkey).Result()
+		return err
+	})
+	if err != nil {
+		if err == redis.Nil {
+			c.redisStats.record(false)
+			return "", false, nil
+		}
+		if err == errBreakerOpen {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("redis get: %w", err)
+	}
+	c.redisStats.record(true)
+
+	c.local.SetIfEpoch(rkey, html, int64(len(html)+64), epoch)
+	return html, true, nil
+}
+
+// SetRendered сохраняет HTML; недоступный Redis — не ошибка, отрендерим ещё раз
+func (c *NotesCache) SetRendered(ctx context.Context, userID int, key, html string) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+
+	rkey := c.renderKey(userID, key)
+	c.local.SetIfEpoch(rkey, html, int64(len(html)+64), c.local.epoch())
+	err := c.run(ctx, func(ctx context.Context) error {
+		return c.client.Set(ctx, rkey, html, c.ttl(c.renderTTL)).Err()
+	})
+	if err != nil && err != errBreakerOpen {
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
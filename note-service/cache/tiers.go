@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"myproject/models"
+)
+
+// Канал, по которому реплики сообщают друг другу, что локальные копии
+// устарели. Сообщение — "{userID}" (весь список и все заметки пользователя)
+// или "{userID}:{id}" (одна заметка и список).
+const invalidationChannel = "notes:invalidate"
+
+// Локальная копия одиночной заметки, в том числе закэшированный промах
+type localNote struct {
+	note  models.Note
+	found bool
+}
+
+// Примерный размер в памяти: строки плюс накладные расходы структуры
+func noteSize(n models.Note) int64 {
+	return int64(len(n.Title) + len(n.Content) + len(n.Format) + 64)
+}
+
+func notesSize(notes []models.Note) int64 {
+	size := int64(24)
+	for _, n := range notes {
+		size += noteSize(n)
+	}
+	return size
+}
+
+type tierCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (t *tierCounters) record(hit bool) {
+	if hit {
+		t.hits.Add(1)
+	} else {
+		t.misses.Add(1)
+	}
+}
+
+func (t *tierCounters) snapshot() TierStats {
+	s := TierStats{Hits: t.hits.Load(), Misses: t.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+type TierStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Stats — счётчики попаданий с момента старта процесса
+type Stats struct {
+	Local        TierStats `json:"local"`
+	Redis        TierStats `json:"redis"`
+	LocalEntries int       `json:"local_entries"`
+	LocalBytes   int64     `json:"local_bytes"`
+	LocalMax     int64     `json:"local_max_bytes"`
+	BreakerOpen  bool      `json:"redis_breaker_open"`
+}
+
+func (c *NotesCache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	entries, bytes := c.local.Len()
+	return Stats{
+		Local:        c.localStats.snapshot(),
+		Redis:        c.redisStats.snapshot(),
+		LocalEntries: entries,
+		LocalBytes:   bytes,
+		LocalMax:     c.localMaxBytes,
+		BreakerOpen:  c.breaker.isOpen(),
+	}
+}
+
+func (c *NotesCache) listLocalKey(userID int) string {
+	return fmt.Sprintf("list:%d", userID)
+}
+
+// dropLocal убирает локальные копии и рассылает инвалидацию остальным
+// репликам. id=0 — всё, что относится к пользователю.
+func (c *NotesCache) dropLocal(ctx context.Context, userID, id int) {
+	msg := c.applyInvalidation(userID, id)
+	if c.local == nil {
+		return
+	}
+	err := c.run(ctx, func(ctx context.Context) error {
+		return c.client.Publish(ctx, invalidationChannel, msg).Err()
+	})
+	if err != nil && err != errBreakerOpen {
+		// другие реплики увидят изменения не позже, чем через локальный TTL
+		fmt.Printf("[CACHE PUBLISH ERROR] user=%d: %v\n", userID, err)
+	}
+}
+
+func (c *NotesCache) applyInvalidation(userID, id int) string {
+	if id == 0 {
+		c.local.Remove(c.listLocalKey(userID))
+		c.local.RemovePrefix(fmt.Sprintf("note:{%d}:", userID))
+		return strconv.Itoa(userID)
+	}
+	c.local.Remove(c.listLocalKey(userID), c.noteKey(userID, id))
+	return fmt.Sprintf("%d:%d", userID, id)
+}
+
+// ListenInvalidations слушает инвалидации от других реплик, пока жив ctx.
+// Сообщения, потерянные при обрыве связи, компенсирует короткий локальный TTL.
+func (c *NotesCache) ListenInvalidations(ctx context.Context) {
+	if c == nil || c.client == nil || c.local == nil {
+		return
+	}
+
+	sub := c.client.Subscribe(ctx, invalidationChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			userPart, idPart, _ := strings.Cut(m.Payload, ":")
+			userID, err := strconv.Atoi(userPart)
+			if err != nil {
+				continue
+			}
+			id := 0
+			if idPart != "" {
+				if id, err = strconv.Atoi(idPart); err != nil {
+					continue
+				}
+			}
+			c.applyInvalidation(userID, id)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/models"
+)
+
+// Версии защищают кэш от «воскрешения» устаревших данных. Каждое изменение
+// заметок в Postgres увеличивает версию пользователя (note_versions) в той же
+// транзакции. В Redis notes:{u}:gen хранит последнюю известную версию:
+//
+//   - запись (SetNote/DeleteNote) поднимает gen до своей версии и правит
+//     индекс, только если он собран ровно по предыдущей версии;
+//   - заполнение после чтения из БД (FillNote/SetNotFound/SetNotes) не
+//     пишет ничего, если прочитанная версия ниже gen — значит, пока мы читали,
+//     кто-то успел записать более новые данные.
+//
+// Все проверки и записи делаются одним Lua-скриптом, то есть атомарно.
+const genTTL = 24 * time.Hour
+
+// KEYS: gen, note. ARGV: version, value, ttl_ms
+var fillScript = redis.NewScript(`
+local gen = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) < gen then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// KEYS: gen, index, ver, note. ARGV: version, op (set|del), value, note_ttl_ms, id, gen_ttl_ms
+var writeScript = redis.NewScript(`
+local v = tonumber(ARGV[1])
+local gen = tonumber(redis.call('GET', KEYS[1]) or '0')
+if v < gen then
+	-- уже записано что-то новее: наше значение могло устареть
+	redis.call('DEL', KEYS[2], KEYS[3], KEYS[4])
+	return 0
+end
+redis.call('SET', KEYS[1], v, 'PX', ARGV[6])
+redis.call('SET', KEYS[4], ARGV[3], 'PX', ARGV[4])
+
+local iv = tonumber(redis.call('GET', KEYS[3]) or '-1')
+if iv == v then
+	-- индекс уже перечитан из БД после нашей записи
+	return 1
+end
+if iv == v - 1 and redis.call('EXISTS', KEYS[2]) == 1 then
+	if ARGV[2] == 'set' then
+		redis.call('ZADD', KEYS[2], ARGV[5], ARGV[5])
+	else
+		redis.call('ZREM', KEYS[2], ARGV[5])
+	end
+	redis.call('SET', KEYS[3], v, 'KEEPTTL')
+else
+	-- пропущена чужая запись: индекс придётся перечитать
+	redis.call('DEL', KEYS[2], KEYS[3])
+end
+return 1
+`)
+
+// KEYS: gen, index, fresh, ver, note keys...
+// ARGV: version, fresh_ttl_ms, index_ttl_ms, gen_ttl_ms, note_ttl_ms, затем пары id, value
+var fillListScript = redis.NewScript(`
+local v = tonumber(ARGV[1])
+local gen = tonumber(redis.call('GET', KEYS[1]) or '0')
+if v < gen then
+	return 0
+end
+redis.call('SET', KEYS[1], v, 'PX', ARGV[4])
+redis.call('DEL', KEYS[2])
+redis.call('ZADD', KEYS[2], 0, '` + indexSentinel + `')
+for i = 5, #KEYS do
+	local id = ARGV[6 + (i - 5) * 2]
+	redis.call('ZADD', KEYS[2], id, id)
+	redis.call('SET', KEYS[i], ARGV[7 + (i - 5) * 2], 'PX', ARGV[5])
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+redis.call('SET', KEYS[4], v, 'PX', ARGV[3])
+redis.call('SET', KEYS[3], '1', 'PX', ARGV[2])
+return 1
+`)
+
+// KEYS: gen, index, fresh, ver, note keys... ARGV: version, gen_ttl_ms
+var invalidateScript = redis.NewScript(`
+if tonumber(ARGV[1]) > tonumber(redis.call('GET', KEYS[1]) or '0') then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+redis.call('DEL', unpack(KEYS, 2))
+return 1
+`)
+
+func (c *NotesCache) genKey(userID int) string {
+	return fmt.Sprintf("notes:{%d}:gen", userID)
+}
+
+func (c *NotesCache) versionKey(userID int) string {
+	return fmt.Sprintf("notes:{%d}:ver", userID)
+}
+
+func ms(d time.Duration) int64 {
+	return d.Milliseconds()
+}
+
+// FillNote кладёт в кэш заметку, прочитанную из БД на версии version
+func (c *NotesCache) FillNote(ctx context.Context, note models.Note, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+	return c.fill(ctx, note.UserID, note.Id, version, encodeNote(note, c.compressMinBytes), c.noteTTL)
+}
+
+// SetNotFound запоминает, что на версии version заметки с таким id у пользователя нет
+func (c *NotesCache) SetNotFound(ctx context.Context, userID, id int, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+	return c.fill(ctx, userID, id, version, []byte(notFoundMarker), c.negativeTTL)
+}
+
+func (c *NotesCache) fill(ctx context.Context, userID, id int, version int64, value []byte, ttl time.Duration) error {
+	err := c.run(ctx, func(ctx context.Context) error {
+		return fillScript.Run(ctx, c.client,
+			[]string{c.genKey(userID), c.noteKey(userID, id)},
+			version, value, ms(c.ttl(ttl)),
+		).Err()
+	})
+	if err != nil && err != errBreakerOpen {
+		return fmt.Errorf("redis fill note: %w", err)
+	}
+	return nil
+}
+
+// SetNote записывает изменённую заметку (write-through); version — версия,
+// которую вернула запись в БД
+func (c *NotesCache) SetNote(ctx context.Context, note models.Note, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+
+	// локальные копии сбрасываем в любом случае: в БД заметка уже другая
+	defer c.dropLocal(ctx, note.UserID, note.Id)
+
+	err := c.write(ctx, note.UserID, note.Id, version, "set", encodeNote(note, c.compressMinBytes), c.noteTTL)
+	if err != nil {
+		return c.writeFailed(note.UserID, note.Id, err, "redis set note")
+	}
+	return nil
+}
+
+// DeleteNote убирает заметку из индекса и запоминает её как отсутствующую
+func (c *NotesCache) DeleteNote(ctx context.Context, userID, id int, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+
+	defer c.dropLocal(ctx, userID, id)
+
+	err := c.write(ctx, userID, id, version, "del", []byte(notFoundMarker), c.negativeTTL)
+	if err != nil {
+		return c.writeFailed(userID, id, err, "redis delete note")
+	}
+	return nil
+}
+
+func (c *NotesCache) write(ctx context.Context, userID, id int, version int64, op string, value []byte, ttl time.Duration) error {
+	return c.run(ctx, func(ctx context.Context) error {
+		return writeScript.Run(ctx, c.client,
+			[]string{c.genKey(userID), c.indexKey(userID), c.versionKey(userID), c.noteKey(userID, id)},
+			version, op, value, ms(c.ttl(ttl)), id, ms(genTTL),
+		).Err()
+	})
+}
+
+// SetNotes кладёт в кэш весь список, прочитанный из БД на версии version:
+// сами заметки и индекс
+func (c *NotesCache) SetNotes(ctx context.Context, userID int, notes []models.Note, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+
+	// заметки и индекс должны пережить окно устаревания вместе
+	freshTTL := c.ttl(c.listTTL)
+	indexTTL := freshTTL + c.staleTTL
+	noteTTL := c.ttl(max(c.noteTTL, indexTTL))
+
+	keys := make([]string, 0, len(notes)+4)
+	keys = append(keys, c.genKey(userID), c.indexKey(userID), c.freshKey(userID), c.versionKey(userID))
+	args := make([]any, 0, 2*len(notes)+5)
+	args = append(args, version, ms(freshTTL), ms(indexTTL), ms(genTTL), ms(noteTTL))
+	for _, n := range notes {
+		keys = append(keys, c.noteKey(userID, n.Id))
+		args = append(args, strconv.Itoa(n.Id), encodeNote(n, c.compressMinBytes))
+	}
+
+	err := c.run(ctx, func(ctx context.Context) error {
+		return fillListScript.Run(ctx, c.client, keys, args...).Err()
+	})
+	if err != nil && err != errBreakerOpen {
+		return fmt.Errorf("redis set notes: %w", err)
+	}
+	return nil
+}
+
+// InvalidateNotes сбрасывает индекс и перечисленные заметки разом после
+// пакетной записи на версии version. gen поднимается до version, чтобы
+// чтения, начатые до коммита, не вернули в кэш старые данные.
+func (c *NotesCache) InvalidateNotes(ctx context.Context, userID int, ids []int, version int64) error {
+	if c == nil || c.client == nil {
+		return nil
+	}
+
+	defer c.dropLocal(ctx, userID, 0)
+
+	keys := make([]string, 0, len(ids)+4)
+	keys = append(keys, c.genKey(userID), c.indexKey(userID), c.freshKey(userID), c.versionKey(userID))
+	for _, id := range ids {
+		keys = append(keys, c.noteKey(userID, id))
+	}
+
+	err := c.run(ctx, func(ctx context.Context) error {
+		return invalidateScript.Run(ctx, c.client, keys, version, ms(genTTL)).Err()
+	})
+	if err != nil {
+		for _, id := range ids {
+			c.markPending(userID, id)
+		}
+		return c.writeFailed(userID, 0, err, "redis invalidate notes")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/problem"
+)
+
+// Типы сообщений
+const (
+	// первое сообщение подключения: документ, часы и другие участники
+	MsgInit = "init"
+	// операция, принятая в журнал; приходит и её автору — как подтверждение
+	MsgOp = "op"
+	// участник подключился или сдвинул курсор
+	MsgPresence = "presence"
+	MsgLeave    = "leave"
+	// операция клиента отклонена
+	MsgError = "error"
+	// от клиента: применены все операции до seq
+	MsgAck = "ack"
+	// заметку удалили — сеанс закончен
+	MsgClosed = "closed"
+	// только между репликами: документ построен заново (Site — участник его
+	// начальных символов), сеансы прежнего переподключают участников
+	MsgReset = "reset"
+)
+
+// Cursor — выделение: позиции сразу после символов Anchor и Head (нулевой
+// ID — начало текста)
+type Cursor struct {
+	Anchor ID `json:"anchor"`
+	Head   ID `json:"head"`
+}
+
+// Peer — участник сеанса. Seq — номер, до которого он применил операции.
+type Peer struct {
+	Site   string    `json:"site"`
+	UserID int       `json:"user_id"`
+	Cursor *Cursor   `json:"cursor,omitempty"`
+	Seq    int64     `json:"seq,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Message — сообщение сервера участнику. Seq — номер операции в журнале
+// заметки; у init — номер, до которого применён документ.
+type Message struct {
+	Type     string           `json:"type"`
+	Seq      int64            `json:"seq,omitempty"`
+	Site     string           `json:"site,omitempty"`
+	UserID   int              `json:"user_id,omitempty"`
+	Op       *Op              `json:"op,omitempty"`
+	Cursor   *Cursor          `json:"cursor,omitempty"`
+	Clock    int64            `json:"clock,omitempty"`
+	Text     string           `json:"text,omitempty"`
+	Elements []Element        `json:"elements,omitempty"`
+	Peers    []Peer           `json:"peers,omitempty"`
+	Error    *problem.Problem `json:"error,omitempty"`
+}
+
+// ClientMessage — сообщение участника: MsgOp с Op, MsgPresence с Cursor или
+// MsgAck. Seq в любом из них — номер последней применённой клиентом
+// операции; по нему сервер решает, когда надгробия больше никому не нужны.
+type ClientMessage struct {
+	Type   string  `json:"type"`
+	Op     *Op     `json:"op"`
+	Cursor *Cursor `json:"cursor"`
+	Seq    int64   `json:"seq"`
+}
+
+func decodeMessage(data string) (Message, error) {
+	var m Message
+	err := json.Unmarshal([]byte(data), &m)
+	return m, err
+}
+
+// Conn — подключение участника. Messages закрывается, когда подключение
+// закрыли, клиент не успевал читать, заметку удалили или сервис
+// останавливается; клиенту нужно подключиться заново.
+type Conn struct {
+	// Site — ID участника в операциях; выдаётся на каждое подключение
+	Site   string
+	UserID int
+
+	s    *session
+	out  chan Message
+	once sync.Once
+
+	mu     sync.Mutex
+	cursor *Cursor
+	seq    int64
+}
+
+func (c *Conn) Messages() <-chan Message {
+	return c.out
+}
+
+// Submit проверяет операцию и записывает её в журнал заметки
+func (c *Conn) Submit(op Op) error {
+	reply := make(chan error, 1)
+	select {
+	case c.s.submits <- submitReq{conn: c, op: op, reply: reply}:
+		return <-reply
+	case <-c.s.done:
+		return ErrUnavailable
+	}
+}
+
+// Move сообщает остальным участникам курсор этого подключения
+func (c *Conn) Move(ctx context.Context, cursor Cursor) error {
+	c.mu.Lock()
+	c.cursor = &cursor
+	c.mu.Unlock()
+	return c.s.announce(ctx, c.peer())
+}
+
+// Ack — клиент применил операции до seq; номер только растёт
+func (c *Conn) Ack(seq int64) {
+	c.mu.Lock()
+	c.seq = max(c.seq, seq)
+	c.mu.Unlock()
+}
+
+func (c *Conn) peer() Peer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Peer{Site: c.Site, UserID: c.UserID, Cursor: c.cursor, Seq: c.seq}
+}
+
+func (c *Conn) Close() {
+	c.once.Do(func() {
+		c.s.hub.leave(c)
+	})
+}
+
+// announce записывает участника в peers и рассылает его курсор
+func (s *session) announce(ctx context.Context, p Peer) error {
+	p.At = time.Now().UTC()
+	peer, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(Message{Type: MsgPresence, Site: p.Site, UserID: p.UserID, Cursor: p.Cursor})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opTimeout)
+	defer cancel()
+	peers := key(s.noteID, "peers")
+	_, err = s.hub.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, peers, p.Site, peer)
+		pipe.PExpire(ctx, peers, s.hub.ttl)
+		pipe.Publish(ctx, channel, fmt.Sprintf("%d 0 %s", s.noteID, msg))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Текст — RGA (replicated growable array): у каждого символа свой ID, вставка
+// ссылается на ID символа, после которого встаёт, удалённые символы остаются
+// надгробиями (пока их не уберёт Compact). Одновременные вставки в одно место упорядочиваются по ID,
+// поэтому все реплики, применив одни и те же операции в любом порядке (с
+// учётом причинности), получают один и тот же текст.
+
+var (
+	ErrBadOp = errors.New("invalid operation")
+	// текст после операции длиннее лимита note.content
+	ErrTooLong = errors.New("note content is too long")
+)
+
+// ID символа. Clock — часы Лэмпорта участника, Site — участник (выдаёт
+// сервер при подключении). Нулевой ID — начало текста.
+type ID struct {
+	Clock int64  `json:"clock"`
+	Site  string `json:"site"`
+}
+
+func (a ID) IsZero() bool {
+	return a.Clock == 0 && a.Site == ""
+}
+
+func (a ID) after(b ID) bool {
+	return a.Clock > b.Clock || (a.Clock == b.Clock && a.Site > b.Site)
+}
+
+// Element — символ текста
+type Element struct {
+	ID      ID     `json:"id"`
+	Char    string `json:"char"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Типы операций
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Op — изменение текста. insert: Text встаёт после After, его символы
+// получают ID с часами ID.Clock, ID.Clock+1, ...; delete: удаляются Targets.
+type Op struct {
+	Type    string `json:"type"`
+	ID      ID     `json:"id,omitempty"`
+	After   ID     `json:"after,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Targets []ID   `json:"targets,omitempty"`
+}
+
+// Doc — текст одной заметки: символы связаны в цепочку по порядку, а по ID
+// узел находится через map, поэтому вставка и удаление не перебирают текст
+type Doc struct {
+	head  node // перед первым символом
+	nodes map[ID]*node
+	// удаления символов, которые ещё не пришли: применятся при вставке
+	pending map[ID]struct{}
+	clock   int64
+	visible int
+}
+
+type node struct {
+	Element
+	next *node
+}
+
+func newDoc(size int) *Doc {
+	return &Doc{nodes: make(map[ID]*node, size), pending: make(map[ID]struct{})}
+}
+
+// NewDoc — документ из сохранённого текста; его символы получают ID с
+// участником site. Свой site у каждого построения не даёт операциям,
+// принятым для прежнего документа, попасть в символы нового.
+func NewDoc(site, text string) *Doc {
+	d := newDoc(utf8.RuneCountInString(text))
+	var after ID
+	for _, r := range text {
+		id := ID{Clock: d.clock + 1, Site: site}
+		d.integrate(id, after, string(r))
+		after = id
+	}
+	return d
+}
+
+// Restore — документ из Elements
+func Restore(elems []Element) (*Doc, error) {
+	d := newDoc(len(elems))
+	last := &d.head
+	for _, e := range elems {
+		if d.has(e.ID) || e.ID.IsZero() || utf8.RuneCountInString(e.Char) != 1 {
+			return nil, fmt.Errorf("collab: corrupt document at %v", e.ID)
+		}
+		last.next = &node{Element: e}
+		last = last.next
+		d.nodes[e.ID] = last
+		d.clock = max(d.clock, e.ID.Clock)
+		if !e.Deleted {
+			d.visible++
+		}
+	}
+	return d, nil
+}
+
+// Elements — все символы по порядку, вместе с надгробиями
+func (d *Doc) Elements() []Element {
+	out := make([]Element, 0, len(d.nodes))
+	for n := d.head.next; n != nil; n = n.next {
+		out = append(out, n.Element)
+	}
+	return out
+}
+
+func (d *Doc) Text() string {
+	var b strings.Builder
+	for n := d.head.next; n != nil; n = n.next {
+		if !n.Deleted {
+			b.WriteString(n.Char)
+		}
+	}
+	return b.String()
+}
+
+// Len — длина текста в символах
+func (d *Doc) Len() int {
+	return d.visible
+}
+
+// Clock — наибольшие часы в документе; новые ID участника должны быть больше
+func (d *Doc) Clock() int64 {
+	return d.clock
+}
+
+// Compact убирает надгробия и возвращает, сколько убрано. Вызывать, только
+// когда все участники применили все операции документа: тогда новые
+// вставки ссылаются лишь на видимые символы и получают часы больше любых
+// в документе, и без надгробий встают туда же, куда встали бы с ними.
+func (d *Doc) Compact() int {
+	removed := 0
+	for prev := &d.head; prev.next != nil; {
+		if n := prev.next; n.Deleted {
+			prev.next = n.next
+			delete(d.nodes, n.ID)
+			removed++
+			continue
+		}
+		prev = prev.next
+	}
+	return removed
+}
+
+// Check проверяет операцию участника site, не применяя её
+func (d *Doc) Check(op Op, site string) error {
+	switch op.Type {
+	case OpInsert:
+		n := utf8.RuneCountInString(op.Text)
+		switch {
+		case site == "" || op.ID.Site != site:
+			return fmt.Errorf("%w: id.site must be %q", ErrBadOp, site)
+		case n == 0 || !utf8.ValidString(op.Text):
+			return fmt.Errorf("%w: empty or invalid text", ErrBadOp)
+		case op.ID.Clock <= op.After.Clock:
+			// иначе порядок одновременных вставок разойдётся между репликами
+			return fmt.Errorf("%w: id.clock must be greater than after.clock", ErrBadOp)
+		case !op.After.IsZero() && !d.has(op.After):
+			return fmt.Errorf("%w: unknown after", ErrBadOp)
+		}
+		for i := range int64(n) {
+			if d.has(ID{Clock: op.ID.Clock + i, Site: site}) {
+				return fmt.Errorf("%w: id already used", ErrBadOp)
+			}
+		}
+	case OpDelete:
+		if len(op.Targets) == 0 {
+			return fmt.Errorf("%w: no targets", ErrBadOp)
+		}
+		for _, id := range op.Targets {
+			if !d.has(id) {
+				return fmt.Errorf("%w: unknown target", ErrBadOp)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: type must be insert or delete", ErrBadOp)
+	}
+	return nil
+}
+
+// Apply применяет операцию; повторное применение ничего не меняет.
+// changed=false — текст не изменился.
+func (d *Doc) Apply(op Op) (changed bool) {
+	switch op.Type {
+	case OpInsert:
+		after := op.After
+		clock := op.ID.Clock
+		for _, r := range op.Text {
+			id := ID{Clock: clock, Site: op.ID.Site}
+			if d.integrate(id, after, string(r)) {
+				changed = true
+			}
+			after = id
+			clock++
+		}
+	case OpDelete:
+		for _, id := range op.Targets {
+			n, ok := d.nodes[id]
+			switch {
+			case !ok:
+				// удаление обогнало вставку
+				d.pending[id] = struct{}{}
+			case !n.Deleted:
+				n.Deleted = true
+				d.visible--
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// integrate вставляет символ после after, пропуская соседей с большими ID:
+// они вставлены одновременно с ним в то же место (или позже — в их хвост)
+// и стоят первыми. changed=false — символа уже нет в тексте или он не встал.
+func (d *Doc) integrate(id, after ID, char string) bool {
+	if d.has(id) {
+		return false
+	}
+	prev := &d.head
+	if !after.IsZero() {
+		var ok bool
+		if prev, ok = d.nodes[after]; !ok {
+			return false
+		}
+	}
+	for prev.next != nil && prev.next.ID.after(id) {
+		prev = prev.next
+	}
+	n := &node{Element: Element{ID: id, Char: char}, next: prev.next}
+	prev.next = n
+	d.nodes[id] = n
+	d.clock = max(d.clock, id.Clock)
+	if _, ok := d.pending[id]; ok {
+		delete(d.pending, id)
+		n.Deleted = true
+		return false
+	}
+	d.visible++
+	return true
+}
+
+func (d *Doc) has(id ID) bool {
+	_, ok := d.nodes[id]
+	return ok
+}
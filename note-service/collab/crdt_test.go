@@ -0,0 +1,261 @@
+package collab
+
+import (
+	"strings"
+	"testing"
+)
+
+func ins(site string, clock int64, after ID, text string) Op {
+	return Op{Type: OpInsert, ID: ID{Clock: clock, Site: site}, After: after, Text: text}
+}
+
+func del(targets ...ID) Op {
+	return Op{Type: OpDelete, Targets: targets}
+}
+
+// документ "ab": a = {1 base}, b = {2 base}
+var (
+	idA = ID{Clock: 1, Site: "base"}
+	idB = ID{Clock: 2, Site: "base"}
+)
+
+func applyAll(t *testing.T, ops []Op) *Doc {
+	t.Helper()
+	d := NewDoc("base", "ab")
+	for _, op := range ops {
+		d.Apply(op)
+	}
+	return d
+}
+
+// permutations — все порядки ops
+func permutations(ops []Op) [][]Op {
+	if len(ops) <= 1 {
+		return [][]Op{ops}
+	}
+	var out [][]Op
+	for i := range ops {
+		rest := append(append([]Op(nil), ops[:i]...), ops[i+1:]...)
+		for _, p := range permutations(rest) {
+			out = append(out, append([]Op{ops[i]}, p...))
+		}
+	}
+	return out
+}
+
+func TestConcurrentInsertsConverge(t *testing.T) {
+	cases := []struct {
+		name string
+		ops  []Op
+		want string
+	}{
+		{
+			name: "same position, same clock",
+			ops:  []Op{ins("x", 3, idA, "X"), ins("y", 3, idA, "Y")},
+			want: "aYXb",
+		},
+		{
+			name: "same position, larger clock first",
+			ops:  []Op{ins("x", 5, idA, "XX"), ins("y", 3, idA, "YY")},
+			want: "aXXYYb",
+		},
+		{
+			name: "at the start",
+			ops:  []Op{ins("x", 3, ID{}, "X"), ins("y", 4, ID{}, "Y")},
+			want: "YXab",
+		},
+		{
+			name: "into the tail of a concurrent insert",
+			ops:  []Op{ins("x", 3, idA, "X"), ins("y", 4, idA, "Y"), ins("z", 5, ID{Clock: 3, Site: "x"}, "Z")},
+			want: "aYXZb",
+		},
+		{
+			name: "insert and delete of its neighbour",
+			ops:  []Op{ins("x", 3, idA, "X"), del(idA), del(idB)},
+			want: "X",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, order := range permutations(c.ops) {
+				if !causal(order) {
+					continue
+				}
+				if got := applyAll(t, order).Text(); got != c.want {
+					t.Fatalf("order %v: text %q, want %q", order, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	cases := []struct {
+		name string
+		op   Op
+		want string
+	}{
+		{"insert", ins("x", 3, idA, "XY"), "aXYb"},
+		{"insert at the start", ins("x", 3, ID{}, "X"), "Xab"},
+		{"delete", del(idA), "b"},
+		{"delete of both", del(idA, idB), ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := NewDoc("base", "ab")
+			if !d.Apply(c.op) {
+				t.Fatal("first apply changed nothing")
+			}
+			before := d.Elements()
+			if d.Apply(c.op) {
+				t.Fatal("second apply reported a change")
+			}
+			if got := d.Text(); got != c.want || d.Len() != len([]rune(c.want)) {
+				t.Fatalf("text %q (len %d), want %q", got, d.Len(), c.want)
+			}
+			if after := d.Elements(); len(after) != len(before) {
+				t.Fatalf("elements %d after second apply, want %d", len(after), len(before))
+			}
+		})
+	}
+}
+
+func TestDeleteBeforeInsertConverges(t *testing.T) {
+	x := ID{Clock: 3, Site: "x"}
+	cases := []struct {
+		name string
+		ops  []Op
+		want string
+	}{
+		{
+			name: "delete of the whole insert",
+			ops:  []Op{ins("x", 3, idA, "X"), del(x)},
+			want: "ab",
+		},
+		{
+			name: "delete of one inserted character",
+			ops:  []Op{ins("x", 3, idA, "XY"), del(ID{Clock: 4, Site: "x"})},
+			want: "aXb",
+		},
+		{
+			name: "delete of new and old characters",
+			ops:  []Op{ins("x", 3, idA, "X"), del(x, idB), ins("y", 4, x, "Y")},
+			want: "aY",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// причинный порядок и с удалением раньше вставки
+			for _, order := range permutations(c.ops) {
+				if !causal(order) {
+					continue
+				}
+				d := applyAll(t, order)
+				if got := d.Text(); got != c.want || d.Len() != len([]rune(c.want)) {
+					t.Fatalf("order %v: text %q (len %d), want %q", order, got, d.Len(), c.want)
+				}
+			}
+		})
+	}
+}
+
+// causal — вставка не раньше вставки, после которой она встаёт; удаления
+// могут обгонять что угодно
+func causal(ops []Op) bool {
+	seen := map[ID]bool{{}: true, idA: true, idB: true}
+	for _, op := range ops {
+		if op.Type != OpInsert {
+			continue
+		}
+		if !seen[op.After] {
+			return false
+		}
+		for i := range int64(len([]rune(op.Text))) {
+			seen[ID{Clock: op.ID.Clock + i, Site: op.ID.Site}] = true
+		}
+	}
+	return true
+}
+
+func TestCompactKeepsPlacement(t *testing.T) {
+	// "abc", удалили b; после Compact новые вставки встают так же, как с
+	// надгробием
+	c := ID{Clock: 3, Site: "base"}
+	later := []Op{ins("x", 10, idA, "X"), ins("y", 11, c, "Y"), ins("z", 10, ID{}, "Z")}
+
+	withTombstone := NewDoc("base", "abc")
+	withTombstone.Apply(del(idB))
+	compacted := NewDoc("base", "abc")
+	compacted.Apply(del(idB))
+	if n := compacted.Compact(); n != 1 {
+		t.Fatalf("Compact removed %d, want 1", n)
+	}
+	if got := len(compacted.Elements()); got != 2 {
+		t.Fatalf("%d elements after Compact, want 2", got)
+	}
+	for _, op := range later {
+		withTombstone.Apply(op)
+		compacted.Apply(op)
+	}
+	if a, b := withTombstone.Text(), compacted.Text(); a != b || a != "ZaXcY" {
+		t.Fatalf("with tombstone %q, compacted %q", a, b)
+	}
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	d := NewDoc("base", "привет")
+	d.Apply(ins("x", 10, ID{Clock: 3, Site: "base"}, "!"))
+	d.Apply(del(idA))
+
+	r, err := Restore(d.Elements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Text() != d.Text() || r.Len() != d.Len() || r.Clock() != d.Clock() {
+		t.Fatalf("restored %q/%d/%d, want %q/%d/%d", r.Text(), r.Len(), r.Clock(), d.Text(), d.Len(), d.Clock())
+	}
+	if _, err := Restore(append(d.Elements(), d.Elements()[0])); err == nil {
+		t.Fatal("duplicate id accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	d := NewDoc("base", "ab")
+	cases := []struct {
+		name string
+		op   Op
+		ok   bool
+	}{
+		{"insert", ins("x", 3, idA, "X"), true},
+		{"foreign site", ins("y", 3, idA, "X"), false},
+		{"clock not after anchor", ins("x", 1, idA, "X"), false},
+		{"unknown anchor", ins("x", 5, ID{Clock: 4, Site: "z"}, "X"), false},
+		{"id in use", Op{Type: OpInsert, ID: ID{Clock: 2, Site: "base"}, After: idA, Text: "X"}, false},
+		{"empty text", ins("x", 3, idA, ""), false},
+		{"delete", del(idB), true},
+		{"delete unknown", del(ID{Clock: 9, Site: "z"}), false},
+		{"unknown type", Op{Type: "move"}, false},
+	}
+	for _, c := range cases {
+		site := "x"
+		if c.op.Type == OpInsert && c.op.ID.Site == "base" {
+			site = "base"
+		}
+		if err := d.Check(c.op, site); (err == nil) != c.ok {
+			t.Errorf("%s: Check = %v", c.name, err)
+		}
+	}
+}
+
+func BenchmarkApplyTyping(b *testing.B) {
+	text := strings.Repeat("x", 20000)
+	for range b.N {
+		d := NewDoc("base", "")
+		after := ID{}
+		for i, r := range text {
+			id := ID{Clock: int64(i + 1), Site: "x"}
+			d.Apply(Op{Type: OpInsert, ID: id, After: after, Text: string(r)})
+			after = id
+		}
+	}
+}
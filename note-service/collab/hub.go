@@ -0,0 +1,260 @@
+// Package collab — совместное редактирование текста заметки через
+// WebSocket. Правки участников — операции над текстовым CRDT (см. crdt.go):
+// одновременные правки сливаются без потерь, и все видят один и тот же
+// текст. Курсоры участников рассылаются остальным.
+//
+// Операция получает номер в журнале заметки в Redis и публикуется в
+// pub/sub-канал; каждая реплика держит свою копию документа для заметок,
+// которые у неё открыты, и применяет операции по порядку номеров, дочитывая
+// пропущенное из журнала. Раз в COLLAB_SNAPSHOT_INTERVAL одна из реплик
+// сохраняет состояние документа в Redis, а текст — в notes.content, только
+// если заметку с прошлого сохранения не меняли (версия как в /sync).
+//
+// Текст в notes.content документа не старше: если его записали в обход
+// сеанса (REST, пакет, синхронизация — см. Notifier), документ строится
+// заново из notes.content, а участники переподключаются.
+//
+// Раскладка в Redis:
+//
+//	collab:{noteID}:log    — STREAM операций, id записи — "номер-0"
+//	collab:{noteID}:seq    — последний выданный номер
+//	collab:{noteID}:state  — состояние документа и номер, до которого оно применено
+//	collab:{noteID}:base   — HASH: версия и хэш текста заметки, записанного документом, и его эпоха
+//	collab:{noteID}:snap   — кто сейчас сохраняет (SET NX PX)
+//	collab:{noteID}:peers  — HASH site → участник с курсором
+//	collab:messages        — канал: "noteID номер json" (у курсоров номер 0)
+//
+// Ключи живут COLLAB_TTL после ухода последнего участника; следующий сеанс
+// возьмёт документ из Redis, только если notes.content с тех пор не меняли.
+package collab
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/internal/logger"
+	"myproject/service"
+)
+
+const (
+	channel   = "collab:messages"
+	opTimeout = 2 * time.Second
+	// участник без обновлений дольше — считается ушедшим (реплика упала)
+	peerTTL = time.Minute
+)
+
+var ErrUnavailable = errors.New("collaboration unavailable")
+
+// Номер операции и XADD/PUBLISH одним скриптом: порядок номеров совпадает с
+// порядком в журнале и в канале
+var publishScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[2])
+redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], n .. '-0', 'm', ARGV[2])
+for i = 1, #KEYS do redis.call('PEXPIRE', KEYS[i], ARGV[3]) end
+redis.call('PUBLISH', ARGV[4], ARGV[5] .. ' ' .. n .. ' ' .. ARGV[2])
+return n
+`)
+
+type Hub struct {
+	client   redis.UniversalClient
+	notes    service.NoteService
+	logSize  int
+	ttl      time.Duration
+	snapshot time.Duration
+	buffer   int
+
+	mu       sync.Mutex
+	sessions map[int]*session
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// NewHub — настройки из окружения: COLLAB_LOG_SIZE (сколько операций
+// хранить в журнале заметки, по умолчанию 10000), COLLAB_TTL (1h),
+// COLLAB_SNAPSHOT_INTERVAL (10s), COLLAB_BUFFER (очередь подключения; кто не
+// успевает её разбирать, отключается и подключается заново; 256)
+func NewHub(client redis.UniversalClient, notes service.NoteService) *Hub {
+	return &Hub{
+		client:   client,
+		notes:    notes,
+		logSize:  getInt("COLLAB_LOG_SIZE", 10000),
+		ttl:      getDuration("COLLAB_TTL", time.Hour),
+		snapshot: getDuration("COLLAB_SNAPSHOT_INTERVAL", 10*time.Second),
+		buffer:   getInt("COLLAB_BUFFER", 256),
+		sessions: make(map[int]*session),
+	}
+}
+
+func key(noteID int, suffix string) string {
+	return fmt.Sprintf("collab:{%d}:%s", noteID, suffix)
+}
+
+// keys — все ключи заметки, кроме snap: им продлевается срок
+func keys(noteID int) []string {
+	return []string{key(noteID, "log"), key(noteID, "seq"), key(noteID, "state"), key(noteID, "peers"), key(noteID, "base")}
+}
+
+// Join подключает пользователя к редактированию заметки. Первое сообщение
+// подключения — MsgInit с текущим документом.
+func (h *Hub) Join(ctx context.Context, userID, noteID int) (*Conn, error) {
+	note, err := h.notes.GetNote(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		Site:   newSite(userID),
+		UserID: userID,
+		out:    make(chan Message, h.buffer),
+	}
+
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		return nil, ErrUnavailable
+	}
+	s := h.sessions[noteID]
+	if s == nil {
+		s = newSession(h, note.Id, note.UserID)
+		h.sessions[noteID] = s
+		h.wg.Add(1)
+		go s.run()
+	}
+	s.refs++
+	c.s = s
+	h.mu.Unlock()
+
+	reply := make(chan error, 1)
+	select {
+	case s.joins <- joinReq{conn: c, reply: reply}:
+		err = <-reply
+	case <-s.done:
+		err = ErrUnavailable
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// leave — подключение закрыто; последнее подключение реплики завершает сеанс
+func (h *Hub) leave(c *Conn) {
+	s := c.s
+	h.mu.Lock()
+	s.refs--
+	if s.refs == 0 {
+		if h.sessions[s.noteID] == s {
+			delete(h.sessions, s.noteID)
+		}
+		s.stop()
+	}
+	h.mu.Unlock()
+
+	select {
+	case s.leaves <- c:
+	case <-s.done:
+	}
+}
+
+// Run слушает канал и передаёт сообщения сеансам этой реплики, пока жив
+// ctx; затем завершает сеансы (они сохраняют несохранённое) и ждёт их.
+// Сообщения, потерянные при обрыве связи с Redis, сеансы дочитают из журнала.
+func (h *Hub) Run(ctx context.Context) {
+	defer h.stop()
+
+	sub := h.client.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			noteID, in, err := parseMessage(m.Payload)
+			if err != nil {
+				logger.Errorf("collab: bad message: %v", err)
+				continue
+			}
+			h.dispatch(noteID, in)
+		}
+	}
+}
+
+func parseMessage(payload string) (int, inbound, error) {
+	parts := strings.SplitN(payload, " ", 3)
+	if len(parts) != 3 {
+		return 0, inbound{}, fmt.Errorf("malformed payload %.40q", payload)
+	}
+	noteID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, inbound{}, err
+	}
+	seq, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, inbound{}, err
+	}
+	msg, err := decodeMessage(parts[2])
+	return noteID, inbound{seq: seq, msg: msg}, err
+}
+
+func (h *Hub) dispatch(noteID int, in inbound) {
+	h.mu.Lock()
+	s := h.sessions[noteID]
+	h.mu.Unlock()
+	if s == nil {
+		return
+	}
+	select {
+	case s.inbox <- in:
+	default:
+		// сеанс не успевает; пропущенные операции он дочитает из журнала
+	}
+}
+
+func (h *Hub) stop() {
+	h.mu.Lock()
+	h.stopped = true
+	for id, s := range h.sessions {
+		delete(h.sessions, id)
+		s.stop()
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+}
+
+func newSite(userID int) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return fmt.Sprintf("%d.%s", userID, hex.EncodeToString(b))
+}
+
+func getDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+func getInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
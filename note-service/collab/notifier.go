@@ -0,0 +1,50 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/internal/logger"
+)
+
+// Документ стирается, и его сеансам на всех репликах уходит MsgReset без
+// Site — такой не совпадёт ни с одним документом
+var invalidateScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1], KEYS[2]) > 0 then
+  redis.call('PUBLISH', ARGV[1], ARGV[2] .. ' 0 ' .. ARGV[3])
+end
+return 1
+`)
+
+// Notifier — для сервисов заметок (service.CollabNotifier): текст заметки
+// записан в обход совместного редактирования или заметку удалили. Документ
+// в Redis стирается, сеансы переподключают участников, и те получают текст
+// из notes.content. Если Redis недоступен, документ устареет только до
+// сохранения: сеанс пишет текст, лишь если версия заметки не менялась.
+type Notifier struct {
+	client redis.UniversalClient
+}
+
+func NewNotifier(client redis.UniversalClient) *Notifier {
+	return &Notifier{client: client}
+}
+
+func (n *Notifier) ContentChanged(ctx context.Context, noteID int) {
+	if n == nil {
+		return
+	}
+	msg, err := json.Marshal(Message{Type: MsgReset})
+	if err != nil {
+		return
+	}
+	// запись уже сделана: отмена запроса не должна оставить документ старым
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opTimeout)
+	defer cancel()
+	err = invalidateScript.Run(ctx, n.client, []string{key(noteID, "state"), key(noteID, "base")},
+		channel, noteID, msg).Err()
+	if err != nil {
+		logger.Errorf("collab note=%d: invalidate: %v", noteID, err)
+	}
+}
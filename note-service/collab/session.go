@@ -0,0 +1,644 @@
+package collab
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/internal/logger"
+	"myproject/models"
+	"myproject/service"
+	"myproject/validation"
+)
+
+// сохранение текста идёт через сервис заметок: кэш, аудит, события
+const saveTimeout = 5 * time.Second
+
+type inbound struct {
+	seq int64
+	msg Message
+}
+
+type joinReq struct {
+	conn  *Conn
+	reply chan error
+}
+
+type submitReq struct {
+	conn  *Conn
+	op    Op
+	reply chan error
+}
+
+// state — документ в Redis: применены все операции до Seq (и, возможно,
+// часть следующих — повтор операции ничего не меняет)
+type state struct {
+	Seq      int64     `json:"seq"`
+	Elements []Element `json:"elements"`
+}
+
+// base — что из документа уже в notes.content: Version — версия заметки
+// после последней записи сеанса (или та, с которой документ построен), Hash
+// — хэш её текста, Pending — хэш текста, который записывается сейчас. Epoch
+// — участник начальных символов документа; у каждого построения свой.
+type base struct {
+	Version int64
+	Hash    string
+	Pending string
+	Epoch   string
+}
+
+// holds — текст заметки в БД записан этим документом (или взят в него)
+func (b base) holds(note models.SyncNote) bool {
+	h := textHash(note.Content)
+	return b.Version == note.Version || h == b.Hash || h == b.Pending
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// Документ заново из текста заметки, если base всё ещё эпохи ARGV[1] ("" —
+// документа нет). Сеансам прежнего документа уходит MsgReset.
+var rebuildScript = redis.NewScript(`
+if (redis.call('HGET', KEYS[3], 'epoch') or '') ~= ARGV[1] then return 0 end
+local seq = redis.call('GET', KEYS[1]) or '0'
+redis.call('SET', KEYS[2], '{"seq":' .. seq .. ',"elements":' .. ARGV[2] .. '}', 'PX', ARGV[6])
+redis.call('DEL', KEYS[3])
+redis.call('HSET', KEYS[3], 'version', ARGV[3], 'hash', ARGV[4], 'epoch', ARGV[5])
+redis.call('PEXPIRE', KEYS[3], ARGV[6])
+redis.call('PUBLISH', ARGV[7], ARGV[8] .. ' 0 ' .. ARGV[9])
+return 1
+`)
+
+// Запись сеанса — только пока документ той же эпохи: ARGV[3] — состояние
+// ("" — не менять), дальше — поля base
+var commitScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'epoch') ~= ARGV[1] then return 0 end
+if ARGV[3] ~= '' then redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[2]) end
+if #ARGV > 3 then redis.call('HSET', KEYS[1], unpack(ARGV, 4)) end
+return 1
+`)
+
+// errRebuilt — документ построен заново (или стёрт) другим сеансом
+var errRebuilt = errors.New("document was rebuilt")
+
+// session — открытая на этой реплике заметка. Всё состояние принадлежит
+// горутине run; остальные общаются с ней через каналы.
+type session struct {
+	hub    *Hub
+	noteID int
+	owner  int
+	refs   int // под hub.mu
+
+	joins    chan joinReq
+	leaves   chan *Conn
+	submits  chan submitReq
+	inbox    chan inbound
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+
+	doc *Doc
+	seq int64
+	// операции этой реплики, применённые раньше, чем до них дошла очередь
+	ahead map[int64]bool
+	conns map[*Conn]bool
+	dirty bool
+	epoch string
+	gone  bool
+}
+
+func newSession(h *Hub, noteID, owner int) *session {
+	return &session{
+		hub:     h,
+		noteID:  noteID,
+		owner:   owner,
+		joins:   make(chan joinReq),
+		leaves:  make(chan *Conn),
+		submits: make(chan submitReq),
+		inbox:   make(chan inbound, h.buffer),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		ahead:   make(map[int64]bool),
+		conns:   make(map[*Conn]bool),
+	}
+}
+
+// stop вызывается под hub.mu
+func (s *session) stop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+}
+
+func (s *session) run() {
+	defer s.hub.wg.Done()
+	defer close(s.done)
+
+	tick := time.NewTicker(s.hub.snapshot)
+	defer tick.Stop()
+	for {
+		select {
+		case r := <-s.joins:
+			r.reply <- s.join(r)
+		case c := <-s.leaves:
+			s.leave(c)
+		case r := <-s.submits:
+			r.reply <- s.submit(r)
+		case in := <-s.inbox:
+			s.receive(in)
+		case <-tick.C:
+			s.tick()
+		case <-s.quit:
+			s.shutdown()
+			return
+		}
+	}
+}
+
+func (s *session) join(r joinReq) error {
+	if s.gone {
+		return service.ErrNoteNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	if s.doc == nil {
+		if err := s.load(ctx); err != nil {
+			if errors.Is(err, service.ErrNoteNotFound) {
+				return err
+			}
+			logger.Errorf("collab note=%d: load: %v", s.noteID, err)
+			return ErrUnavailable
+		}
+	}
+	peers, err := s.peers(ctx, r.conn.Site)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	c := r.conn
+	s.conns[c] = true
+	// init несёт документ со всеми операциями до s.seq
+	c.Ack(s.seq)
+	c.out <- Message{
+		Type:     MsgInit,
+		Seq:      s.seq,
+		Site:     c.Site,
+		UserID:   c.UserID,
+		Clock:    s.doc.Clock(),
+		Text:     s.doc.Text(),
+		Elements: s.doc.Elements(),
+		Peers:    peers,
+	}
+	if err := s.announce(ctx, c.peer()); err != nil {
+		logger.Errorf("collab note=%d: announce %s: %v", s.noteID, c.Site, err)
+	}
+	return nil
+}
+
+// load читает документ из Redis. Если его нет или notes.content записан в
+// обход сеанса, документ строится заново из notes.content: текст в БД
+// всегда считается не старше документа.
+func (s *session) load(ctx context.Context) error {
+	for range 3 {
+		note, err := s.hub.notes.GetVersionedNote(ctx, s.owner, s.noteID)
+		if err != nil {
+			return err
+		}
+		data, err := s.hub.client.Get(ctx, key(s.noteID, "state")).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		b, ok, err := s.base(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case ok && data != "" && b.Version > note.Version:
+			// заметку прочли раньше, чем её сохранил другой сеанс
+			continue
+		case !ok || data == "" || !b.holds(note):
+			if err := s.rebuild(ctx, note, b.Epoch); err != nil {
+				return err
+			}
+			continue
+		case b.Version < note.Version && textHash(note.Content) == b.Hash:
+			// изменились заголовок или сроки, текст тот же
+			if err := s.commit(ctx, b.Epoch, nil, "version", note.Version); err != nil {
+				return err
+			}
+		}
+
+		var st state
+		if err := json.Unmarshal([]byte(data), &st); err != nil {
+			return fmt.Errorf("decode state: %w", err)
+		}
+		doc, err := Restore(st.Elements)
+		if err != nil {
+			return err
+		}
+		// прошлый сеанс мог не успеть сохранить текст
+		s.doc, s.seq, s.epoch, s.dirty = doc, st.Seq, b.Epoch, textHash(doc.Text()) != b.Hash
+		clear(s.ahead)
+		if err := s.catchUp(ctx); err != nil {
+			s.doc = nil
+			return err
+		}
+		return nil
+	}
+	return errRebuilt
+}
+
+// base читает collab:{id}:base; ok=false — его нет
+func (s *session) base(ctx context.Context) (base, bool, error) {
+	m, err := s.hub.client.HGetAll(ctx, key(s.noteID, "base")).Result()
+	if err != nil || m["epoch"] == "" {
+		return base{}, false, err
+	}
+	v, err := strconv.ParseInt(m["version"], 10, 64)
+	if err != nil {
+		return base{}, false, fmt.Errorf("bad base version %q", m["version"])
+	}
+	return base{Version: v, Hash: m["hash"], Pending: m["pending"], Epoch: m["epoch"]}, true, nil
+}
+
+// rebuild строит документ из текста заметки, если его эпоха всё ещё epoch.
+// Иначе его уже перестроил кто-то другой — load прочтёт новый.
+func (s *session) rebuild(ctx context.Context, note models.SyncNote, epoch string) error {
+	next := newSite(0)
+	elems, err := json.Marshal(NewDoc(next, note.Content).Elements())
+	if err != nil {
+		return err
+	}
+	reset, err := json.Marshal(Message{Type: MsgReset, Site: next})
+	if err != nil {
+		return err
+	}
+	return rebuildScript.Run(ctx, s.hub.client,
+		[]string{key(s.noteID, "seq"), key(s.noteID, "state"), key(s.noteID, "base")},
+		epoch, elems, note.Version, textHash(note.Content), next, s.hub.ttl.Milliseconds(),
+		channel, s.noteID, reset).Err()
+}
+
+// commit записывает состояние (если st не nil) и поля base, только пока
+// документ той же эпохи; иначе errRebuilt
+func (s *session) commit(ctx context.Context, epoch string, st *state, fields ...any) error {
+	var data []byte
+	if st != nil {
+		var err error
+		if data, err = json.Marshal(st); err != nil {
+			return err
+		}
+	}
+	args := append([]any{epoch, s.hub.ttl.Milliseconds(), data}, fields...)
+	ok, err := commitScript.Run(ctx, s.hub.client,
+		[]string{key(s.noteID, "base"), key(s.noteID, "state")}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return errRebuilt
+	}
+	return nil
+}
+
+// catchUp применяет из журнала всё после s.seq
+func (s *session) catchUp(ctx context.Context) error {
+	msgs, err := s.hub.client.XRange(ctx, key(s.noteID, "log"), fmt.Sprintf("%d-0", s.seq+1), "+").Result()
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		seqPart, _, _ := strings.Cut(m.ID, "-")
+		seq, err := strconv.ParseInt(seqPart, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad log id %q", m.ID)
+		}
+		if seq != s.seq+1 {
+			return fmt.Errorf("operations %d..%d are no longer in the log", s.seq+1, seq-1)
+		}
+		data, _ := m.Values["m"].(string)
+		msg, err := decodeMessage(data)
+		if err != nil {
+			return fmt.Errorf("decode operation %d: %w", seq, err)
+		}
+		s.apply(seq, msg)
+	}
+	return nil
+}
+
+func (s *session) receive(in inbound) {
+	if s.doc == nil {
+		return
+	}
+	switch {
+	case in.msg.Type == MsgReset:
+		if in.msg.Site != s.epoch {
+			s.reset(errRebuilt)
+		}
+	case in.seq == 0:
+		// курсоры; своему автору не нужны
+		s.broadcast(in.msg, in.msg.Site)
+	case in.seq == s.seq+1:
+		s.apply(in.seq, in.msg)
+	case in.seq > s.seq+1:
+		ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+		defer cancel()
+		if err := s.catchUp(ctx); err != nil {
+			s.reset(err)
+		}
+	}
+}
+
+func (s *session) apply(seq int64, msg Message) {
+	s.seq = seq
+	if s.ahead[seq] {
+		delete(s.ahead, seq)
+		return
+	}
+	if msg.Op != nil && s.doc.Apply(*msg.Op) {
+		s.dirty = true
+	}
+	msg.Seq = seq
+	s.broadcast(msg, "")
+}
+
+// submit пишет операцию в журнал и сразу применяет её: автор и соседи по
+// реплике увидят её, не дожидаясь канала
+func (s *session) submit(r submitReq) error {
+	c := r.conn
+	if s.doc == nil || !s.conns[c] {
+		return ErrUnavailable
+	}
+	if err := s.doc.Check(r.op, c.Site); err != nil {
+		return err
+	}
+	if r.op.Type == OpInsert && s.doc.Len()+utf8.RuneCountInString(r.op.Text) > validation.Limit("note.content") {
+		return ErrTooLong
+	}
+
+	msg := Message{Type: MsgOp, Site: c.Site, UserID: c.UserID, Op: &r.op}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	seq, err := publishScript.Run(ctx, s.hub.client, keys(s.noteID),
+		s.hub.logSize, data, s.hub.ttl.Milliseconds(), channel, s.noteID).Int64()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if s.doc.Apply(r.op) {
+		s.dirty = true
+	}
+	if seq == s.seq+1 {
+		s.seq = seq
+	} else {
+		s.ahead[seq] = true
+	}
+	msg.Seq = seq
+	s.broadcast(msg, "")
+	return nil
+}
+
+func (s *session) tick() {
+	if s.doc == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	// канал мог потерять сообщения — журнал их помнит, а эпоха — base
+	if epoch, err := s.hub.client.HGet(ctx, key(s.noteID, "base"), "epoch").Result(); err == nil || errors.Is(err, redis.Nil) {
+		if epoch != s.epoch {
+			s.reset(errRebuilt)
+			return
+		}
+	}
+	if err := s.catchUp(ctx); err != nil {
+		s.reset(err)
+		return
+	}
+	s.touch(ctx)
+	if !s.dirty {
+		return
+	}
+	// сохраняет одна реплика за интервал
+	ok, err := s.hub.client.SetNX(ctx, key(s.noteID, "snap"), 1, s.hub.snapshot).Result()
+	if err != nil || !ok {
+		return
+	}
+	s.save(ctx)
+}
+
+// touch продлевает ключи заметки и отметки участников этой реплики
+func (s *session) touch(ctx context.Context) {
+	peers := key(s.noteID, "peers")
+	_, err := s.hub.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for c := range s.conns {
+			p := c.peer()
+			p.At = time.Now().UTC()
+			if b, err := json.Marshal(p); err == nil {
+				pipe.HSet(ctx, peers, p.Site, b)
+			}
+		}
+		for _, k := range keys(s.noteID) {
+			pipe.PExpire(ctx, k, s.hub.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("collab note=%d: touch: %v", s.noteID, err)
+	}
+}
+
+// save записывает текст в заметку, только если её не меняли с версии из
+// base, а затем состояние документа в Redis. Если текст заметки записали в
+// обход сеанса, он новее: документ строится из него заново.
+func (s *session) save(ctx context.Context) {
+	b, ok, err := s.base(ctx)
+	if err != nil {
+		logger.Errorf("collab note=%d: save: %v", s.noteID, err)
+		return
+	}
+	if !ok || b.Epoch != s.epoch {
+		s.reset(errRebuilt)
+		return
+	}
+
+	text := s.doc.Text()
+	if h := textHash(text); h != b.Hash {
+		if err := s.commit(ctx, s.epoch, nil, "pending", h); err != nil {
+			s.saveFailed(err)
+			return
+		}
+		note, err := s.hub.notes.SaveContent(ctx, s.owner, s.noteID, text, b.Version)
+		switch {
+		case errors.Is(err, service.ErrNoteNotFound):
+			s.close()
+			return
+		case errors.Is(err, service.ErrSyncConflict) && textHash(note.Content) == b.Hash:
+			// изменились заголовок или сроки — текст запишем в следующий раз
+			if err := s.commit(ctx, s.epoch, nil, "version", note.Version); err != nil {
+				s.saveFailed(err)
+			}
+			return
+		case errors.Is(err, service.ErrSyncConflict):
+			if err := s.rebuild(ctx, note, s.epoch); err != nil {
+				logger.Errorf("collab note=%d: rebuild: %v", s.noteID, err)
+			}
+			s.reset(fmt.Errorf("note content changed outside the session (version %d)", note.Version))
+			return
+		case err != nil:
+			logger.Errorf("collab note=%d: save content: %v", s.noteID, err)
+			return
+		}
+		b.Version, b.Hash = note.Version, h
+	}
+
+	s.compact(ctx)
+	st := &state{Seq: s.seq, Elements: s.doc.Elements()}
+	if err := s.commit(ctx, s.epoch, st, "version", b.Version, "hash", b.Hash, "pending", ""); err != nil {
+		s.saveFailed(err)
+		return
+	}
+	s.dirty = false
+}
+
+// compact убирает из документа надгробия, если все участники со всех
+// реплик подтвердили все операции до s.seq. Иначе надгробия копились бы весь
+// сеанс — в состоянии, в init и в удалении всего текста.
+func (s *session) compact(ctx context.Context) {
+	all, err := s.hub.client.HGetAll(ctx, key(s.noteID, "peers")).Result()
+	if err != nil {
+		return
+	}
+	for _, v := range all {
+		var p Peer
+		if json.Unmarshal([]byte(v), &p) != nil {
+			return
+		}
+		if time.Since(p.At) <= peerTTL && p.Seq < s.seq {
+			return
+		}
+	}
+	s.doc.Compact()
+}
+
+func (s *session) saveFailed(err error) {
+	if errors.Is(err, errRebuilt) {
+		s.reset(err)
+		return
+	}
+	logger.Errorf("collab note=%d: save state: %v", s.noteID, err)
+}
+
+// close — заметку удалили: сеанс заканчивается, состояние стирается
+func (s *session) close() {
+	s.gone = true
+	s.doc = nil
+	s.broadcast(Message{Type: MsgClosed}, "")
+	s.disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := s.hub.client.Del(ctx, keys(s.noteID)...).Err(); err != nil {
+		logger.Errorf("collab note=%d: delete state: %v", s.noteID, err)
+	}
+}
+
+// reset — документ разошёлся с журналом. Участники переподключатся и
+// получат документ заново.
+func (s *session) reset(err error) {
+	logger.Errorf("collab note=%d: resync: %v", s.noteID, err)
+	s.doc = nil
+	s.disconnect()
+}
+
+func (s *session) leave(c *Conn) {
+	if !s.conns[c] {
+		return
+	}
+	delete(s.conns, c)
+	close(c.out)
+	s.depart(c)
+}
+
+func (s *session) shutdown() {
+	if s.doc != nil && s.dirty {
+		ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+		s.save(ctx)
+		cancel()
+	}
+	s.disconnect()
+}
+
+func (s *session) disconnect() {
+	for c := range s.conns {
+		delete(s.conns, c)
+		close(c.out)
+		s.depart(c)
+	}
+}
+
+// depart убирает участника из peers и сообщает остальным
+func (s *session) depart(c *Conn) {
+	msg, _ := json.Marshal(Message{Type: MsgLeave, Site: c.Site, UserID: c.UserID})
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	_, err := s.hub.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, key(s.noteID, "peers"), c.Site)
+		pipe.Publish(ctx, channel, fmt.Sprintf("%d 0 %s", s.noteID, msg))
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("collab note=%d: depart %s: %v", s.noteID, c.Site, err)
+	}
+}
+
+// peers — участники со всех реплик, кроме site
+func (s *session) peers(ctx context.Context, site string) ([]Peer, error) {
+	all, err := s.hub.client.HGetAll(ctx, key(s.noteID, "peers")).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Peer, 0, len(all))
+	for k, v := range all {
+		var p Peer
+		if k == site || json.Unmarshal([]byte(v), &p) != nil || time.Since(p.At) > peerTTL {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (s *session) broadcast(msg Message, except string) {
+	for c := range s.conns {
+		if c.Site == except {
+			continue
+		}
+		select {
+		case c.out <- msg:
+		default:
+			// медленный клиент не должен тормозить остальных
+			delete(s.conns, c)
+			close(c.out)
+			s.depart(c)
+		}
+	}
+}
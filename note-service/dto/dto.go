@@ -1,17 +1,182 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+
+	"myproject/models"
+	"myproject/problem"
+)
+
+// Правила проверки — в тегах validate (см. пакет validation)
+// Пустой Format — plain. DueAt и RemindAt — RFC 3339 или местное время
+// пользователя без смещения ("2026-03-01T09:00"), см. service.ParseTime.
 type NoteRequest struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title    string  `json:"title" validate:"notblank,maxrunes=note.title"`
+	Content  string  `json:"content" validate:"maxrunes=note.content"`
+	Format   string  `json:"format" validate:"omitempty,oneof=plain markdown"`
+	DueAt    *string `json:"due_at"`
+	RemindAt *string `json:"remind_at"`
 }
 
 type NoteResponse struct {
-	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	ID       int        `json:"id"`
+	Title    string     `json:"title"`
+	Content  string     `json:"content"`
+	Format   string     `json:"format"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	RemindAt *time.Time `json:"remind_at,omitempty"`
 }
 
+// Не переданное поле (nil) не меняется и не проверяется; сроки можно
+// сбросить, передав null
 type NoteUpdateRequest struct {
-	Title   *string `json:"title"`
-	Content *string `json:"content"`
+	Title    *string          `json:"title" validate:"omitnil,notblank,maxrunes=note.title"`
+	Content  *string          `json:"content" validate:"omitnil,maxrunes=note.content"`
+	Format   *string          `json:"format" validate:"omitnil,oneof=plain markdown"`
+	DueAt    Nullable[string] `json:"due_at"`
+	RemindAt Nullable[string] `json:"remind_at"`
+}
+
+// Nullable — поле PATCH, которое можно сбросить: Set — поле есть в запросе,
+// Null — в нём null
+type Nullable[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
+}
+
+// Режимы пакета: atomic — всё или ничего, partial — каждая операция сама по себе
+const (
+	BatchAtomic  = "atomic"
+	BatchPartial = "partial"
+)
+
+// Операции проверяются по отдельности, чтобы в режиме partial ошибка одной
+// не отменяла остальные; здесь — только форма пакета
+type BatchRequest struct {
+	Mode       string           `json:"mode" validate:"omitempty,oneof=atomic partial"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,maxitems=note.batch"`
+}
+
+// Op: create (title, content, format, сроки), update (id и изменяемые поля),
+// delete (id). Сроки — как в NoteRequest; в update null сбрасывает срок.
+type BatchOperation struct {
+	Op       string           `json:"op"`
+	ID       int              `json:"id"`
+	Title    *string          `json:"title"`
+	Content  *string          `json:"content"`
+	Format   *string          `json:"format"`
+	DueAt    Nullable[string] `json:"due_at"`
+	RemindAt Nullable[string] `json:"remind_at"`
+}
+
+type BatchResponse struct {
+	Mode      string            `json:"mode"`
+	Committed bool              `json:"committed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// Status — HTTP-статус, который вернул бы одиночный запрос; Error — его тело.
+// Note есть у create и update, у delete — только ID.
+type BatchItemResult struct {
+	Index  int              `json:"index"`
+	Op     string           `json:"op"`
+	Status int              `json:"status"`
+	ID     int              `json:"id,omitempty"`
+	Note   *NoteResponse    `json:"note,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// Изменения проверяются по отдельности: ошибка или конфликт одного не
+// мешает остальным
+type SyncRequest struct {
+	Changes []SyncChange `json:"changes" validate:"required,min=1,maxitems=note.batch"`
+}
+
+// Op: create (client_id, title, content, format, сроки), update (id,
+// base_version и изменяемые поля), delete (id, base_version). base_version —
+// version заметки, которую клиент видел последней. Сроки — как в BatchOperation.
+type SyncChange struct {
+	Op          string           `json:"op"`
+	ClientID    string           `json:"client_id" validate:"omitempty,max=64"`
+	ID          int              `json:"id"`
+	BaseVersion *int64           `json:"base_version"`
+	Title       *string          `json:"title"`
+	Content     *string          `json:"content"`
+	Format      *string          `json:"format"`
+	DueAt       Nullable[string] `json:"due_at"`
+	RemindAt    Nullable[string] `json:"remind_at"`
+}
+
+// Next — токен для следующего GET /sync; HasMore — изменения не уместились
+// в страницу и запрос нужно сразу повторить с Next
+type SyncResponse struct {
+	Notes   []models.SyncNote  `json:"notes"`
+	Deleted []models.Tombstone `json:"deleted"`
+	Next    string             `json:"next"`
+	HasMore bool               `json:"has_more"`
+}
+
+type SyncPushResponse struct {
+	Results []SyncItemResult `json:"results"`
+}
+
+// Status — как у одиночного запроса, 409 — конфликт. Note — заметка после
+// create/update; Server — её текущая версия при конфликте; Deleted —
+// надгробие после delete или при конфликте с удалением на сервере.
+type SyncItemResult struct {
+	Index    int               `json:"index"`
+	Op       string            `json:"op"`
+	ClientID string            `json:"client_id,omitempty"`
+	Status   int               `json:"status"`
+	ID       int               `json:"id,omitempty"`
+	Note     *models.SyncNote  `json:"note,omitempty"`
+	Server   *models.SyncNote  `json:"server,omitempty"`
+	Deleted  *models.Tombstone `json:"deleted,omitempty"`
+	Error    *problem.Problem  `json:"error,omitempty"`
+}
+
+// Переменные в title и content — см. пакет templating; fields — поля шаблона
+// со значениями по умолчанию. name и locale уникальны у владельца.
+type TemplateRequest struct {
+	Name    string            `json:"name" validate:"notblank,max=100"`
+	Locale  string            `json:"locale" validate:"omitempty,max=16"`
+	Title   string            `json:"title" validate:"notblank,maxrunes=note.title"`
+	Content string            `json:"content" validate:"maxrunes=note.content"`
+	Format  string            `json:"format" validate:"omitempty,oneof=plain markdown"`
+	Fields  map[string]string `json:"fields" validate:"max=50"`
+}
+
+// Не переданное поле (nil) не меняется; fields заменяются целиком
+type TemplateUpdateRequest struct {
+	Name    *string           `json:"name" validate:"omitnil,notblank,max=100"`
+	Locale  *string           `json:"locale" validate:"omitnil,max=16"`
+	Title   *string           `json:"title" validate:"omitnil,notblank,maxrunes=note.title"`
+	Content *string           `json:"content" validate:"omitnil,maxrunes=note.content"`
+	Format  *string           `json:"format" validate:"omitnil,oneof=plain markdown"`
+	Fields  map[string]string `json:"fields" validate:"omitempty,max=50"`
+}
+
+// Заметка из шаблона: Title заменяет заголовок шаблона (переменные в нём
+// тоже подставляются), Fields — значения полей шаблона
+type NoteFromTemplateRequest struct {
+	Title  *string           `json:"title"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Timezone — имя IANA ("Europe/Moscow"); по нему переводится местное время
+// в due_at, remind_at и due_before. Пустое поле не меняется.
+type UserSettings struct {
+	Timezone string `json:"timezone" validate:"max=64"`
+	Locale   string `json:"locale" validate:"max=16"`
 }
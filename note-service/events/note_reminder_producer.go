@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"myproject/models"
+)
+
+// ReminderPublisher пишет события note_reminder в KAFKA_NOTE_REMINDER_TOPIC.
+// Ключ — user_id: напоминания одного пользователя идут в одну партицию по
+// порядку.
+type ReminderPublisher struct {
+	w *kafka.Writer
+}
+
+func NewReminderPublisher() *ReminderPublisher {
+	broker := os.Getenv("KAFKA_BROKER")
+	if broker == "" {
+		broker = "kafka:9092"
+	}
+	topic := os.Getenv("KAFKA_NOTE_REMINDER_TOPIC")
+	if topic == "" {
+		topic = "note_reminder"
+	}
+
+	return &ReminderPublisher{w: &kafka.Writer{
+		Addr:                   kafka.TCP(broker),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}}
+}
+
+func (p *ReminderPublisher) PublishReminder(ctx context.Context, r models.Reminder) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal reminder: %w", err)
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(fmt.Sprint(r.UserID)),
+		Value: data,
+		Time:  time.Now(),
+	}
+	if err := p.w.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("write kafka message: %w", err)
+	}
+	return nil
+}
+
+func (p *ReminderPublisher) Close() error {
+	return p.w.Close()
+}
@@ -9,15 +9,21 @@ import (
 
 	"github.com/segmentio/kafka-go"
 
+	"myproject/audit"
+	"myproject/models"
 	"myproject/service"
 )
 
+// Locale — язык пользователя ("ru", "en-US"); может отсутствовать
 type UserRegisteredEvent struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
+	Locale string `json:"locale,omitempty"`
 }
 
-func RunUserRegisteredConsumer(ctx context.Context, noteSvc service.NoteService) error {
+// Приветственная заметка строится из системного шаблона (WELCOME_TEMPLATE) на
+// языке пользователя
+func RunUserRegisteredConsumer(ctx context.Context, templates service.TemplateService) error {
 	broker := os.Getenv("KAFKA_BROKER")
 	if broker == "" {
 		broker = "kafka:9092"
@@ -70,10 +76,12 @@ func RunUserRegisteredConsumer(ctx context.Context, noteSvc service.NoteService)
 			// ЛОГ №2 — начинаем создание
 			fmt.Printf("[KAFKA] creating welcome note for user=%d\n", ev.UserID)
 
-			title := "Добро пожаловать!"
-			content := fmt.Sprintf("Привет, %s! Это ваша первая заметка.", ev.Email)
+			// в журнале аудита вместо request id — координаты сообщения Kafka
+			noteCtx := audit.WithMeta(context.Background(), audit.Meta{
+				RequestID: fmt.Sprintf("kafka:%s/%d/%d", m.Topic, m.Partition, m.Offset),
+			})
 
-			id, err := noteSvc.CreateNote(context.Background(), ev.UserID, title, content)
+			id, err := templates.CreateWelcomeNote(noteCtx, models.UserProfile{UserID: ev.UserID, Email: ev.Email, Locale: ev.Locale})
 			if err != nil {
 				fmt.Printf("[KAFKA] failed to create welcome note for user=%d: %v\n", ev.UserID, err)
 				continue
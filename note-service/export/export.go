@@ -0,0 +1,106 @@
+// Package export выгружает заметки пользователя в файл: ZIP с Markdown,
+// один JSON-документ или ZIP со статическим HTML-сайтом. Заметки берутся
+// из курсора по одной и сразу пишутся в выход — весь список в памяти
+// не собирается.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"myproject/models"
+)
+
+const (
+	FormatZIP  = "zip"  // Markdown-файлы с YAML front-matter
+	FormatJSON = "json" // один документ {"exported_at", "notes": [...]}
+	FormatHTML = "html" // ZIP: index.html и страница на каждую заметку
+)
+
+var ErrUnknownFormat = errors.New("format must be one of: zip, json, html")
+
+// Notes — источник заметок; его реализует repository.NoteCursor
+type Notes interface {
+	Next() bool
+	Note() models.StoredNote
+	Err() error
+}
+
+func Valid(format string) bool {
+	switch format {
+	case FormatZIP, FormatJSON, FormatHTML:
+		return true
+	}
+	return false
+}
+
+func ContentType(format string) string {
+	if format == FormatJSON {
+		return "application/json"
+	}
+	return "application/zip"
+}
+
+// FileName — имя файла для Content-Disposition
+func FileName(format string, now time.Time) string {
+	base := "notes-" + now.UTC().Format("20060102")
+	switch format {
+	case FormatJSON:
+		return base + ".json"
+	case FormatHTML:
+		return base + "-html.zip"
+	}
+	return base + ".zip"
+}
+
+// Write пишет все заметки из notes в w в формате format
+func Write(w io.Writer, format string, notes Notes, now time.Time) error {
+	switch format {
+	case FormatZIP:
+		return writeMarkdownZIP(w, notes)
+	case FormatJSON:
+		return writeJSON(w, notes, now)
+	case FormatHTML:
+		return writeHTMLZIP(w, notes, now)
+	}
+	return ErrUnknownFormat
+}
+
+const maxSlugRunes = 60
+
+// slug — безопасная часть имени файла из заголовка: буквы и цифры любых
+// алфавитов, остальное заменяется дефисами
+func slug(title string) string {
+	var b strings.Builder
+	n, dash := 0, false
+	for _, r := range strings.ToLower(title) {
+		if n == maxSlugRunes {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			n++
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			n++
+			dash = true
+		}
+	}
+	s := strings.TrimRight(b.String(), "-")
+	if s == "" {
+		return "note"
+	}
+	return s
+}
+
+// Имя файла заметки в архиве; id делает его уникальным
+func fileName(n models.StoredNote, ext string) string {
+	return fmt.Sprintf("%d-%s.%s", n.Id, slug(n.Title), ext)
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"myproject/render"
+)
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="../style.css">
+</head>
+<body>
+<p><a href="../index.html">← Все заметки</a></p>
+<h1>{{.Title}}</h1>
+<p class="meta">Создана {{.CreatedAt.UTC.Format "2006-01-02 15:04"}} · изменена {{.UpdatedAt.UTC.Format "2006-01-02 15:04"}}</p>
+<div class="note">{{.Body}}</div>
+</body>
+</html>
+`))
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Заметки</title>
+<link rel="stylesheet" href="style.css">
+</head>
+<body>
+<h1>Заметки</h1>
+<p class="meta">Выгружено {{.ExportedAt.UTC.Format "2006-01-02 15:04"}} UTC</p>
+<ul>
+{{range .Pages}}<li><a href="notes/{{.File}}">{{.Title}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// к своим стилям добавляется подсветка кода из render.CSS
+const styleCSS = `body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; }
+pre.note-plain { white-space: pre-wrap; font-family: inherit; }
+.note table { border-collapse: collapse; }
+.note th, .note td { border: 1px solid #ccc; padding: 0.25rem 0.5rem; }
+.note li:has(> input[type=checkbox]) { list-style: none; }
+.meta { color: #666; font-size: 0.9em; }
+`
+
+type indexPage struct {
+	File  string
+	Title string
+}
+
+// writeHTMLZIP пишет страницы заметок по мере чтения; для оглавления
+// в памяти остаются только имена файлов и заголовки
+func writeHTMLZIP(w io.Writer, notes Notes, now time.Time) error {
+	zw := zip.NewWriter(w)
+	var pages []indexPage
+
+	for notes.Next() {
+		n := notes.Note()
+		page := indexPage{File: fileName(n, "html"), Title: n.Title}
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     "notes/" + page.File,
+			Method:   zip.Deflate,
+			Modified: n.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("export: zip entry note=%d: %w", n.Id, err)
+		}
+		// HTML уже очищен санитайзером, поэтому шаблон его не экранирует
+		body, err := render.HTML(n.Format, n.Content)
+		if err != nil {
+			return fmt.Errorf("export: render note=%d: %w", n.Id, err)
+		}
+		err = pageTemplate.Execute(f, struct {
+			Title                string
+			CreatedAt, UpdatedAt time.Time
+			Body                 template.HTML
+		}{n.Title, n.CreatedAt, n.UpdatedAt, template.HTML(body)})
+		if err != nil {
+			return fmt.Errorf("export: render note=%d: %w", n.Id, err)
+		}
+		pages = append(pages, page)
+	}
+	if err := notes.Err(); err != nil {
+		return err
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return fmt.Errorf("export: zip entry index: %w", err)
+	}
+	err = indexTemplate.Execute(f, struct {
+		ExportedAt time.Time
+		Pages      []indexPage
+	}{now, pages})
+	if err != nil {
+		return fmt.Errorf("export: render index: %w", err)
+	}
+
+	f, err = zw.CreateHeader(&zip.FileHeader{Name: "style.css", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return fmt.Errorf("export: zip entry style: %w", err)
+	}
+	if _, err := io.WriteString(f, styleCSS+render.CSS()); err != nil {
+		return fmt.Errorf("export: write style: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("export: close zip: %w", err)
+	}
+	return nil
+}
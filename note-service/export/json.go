@@ -0,0 +1,41 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// writeJSON пишет {"exported_at": ..., "notes": [...]}, кодируя заметки по одной
+func writeJSON(w io.Writer, notes Notes, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	exportedAt, _ := json.Marshal(now.UTC())
+	fmt.Fprintf(bw, `{"exported_at":%s,"notes":[`, exportedAt)
+
+	first := true
+	for notes.Next() {
+		n := notes.Note()
+		data, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("export: encode note=%d: %w", n.Id, err)
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("export: write note=%d: %w", n.Id, err)
+		}
+	}
+	if err := notes.Err(); err != nil {
+		return err
+	}
+
+	bw.WriteString("]}\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("export: flush: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Поля front-matter. Тегов у заметок пока нет.
+type frontMatter struct {
+	ID        int       `yaml:"id"`
+	Title     string    `yaml:"title"`
+	Format    string    `yaml:"format"`
+	CreatedAt time.Time `yaml:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+}
+
+func writeMarkdownZIP(w io.Writer, notes Notes) error {
+	zw := zip.NewWriter(w)
+	for notes.Next() {
+		n := notes.Note()
+		fm, err := yaml.Marshal(frontMatter{
+			ID:        n.Id,
+			Title:     n.Title,
+			Format:    n.Format,
+			CreatedAt: n.CreatedAt.UTC(),
+			UpdatedAt: n.UpdatedAt.UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("export: front-matter note=%d: %w", n.Id, err)
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     fileName(n, "md"),
+			Method:   zip.Deflate,
+			Modified: n.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("export: zip entry note=%d: %w", n.Id, err)
+		}
+		if _, err := fmt.Fprintf(f, "---\n%s---\n\n%s", fm, n.Content); err != nil {
+			return fmt.Errorf("export: write note=%d: %w", n.Id, err)
+		}
+	}
+	if err := notes.Err(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("export: close zip: %w", err)
+	}
+	return nil
+}
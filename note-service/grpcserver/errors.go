@@ -0,0 +1,83 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"myproject/handlers"
+	"myproject/internal/logger"
+	"myproject/problem"
+)
+
+// errorDomain — домен в ErrorInfo; reason совпадает с code в problem+json
+const errorDomain = "notes.v1"
+
+var httpToCode = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.FailedPrecondition,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// toStatus переводит ошибку по той же таблице, что и REST (handlers.ErrorTable):
+// код ошибки приходит в ErrorInfo.reason, ошибки полей — в BadRequest
+func toStatus(ctx context.Context, err error) error {
+	rid := requestID(ctx)
+	prefix := ""
+	if rid != "" {
+		prefix = "request_id=" + rid + " "
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, "request canceled")
+	}
+
+	p, ok := handlers.ErrorTable.Lookup(err)
+	if !ok {
+		logger.Errorf("%sinternal_error: %v", prefix, err)
+		p = problem.Internal()
+	} else {
+		logger.Errorf("%s%s: %v", prefix, p.Code, err)
+	}
+	return problemStatus(p, rid)
+}
+
+func problemStatus(p *problem.Problem, rid string) error {
+	code, ok := httpToCode[p.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+	st := status.New(code, p.Detail)
+
+	info := &errdetails.ErrorInfo{Reason: p.Code, Domain: errorDomain}
+	if rid != "" {
+		info.Metadata = map[string]string{"request_id": rid}
+	}
+	details := []protoadapt.MessageV1{info}
+	if len(p.Errors) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, f := range p.Errors {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Message,
+				Reason:      f.Code,
+			})
+		}
+		details = append(details, br)
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
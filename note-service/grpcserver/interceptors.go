@@ -0,0 +1,156 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"myproject/audit"
+	"myproject/auth"
+	"myproject/internal/logger"
+	"myproject/problem"
+)
+
+// Заголовок с request id — тот же, что и в REST
+const requestIDHeader = "x-request-id"
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	principalKey
+)
+
+// Какой scope нужен методу; методы без записи недоступны вовсе
+var methodScopes = map[string]string{
+	"/notes.v1.NoteService/GetNote":     auth.ScopeNotesRead,
+	"/notes.v1.NoteService/ListNotes":   auth.ScopeNotesRead,
+	"/notes.v1.NoteService/StreamNotes": auth.ScopeNotesRead,
+	"/notes.v1.NoteService/CreateNote":  auth.ScopeNotesWrite,
+	"/notes.v1.NoteService/UpdateNote":  auth.ScopeNotesWrite,
+	"/notes.v1.NoteService/DeleteNote":  auth.ScopeNotesWrite,
+}
+
+func requestID(ctx context.Context) string {
+	rid, _ := ctx.Value(requestIDKey).(string)
+	return rid
+}
+
+func principal(ctx context.Context) (auth.Principal, bool) {
+	p, ok := ctx.Value(principalKey).(auth.Principal)
+	return p, ok
+}
+
+func firstMD(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// prepare — общая часть unary и stream перехватчиков: request id, метаданные
+// для аудита, аутентификация и проверка scope
+func prepare(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	rid := firstMD(md, requestIDHeader)
+	if rid == "" {
+		rid = uuid.NewString()
+	}
+	ctx = context.WithValue(ctx, requestIDKey, rid)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, rid))
+
+	meta := audit.Meta{RequestID: rid, UserAgent: firstMD(md, "user-agent")}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		meta.IP = p.Addr.String()
+		if i := strings.LastIndex(meta.IP, ":"); i > 0 {
+			meta.IP = meta.IP[:i]
+		}
+	}
+	ctx = audit.WithMeta(ctx, meta)
+
+	header := firstMD(md, "authorization")
+	if header == "" {
+		return ctx, problemStatus(problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "missing authorization metadata"), rid)
+	}
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ctx, problemStatus(problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid authorization metadata"), rid)
+	}
+
+	p, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrIntrospection) {
+			logger.Errorf("request_id=%s token introspection: %v", rid, err)
+			return ctx, problemStatus(problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "token verification unavailable"), rid)
+		}
+		return ctx, problemStatus(problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid token"), rid)
+	}
+
+	scope, known := methodScopes[method]
+	if !known {
+		return ctx, status.Error(codes.Unimplemented, "unknown method")
+	}
+	if !p.HasScope(scope) {
+		return ctx, problemStatus(problem.New(http.StatusForbidden, "insufficient_scope", "insufficient scope: "+scope+" required"), rid)
+	}
+
+	return context.WithValue(ctx, principalKey, p), nil
+}
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	logger.Infof("request_id=%s grpc_method=%s code=%s duration=%v",
+		requestID(ctx), method, status.Code(err), time.Since(start))
+}
+
+// UnaryInterceptor — аналог RequestID + RequestLogger + AuthMiddleware для gRPC
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		ctx, err := prepare(ctx, info.FullMethod)
+		if err != nil {
+			logCall(ctx, info.FullMethod, start, err)
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// serverStream подменяет контекст потока на подготовленный
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+
+		ctx, err := prepare(ss.Context(), info.FullMethod)
+		if err != nil {
+			logCall(ctx, info.FullMethod, start, err)
+			return err
+		}
+
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, info.FullMethod, start, err)
+		return err
+	}
+}
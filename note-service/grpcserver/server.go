@@ -0,0 +1,237 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"myproject/dto"
+	"myproject/models"
+	"myproject/problem"
+	notesv1 "myproject/proto/notes/v1"
+	"myproject/service"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type noteServer struct {
+	notesv1.UnimplementedNoteServiceServer
+	s service.NoteService
+}
+
+// NewServer собирает gRPC-сервер с перехватчиками и зарегистрированным NoteService
+func NewServer(s service.NoteService) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryInterceptor()),
+		grpc.StreamInterceptor(StreamInterceptor()),
+	)
+	notesv1.RegisterNoteServiceServer(srv, &noteServer{s: s})
+	return srv
+}
+
+func toProto(n models.Note) *notesv1.Note {
+	note := &notesv1.Note{
+		Id:      int64(n.Id),
+		UserId:  int64(n.UserID),
+		Title:   n.Title,
+		Content: n.Content,
+		Format:  n.Format,
+	}
+	if n.DueAt != nil {
+		note.DueAt = timestamppb.New(*n.DueAt)
+	}
+	if n.RemindAt != nil {
+		note.RemindAt = timestamppb.New(*n.RemindAt)
+	}
+	return note
+}
+
+// nullableTime — срок из UpdateNoteRequest: не передан — не меняется,
+// пустая строка — null
+func nullableTime(v *string) dto.Nullable[string] {
+	if v == nil {
+		return dto.Nullable[string]{}
+	}
+	if *v == "" {
+		return dto.Nullable[string]{Set: true, Null: true}
+	}
+	return dto.Nullable[string]{Set: true, Value: *v}
+}
+
+// userID достаётся из контекста, который подготовил перехватчик
+func userID(ctx context.Context) (int, error) {
+	p, ok := principal(ctx)
+	if !ok || p.UserID <= 0 {
+		return 0, problemStatus(problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized"), requestID(ctx))
+	}
+	return p.UserID, nil
+}
+
+func noteID(ctx context.Context, id int64) (int, error) {
+	if id <= 0 || id > int64(^uint32(0)>>1) {
+		return 0, toStatus(ctx, service.ErrInvalidID)
+	}
+	return int(id), nil
+}
+
+func (g *noteServer) GetNote(ctx context.Context, req *notesv1.GetNoteRequest) (*notesv1.Note, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := noteID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := g.s.GetNote(ctx, uid, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return toProto(note), nil
+}
+
+// Токен страницы — id последней отданной заметки; список отсортирован по id
+func encodePageToken(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(lastID)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("decode page token: %w", err)
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("decode page token: bad id %q", raw)
+	}
+	return id, nil
+}
+
+func (g *noteServer) ListNotes(ctx context.Context, req *notesv1.ListNotesRequest) (*notesv1.ListNotesResponse, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(req.GetPageSize())
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if size < 0 || size > maxPageSize {
+		p := problem.Invalid("page_size", "out_of_range", fmt.Sprintf("page_size must be between 1 and %d", maxPageSize))
+		return nil, problemStatus(p, requestID(ctx))
+	}
+	after, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, problemStatus(problem.Invalid("page_token", "invalid", "invalid page_token"), requestID(ctx))
+	}
+
+	// полный список берётся из кэша, поэтому страницы режем в памяти
+	notes, err := g.s.GetAllNotes(ctx, uid)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	start := sort.Search(len(notes), func(i int) bool { return notes[i].Id > after })
+
+	resp := &notesv1.ListNotesResponse{}
+	end := min(start+size, len(notes))
+	for _, n := range notes[start:end] {
+		resp.Notes = append(resp.Notes, toProto(n))
+	}
+	if end < len(notes) {
+		resp.NextPageToken = encodePageToken(notes[end-1].Id)
+	}
+	return resp, nil
+}
+
+func (g *noteServer) StreamNotes(_ *notesv1.StreamNotesRequest, stream grpc.ServerStreamingServer[notesv1.Note]) error {
+	ctx := stream.Context()
+	uid, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+
+	notes, err := g.s.GetAllNotes(ctx, uid)
+	if err != nil {
+		return toStatus(ctx, err)
+	}
+	for _, n := range notes {
+		if err := stream.Send(toProto(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *noteServer) CreateNote(ctx context.Context, req *notesv1.CreateNoteRequest) (*notesv1.Note, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := g.s.CreateNote(ctx, uid, dto.NoteRequest{
+		Title: req.GetTitle(), Content: req.GetContent(), Format: req.GetFormat(),
+		DueAt: req.DueAt, RemindAt: req.RemindAt,
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	// сроки в ответе — уже переведённые из местного времени
+	note, err := g.s.GetNote(ctx, uid, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return toProto(note), nil
+}
+
+func (g *noteServer) UpdateNote(ctx context.Context, req *notesv1.UpdateNoteRequest) (*notesv1.Note, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := noteID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if req.Title == nil && req.Content == nil && req.Format == nil && req.DueAt == nil && req.RemindAt == nil {
+		return nil, toStatus(ctx, service.ErrNothingToUpdate)
+	}
+
+	updated, err := g.s.UpdateNote(ctx, uid, id, dto.NoteUpdateRequest{
+		Title: req.Title, Content: req.Content, Format: req.Format,
+		DueAt: nullableTime(req.DueAt), RemindAt: nullableTime(req.RemindAt),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return toProto(updated), nil
+}
+
+func (g *noteServer) DeleteNote(ctx context.Context, req *notesv1.DeleteNoteRequest) (*notesv1.DeleteNoteResponse, error) {
+	uid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := noteID(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.s.DeleteNote(ctx, uid, id); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &notesv1.DeleteNoteResponse{}, nil
+}
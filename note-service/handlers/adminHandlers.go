@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/cache"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// Сколько заметок у произвольного пользователя — для обращений в поддержку
+func GetUserNoteCount(s service.NoteService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil || userID <= 0 {
+			problem.Write(ctx, problem.Invalid("id", "invalid", "invalid user id in path"))
+			return
+		}
+
+		n, err := s.CountNotes(ctx.Request.Context(), userID)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"user_id": userID, "notes_count": n})
+	}
+}
+
+// Попадания по уровням кэша (локальный LRU и Redis) этой реплики
+func GetCacheStats(c *cache.NotesCache) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, c.Stats())
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/internal/logger"
+	"myproject/midleware"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// запас на заголовки частей multipart сверх самого файла
+const multipartOverhead = 1 << 20
+
+// POST /notes/:id/attachments — файл в поле file (multipart)
+func UploadAttachment(s service.AttachmentService, maxBytes int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, noteID, ok := noteParams(ctx)
+		if !ok {
+			return
+		}
+
+		tooLarge := problem.New(http.StatusRequestEntityTooLarge, "payload_too_large",
+			fmt.Sprintf("file must be at most %d bytes", maxBytes))
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBytes+multipartOverhead)
+		fh, err := ctx.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				problem.Write(ctx, tooLarge)
+				return
+			}
+			problem.Write(ctx, problem.Invalid("file", "required", "file is required"))
+			return
+		}
+		if fh.Size > maxBytes {
+			problem.Write(ctx, tooLarge)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			respondWithError(ctx, fmt.Errorf("handlers: open upload: %w", err))
+			return
+		}
+		defer f.Close()
+
+		a, err := s.Upload(ctx.Request.Context(), userID, noteID, fh.Filename, fh.Size, f)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Header("Location", fmt.Sprintf("/notes/%d/attachments/%d", noteID, a.ID))
+		ctx.JSON(http.StatusCreated, a)
+	}
+}
+
+// GET /notes/:id/attachments
+func ListAttachments(s service.AttachmentService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, noteID, ok := noteParams(ctx)
+		if !ok {
+			return
+		}
+
+		list, err := s.ListAttachments(ctx.Request.Context(), userID, noteID)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, list)
+	}
+}
+
+// GET /notes/:id/attachments/:aid — метаданные и свежие ссылки
+func GetAttachment(s service.AttachmentService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, noteID, id, ok := attachmentParams(ctx)
+		if !ok {
+			return
+		}
+
+		a, err := s.GetAttachment(ctx.Request.Context(), userID, noteID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, a)
+	}
+}
+
+func DeleteAttachment(s service.AttachmentService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, noteID, id, ok := attachmentParams(ctx)
+		if !ok {
+			return
+		}
+
+		if err := s.DeleteAttachment(ctx.Request.Context(), userID, noteID, id); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// GET /users/me/storage — занятое место и квота
+func GetStorageUsage(s service.AttachmentService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		usage, err := s.StorageUsage(ctx.Request.Context(), userID)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, usage)
+	}
+}
+
+// GET /attachments/:id/{content,thumbnail}?expires=&sig= — скачивание по
+// подписанной ссылке, без токена: ссылку можно вставить в <img>
+func DownloadAttachment(s service.AttachmentService, variant string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil || id <= 0 {
+			problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+			return
+		}
+		expires, err := strconv.ParseInt(ctx.Query("expires"), 10, 64)
+		if err != nil {
+			problem.Write(ctx, problem.Invalid("expires", "invalid", "expires must be a unix timestamp"))
+			return
+		}
+
+		d, err := s.Download(ctx.Request.Context(), id, variant, expires, ctx.Query("sig"))
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		defer d.Body.Close()
+
+		// тип определён по содержимому; браузер не должен угадывать свой,
+		// а не-картинки — открывать в контексте нашего домена
+		disposition := "attachment"
+		if strings.HasPrefix(d.ContentType, "image/") {
+			disposition = "inline"
+		}
+		h := ctx.Writer.Header()
+		h.Set("Content-Type", d.ContentType)
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": d.FileName}))
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		if ttl := time.Until(time.Unix(expires, 0)); ttl > 0 {
+			h.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+		}
+		if d.Size >= 0 {
+			h.Set("Content-Length", strconv.FormatInt(d.Size, 10))
+		}
+		ctx.Status(http.StatusOK)
+		if _, err := io.Copy(ctx.Writer, d.Body); err != nil {
+			// заголовки уже ушли — остаётся только записать в лог
+			logger.Errorf("request_id=%s download attachment=%d: %v", getRequestID(ctx), id, err)
+		}
+	}
+}
+
+func noteParams(ctx *gin.Context) (int, int, bool) {
+	userID, ok := midleware.GetUserID(ctx)
+	if !ok || userID <= 0 {
+		respondUnauthorized(ctx)
+		return 0, 0, false
+	}
+	noteID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+		return 0, 0, false
+	}
+	return userID, noteID, true
+}
+
+func attachmentParams(ctx *gin.Context) (int, int, int64, bool) {
+	userID, noteID, ok := noteParams(ctx)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	id, err := strconv.ParseInt(ctx.Param("aid"), 10, 64)
+	if err != nil || id <= 0 {
+		problem.Write(ctx, problem.Invalid("aid", "invalid", ErrBadPathID.Error()))
+		return 0, 0, 0, false
+	}
+	return userID, noteID, id, true
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/audit"
+	"myproject/midleware"
+	"myproject/models"
+	"myproject/problem"
+	"myproject/repository"
+)
+
+const maxAuditPageSize = 200
+
+// limit/offset из query; по умолчанию 50 записей
+func auditPage(ctx *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		problem.Write(ctx, problem.Invalid("limit", "out_of_range", "limit must be between 1 and 200"))
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		problem.Write(ctx, problem.Invalid("offset", "invalid", "invalid offset"))
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+func respondAudit(ctx *gin.Context, r *audit.Recorder, f repository.AuditFilter) {
+	entries, err := r.List(ctx.Request.Context(), f)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// GET /users/me/audit — действия с собственными заметками
+func GetMyAudit(r *audit.Recorder) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+		limit, offset, ok := auditPage(ctx)
+		if !ok {
+			return
+		}
+
+		respondAudit(ctx, r, repository.AuditFilter{
+			UserID: userID,
+			Action: ctx.Query("action"),
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+}
+
+// GET /admin/audit?user_id=&action= — весь журнал для администраторов
+func GetAudit(r *audit.Recorder) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, offset, ok := auditPage(ctx)
+		if !ok {
+			return
+		}
+
+		userID := 0
+		if v := ctx.Query("user_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				problem.Write(ctx, problem.Invalid("user_id", "invalid", "invalid user_id"))
+				return
+			}
+			userID = id
+		}
+
+		respondAudit(ctx, r, repository.AuditFilter{
+			UserID: userID,
+			Action: ctx.Query("action"),
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+}
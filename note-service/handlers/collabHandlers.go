@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"myproject/auth"
+	"myproject/collab"
+	"myproject/internal/logger"
+	"myproject/midleware"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// удаление всего текста — список ID каждого символа (надгробия в документе
+// не копятся, см. session.compact)
+const collabReadLimit = 1 << 20
+
+// GET /notes/:id/collab — совместное редактирование заметки через
+// WebSocket. Клиент шлёт операции и курсор (collab.ClientMessage), сервер —
+// collab.Message: сначала init с документом, затем принятые операции,
+// курсоры участников и ошибки отклонённых операций.
+func CollabWebSocket(h *collab.Hub) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil || id <= 0 {
+			respondWithError(ctx, service.ErrInvalidID)
+			return
+		}
+
+		// подключаемся до апгрейда: ошибку ещё можно вернуть обычным ответом
+		conn, err := h.Join(ctx.Request.Context(), userID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		defer conn.Close()
+
+		ws, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		// писать в соединение может только одна горутина: ответы читателя
+		// идут через replies
+		replies := make(chan collab.Message, 16)
+		closed := make(chan struct{})
+		ws.SetReadLimit(collabReadLimit)
+		ws.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		})
+		go func() {
+			defer close(closed)
+			for {
+				_, data, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				if err := collabRequest(ctx, conn, data); err != nil {
+					select {
+					case replies <- collab.Message{Type: collab.MsgError, Error: collabProblem(ctx, err)}:
+					default:
+					}
+				}
+			}
+		}()
+
+		expired, stop := tokenExpiry(ctx)
+		defer stop()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		var last string
+		for {
+			var msg collab.Message
+			select {
+			case <-closed:
+				return
+			case m, ok := <-conn.Messages():
+				if !ok {
+					code, reason := websocket.CloseTryAgainLater, "reconnect"
+					if last == collab.MsgClosed {
+						code, reason = websocket.CloseNormalClosure, "note deleted"
+					}
+					ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+					return
+				}
+				msg = m
+			case m := <-replies:
+				msg = m
+			case <-expired:
+				closeUnauthorized(ws)
+				return
+			case <-heartbeat.C:
+				if err := midleware.Revalidate(ctx, auth.ScopeNotesWrite); err != nil {
+					closeUnauthorized(ws)
+					return
+				}
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+				continue
+			}
+			last = msg.Type
+			ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := ws.WriteJSON(msg); err != nil {
+				logger.Infof("collab ws user=%d note=%d: %v", userID, id, err)
+				return
+			}
+		}
+	}
+}
+
+func collabRequest(ctx *gin.Context, conn *collab.Conn, data []byte) error {
+	var req collab.ClientMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		return collab.ErrBadOp
+	}
+	if req.Seq > 0 {
+		conn.Ack(req.Seq)
+	}
+	switch {
+	case req.Type == collab.MsgAck && req.Seq > 0:
+		return nil
+	case req.Type == collab.MsgOp && req.Op != nil:
+		return conn.Submit(*req.Op)
+	case req.Type == collab.MsgPresence && req.Cursor != nil:
+		return conn.Move(ctx.Request.Context(), *req.Cursor)
+	}
+	return collab.ErrBadOp
+}
+
+func collabProblem(ctx *gin.Context, err error) *problem.Problem {
+	p, ok := ErrorTable.Lookup(err)
+	if !ok {
+		logger.Errorf("request_id=%s internal_error: %v", getRequestID(ctx), err)
+		p = problem.Internal()
+	}
+	return p
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/collab"
+	"myproject/export"
+	"myproject/importer"
+	"myproject/internal/logger"
+	"myproject/jobs"
+	"myproject/midleware"
+	"myproject/notify"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// ErrorTable — соответствие ошибок сервиса ответам API. Его же использует
+// gRPC-сервер, чтобы коды ошибок в обоих API совпадали.
+var ErrorTable = problem.Table{
+	{Err: service.ErrInvalidID, Status: http.StatusBadRequest, Code: "invalid", Field: "id"},
+	{Err: service.ErrInvalidUserID, Status: http.StatusBadRequest, Code: "invalid", Field: "user_id"},
+	{Err: service.ErrNoteNotFound, Status: http.StatusNotFound, Code: "note_not_found"},
+	{Err: service.ErrNothingToUpdate, Status: http.StatusBadRequest, Code: "nothing_to_update"},
+	{Err: service.ErrUnknownBatchOp, Status: http.StatusBadRequest, Code: "invalid", Field: "op"},
+	{Err: service.ErrBatchAborted, Status: http.StatusFailedDependency, Code: "batch_aborted"},
+	{Err: export.ErrUnknownFormat, Status: http.StatusBadRequest, Code: "invalid", Field: "format"},
+	{Err: service.ErrImportNotFound, Status: http.StatusNotFound, Code: "import_not_found"},
+	{Err: service.ErrImportFormat, Status: http.StatusBadRequest, Code: "invalid", Field: "format"},
+	{Err: importer.ErrUnknownFormat, Status: http.StatusBadRequest, Code: "unsupported_format", Field: "file"},
+	{Err: importer.ErrTooManyFiles, Status: http.StatusBadRequest, Code: "too_many", Field: "file"},
+	{Err: jobs.ErrNotFound, Status: http.StatusNotFound, Code: "job_not_found"},
+	{Err: jobs.ErrFinished, Status: http.StatusConflict, Code: "job_finished"},
+	{Err: service.ErrAttachmentNotFound, Status: http.StatusNotFound, Code: "attachment_not_found"},
+	{Err: service.ErrAttachmentEmpty, Status: http.StatusBadRequest, Code: "invalid", Field: "file"},
+	{Err: service.ErrQuotaExceeded, Status: http.StatusRequestEntityTooLarge, Code: "quota_exceeded"},
+	{Err: service.ErrInvalidSignature, Status: http.StatusForbidden, Code: "invalid_signature"},
+	{Err: service.ErrLinkExpired, Status: http.StatusForbidden, Code: "link_expired"},
+	{Err: service.ErrSyncToken, Status: http.StatusBadRequest, Code: "invalid", Field: "since"},
+	{Err: service.ErrSyncTokenExpired, Status: http.StatusGone, Code: "sync_token_expired"},
+	{Err: service.ErrSyncConflict, Status: http.StatusConflict, Code: "conflict"},
+	{Err: service.ErrBaseVersion, Status: http.StatusBadRequest, Code: "required", Field: "base_version"},
+	{Err: service.ErrTemplateNotFound, Status: http.StatusNotFound, Code: "template_not_found"},
+	{Err: service.ErrTemplateExists, Status: http.StatusConflict, Code: "template_exists"},
+	{Err: service.ErrTemplateReadOnly, Status: http.StatusForbidden, Code: problem.CodeForbidden},
+	{Err: collab.ErrBadOp, Status: http.StatusBadRequest, Code: "invalid_op"},
+	{Err: collab.ErrTooLong, Status: http.StatusBadRequest, Code: "too_long", Field: "content"},
+	{Err: collab.ErrUnavailable, Status: http.StatusServiceUnavailable, Code: problem.CodeUnavailable},
+	{Err: notify.ErrUnavailable, Status: http.StatusServiceUnavailable, Code: problem.CodeUnavailable},
+}
+
+func getRequestID(ctx *gin.Context) string {
+	if v, ok := ctx.Get(midleware.RequestIDKey); ok {
+		rid := v.(string)
+		return rid
+	}
+	return ""
+}
+
+func respondWithError(c *gin.Context, err error) {
+	rid := getRequestID(c)
+	prefix := ""
+	if rid != "" {
+		prefix = "request_id=" + rid + " "
+	}
+
+	if p, ok := ErrorTable.Lookup(err); ok {
+		logger.Errorf("%s%s: %v", prefix, p.Code, err)
+		problem.Write(c, p)
+		return
+	}
+
+	logger.Errorf("%sinternal_error: %v", prefix, err)
+	problem.Write(c, problem.Internal())
+}
+
+func respondUnauthorized(c *gin.Context) {
+	problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized"))
+}
+
+func respondInvalidJSON(c *gin.Context, err error) {
+	problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidJSON, "invalid JSON: "+err.Error()))
+}
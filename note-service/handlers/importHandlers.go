@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/midleware"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// StartImport принимает файл (multipart, поле file) и сразу отвечает 202:
+// сам импорт идёт в фоне, его состояние — по ссылке из Location
+func StartImport(s service.ImportService, maxBytes int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBytes)
+		fh, err := ctx.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Write(ctx, problem.New(http.StatusRequestEntityTooLarge, "payload_too_large",
+					fmt.Sprintf("file must be at most %d bytes", maxBytes)))
+				return
+			}
+			problem.Write(ctx, problem.Invalid("file", "required", "file is required"))
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			respondWithError(ctx, fmt.Errorf("handlers: open upload: %w", err))
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			respondWithError(ctx, fmt.Errorf("handlers: read upload: %w", err))
+			return
+		}
+
+		imp, err := s.StartImport(ctx.Request.Context(), userID, ctx.PostForm("format"), data)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Header("Location", fmt.Sprintf("/imports/%d", imp.ID))
+		ctx.JSON(http.StatusAccepted, imp)
+	}
+}
+
+func GetImport(s service.ImportService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+			return
+		}
+
+		imp, err := s.GetImport(ctx.Request.Context(), userID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, imp)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/jobs"
+	"myproject/midleware"
+	"myproject/problem"
+)
+
+// GET /jobs — фоновые задачи пользователя, новые сначала
+func ListJobs(q *jobs.Queue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+		limit, offset, ok := auditPage(ctx)
+		if !ok {
+			return
+		}
+
+		list, err := q.List(ctx.Request.Context(), userID, limit, offset)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, list)
+	}
+}
+
+// GET /jobs/:id — состояние и прогресс задачи
+func GetJob(q *jobs.Queue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, id, ok := jobParams(ctx)
+		if !ok {
+			return
+		}
+
+		job, err := q.Get(ctx.Request.Context(), userID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, job)
+	}
+}
+
+// POST /jobs/:id/cancel — 202: задачу снимет воркер, итог — в GET /jobs/:id
+func CancelJob(q *jobs.Queue) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, id, ok := jobParams(ctx)
+		if !ok {
+			return
+		}
+
+		job, err := q.Cancel(ctx.Request.Context(), userID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusAccepted, job)
+	}
+}
+
+func jobParams(ctx *gin.Context) (int, int64, bool) {
+	userID, ok := midleware.GetUserID(ctx)
+	if !ok || userID <= 0 {
+		respondUnauthorized(ctx)
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+		return 0, 0, false
+	}
+	return userID, id, true
+}
@@ -4,11 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"myproject/dto"
+	"myproject/export"
+	"myproject/internal/logger"
 	"myproject/midleware"
 	"myproject/models"
+	"myproject/problem"
+	"myproject/repository"
 	"myproject/service"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,22 +25,30 @@ func GetNote(s service.NoteService) gin.HandlerFunc {
 		// достаём userID из JWT
 		userID, ok := midleware.GetUserID(ctx)
 		if !ok || userID <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error":      "unauthorized",
-				"request-id": rid,
-			})
+			respondUnauthorized(ctx)
 			return
 		}
 
 		idStr := ctx.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":      service.ErrInvalidID.Error(),
-				"request_id": rid,
-			})
+			problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+			return
+		}
+
+		// ответ зависит от Accept — прокси не должны отдавать HTML вместо JSON
+		ctx.Header("Vary", "Accept")
+		html, ok := wantsHTML(ctx)
+		if !ok {
+			return
+		}
+		if html {
+			body, err := s.RenderNote(ctx.Request.Context(), userID, id)
+			if err != nil {
+				respondWithError(ctx, err)
+				return
+			}
+			ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(body))
 			return
 		}
 
@@ -49,19 +62,35 @@ func GetNote(s service.NoteService) gin.HandlerFunc {
 	}
 }
 
+// wantsHTML: ?render=html или Accept, где text/html предпочтительнее JSON
+func wantsHTML(ctx *gin.Context) (html, ok bool) {
+	switch ctx.Query("render") {
+	case "html":
+		return true, true
+	case "":
+	default:
+		problem.Write(ctx, problem.Invalid("render", "invalid", "render must be html"))
+		return false, false
+	}
+	return ctx.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML, true
+}
+
+// GET /notes; ?due_before= — только заметки со сроком раньше, ближайшие сначала
 func GetAllNotes(s service.NoteService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, ok := midleware.GetUserID(ctx)
 		if !ok || userID <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error":      "unauthorized",
-				"request-id": rid,
-			})
+			respondUnauthorized(ctx)
 			return
 		}
 
-		notes, err := s.GetAllNotes(ctx.Request.Context(), userID)
+		var notes []models.Note
+		var err error
+		if before, ok := ctx.GetQuery("due_before"); ok {
+			notes, err = s.GetNotesDueBefore(ctx.Request.Context(), userID, before)
+		} else {
+			notes, err = s.GetAllNotes(ctx.Request.Context(), userID)
+		}
 		if err != nil {
 			respondWithError(ctx, err)
 			return
@@ -73,29 +102,37 @@ func GetAllNotes(s service.NoteService) gin.HandlerFunc {
 	}
 }
 
-func CreateNote(s service.NoteService) gin.HandlerFunc {
+// POST /notes; с ?template=id — заметка из шаблона, тело — NoteFromTemplateRequest
+func CreateNote(s service.NoteService, t service.TemplateService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, ok := midleware.GetUserID(ctx)
 		if !ok || userID <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error":      "unauthorized",
-				"request-id": rid,
-			})
+			respondUnauthorized(ctx)
 			return
 		}
 
-		var req dto.NoteRequest
-		if err := ctx.ShouldBindJSON(&req); err != nil {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":      "invalid JSON",
-				"request-id": rid,
-			})
-			return
+		var id int
+		var err error
+		if tid := ctx.Query("template"); tid != "" {
+			templateID, perr := strconv.ParseInt(tid, 10, 64)
+			if perr != nil || templateID <= 0 {
+				problem.Write(ctx, problem.Invalid("template", "invalid", "template must be a template id"))
+				return
+			}
+			var req dto.NoteFromTemplateRequest
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				respondInvalidJSON(ctx, err)
+				return
+			}
+			id, err = t.CreateNoteFromTemplate(ctx.Request.Context(), userID, templateID, req)
+		} else {
+			var req dto.NoteRequest
+			if err := ctx.ShouldBindJSON(&req); err != nil {
+				respondInvalidJSON(ctx, err)
+				return
+			}
+			id, err = s.CreateNote(ctx.Request.Context(), userID, req)
 		}
-
-		id, err := s.CreateNote(ctx.Request.Context(), userID, req.Title, req.Content)
 		if err != nil {
 			respondWithError(ctx, err)
 			return
@@ -109,22 +146,14 @@ func DeleteNote(s service.NoteService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, ok := midleware.GetUserID(ctx)
 		if !ok || userID <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error":      "unauthorized",
-				"request-id": rid,
-			})
+			respondUnauthorized(ctx)
 			return
 		}
 
 		idStr := ctx.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":      ErrBadPathID.Error(),
-				"request-id": rid,
-			})
+			problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
 			return
 		}
 
@@ -140,32 +169,20 @@ func UpdateNote(s service.NoteService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userID, ok := midleware.GetUserID(ctx)
 		if !ok || userID <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error":      "unauthorized",
-				"request-id": rid,
-			})
+			respondUnauthorized(ctx)
 			return
 		}
 
 		idStr := ctx.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil || id <= 0 {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":      ErrBadPathID.Error(),
-				"request-id": rid,
-			})
+			problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
 			return
 		}
 
 		var req dto.NoteUpdateRequest
 		if err := ctx.ShouldBindJSON(&req); err != nil {
-			rid := getRequestID(ctx)
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":      "invalid JSON",
-				"request-id": rid,
-			})
+			respondInvalidJSON(ctx, err)
 			return
 		}
 
@@ -176,9 +193,108 @@ func UpdateNote(s service.NoteService) gin.HandlerFunc {
 		}
 
 		ctx.JSON(http.StatusOK, dto.NoteResponse{
-			ID:      note.Id,
-			Title:   note.Title,
-			Content: note.Content,
+			ID:       note.Id,
+			Title:    note.Title,
+			Content:  note.Content,
+			Format:   note.Format,
+			DueAt:    note.DueAt,
+			RemindAt: note.RemindAt,
 		})
 	}
 }
+
+func BatchNotes(s service.NoteService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		var req dto.BatchRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondInvalidJSON(ctx, err)
+			return
+		}
+
+		results, committed, err := s.BatchNotes(ctx.Request.Context(), userID, req)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+
+		resp := dto.BatchResponse{
+			Mode:      req.Mode,
+			Committed: committed,
+			Results:   make([]dto.BatchItemResult, 0, len(results)),
+		}
+		if resp.Mode == "" {
+			resp.Mode = dto.BatchAtomic
+		}
+		for i, res := range results {
+			resp.Results = append(resp.Results, batchItemResult(ctx, i, res))
+		}
+		// статусы операций — в теле; сам пакет обработан в любом случае
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func batchItemResult(ctx *gin.Context, i int, res service.BatchResult) dto.BatchItemResult {
+	item := dto.BatchItemResult{Index: i, Op: res.Op}
+	if res.Err != nil {
+		p, ok := ErrorTable.Lookup(res.Err)
+		if !ok {
+			logger.Errorf("request_id=%s internal_error: %v", getRequestID(ctx), res.Err)
+			p = problem.Internal()
+		}
+		item.Status = p.Status
+		item.Error = p
+		return item
+	}
+
+	item.ID = res.Note.Id
+	switch res.Op {
+	case repository.BatchCreate:
+		item.Status = http.StatusCreated
+	case repository.BatchUpdate:
+		item.Status = http.StatusOK
+	case repository.BatchDelete:
+		item.Status = http.StatusNoContent
+		return item
+	}
+	item.Note = &dto.NoteResponse{ID: res.Note.Id, Title: res.Note.Title, Content: res.Note.Content, Format: res.Note.Format,
+		DueAt: res.Note.DueAt, RemindAt: res.Note.RemindAt}
+	return item
+}
+
+func ExportNotes(s service.NoteService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		format := ctx.DefaultQuery("format", export.FormatZIP)
+		if !export.Valid(format) {
+			respondWithError(ctx, export.ErrUnknownFormat)
+			return
+		}
+
+		ctx.Header("Content-Type", export.ContentType(format))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(format, time.Now())))
+
+		err := s.ExportNotes(ctx.Request.Context(), userID, format, ctx.Writer)
+		if err == nil {
+			return
+		}
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Disposition")
+			respondWithError(ctx, err)
+			return
+		}
+		// заголовки уже ушли: клиент получит оборванный файл
+		logger.Errorf("request_id=%s export aborted: %v", getRequestID(ctx), err)
+		ctx.Abort()
+	}
+}
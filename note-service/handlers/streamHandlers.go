@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"myproject/auth"
+	"myproject/internal/logger"
+	"myproject/midleware"
+	"myproject/notify"
+)
+
+const (
+	// комментарий или ping раз в streamHeartbeat: прокси не закрывают
+	// молчащее соединение, а мы узнаём об ушедшем клиенте
+	streamHeartbeat = 25 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+	// код закрытия WebSocket, когда токен истёк или отозван (4000–4999 —
+	// коды приложения)
+	wsCloseUnauthorized = 4401
+)
+
+var upgrader = websocket.Upgrader{
+	// токен передаётся явно (заголовок или access_token), а не cookie —
+	// чужая страница им не воспользуется, поэтому Origin не проверяем
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// GET /notes/stream — изменения заметок пользователя как Server-Sent Events.
+// EventSource сам присылает Last-Event-ID при переподключении.
+func StreamNotes(b *notify.Broker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		sub, err := b.Subscribe(ctx.Request.Context(), userID, lastEventID(ctx))
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		defer sub.Close()
+
+		h := ctx.Writer.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		// nginx иначе копит ответ в буфере
+		h.Set("X-Accel-Buffering", "no")
+		ctx.Status(http.StatusOK)
+		io.WriteString(ctx.Writer, "retry: 3000\n\n")
+		ctx.Writer.Flush()
+
+		expired, stop := tokenExpiry(ctx)
+		defer stop()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Request.Context().Done():
+				return
+			case ev, ok := <-sub.Events():
+				if !ok {
+					// клиент переподключится и дочитает по Last-Event-ID
+					return
+				}
+				if err := writeSSE(ctx.Writer, ev); err != nil {
+					return
+				}
+			case <-expired:
+				endSSE(ctx)
+				return
+			case <-heartbeat.C:
+				if err := midleware.Revalidate(ctx, auth.ScopeNotesRead); err != nil {
+					endSSE(ctx)
+					return
+				}
+				if _, err := io.WriteString(ctx.Writer, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+// endSSE — последнее событие потока, после которого сервер его закрывает.
+// EventSource переподключился бы со старым токеном, поэтому клиент должен
+// закрыть его сам и открыть новый с другим токеном.
+func endSSE(ctx *gin.Context) {
+	writeSSE(ctx.Writer, notify.Event{Type: notify.Unauthorized, At: time.Now().UTC()})
+	ctx.Writer.Flush()
+}
+
+func writeSSE(w io.Writer, ev notify.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if ev.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
+
+// GET /notes/ws — те же события через WebSocket, по одному JSON в
+// текстовом кадре. Сообщения клиента не нужны и отбрасываются.
+func NotesWebSocket(b *notify.Broker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		// подписываемся до апгрейда: ошибку ещё можно вернуть обычным ответом
+		sub, err := b.Subscribe(ctx.Request.Context(), userID, lastEventID(ctx))
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		defer sub.Close()
+
+		conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			// ответ с ошибкой уже отправил upgrader
+			return
+		}
+		defer conn.Close()
+
+		// чтение нужно, чтобы обрабатывать pong и close от клиента
+		closed := make(chan struct{})
+		conn.SetReadLimit(4096)
+		conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		expired, stop := tokenExpiry(ctx)
+		defer stop()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case ev, ok := <-sub.Events():
+				if !ok {
+					msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "resubscribe with last_event_id")
+					conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if err := conn.WriteJSON(ev); err != nil {
+					logger.Infof("ws user=%d: %v", userID, err)
+					return
+				}
+			case <-expired:
+				closeUnauthorized(conn)
+				return
+			case <-heartbeat.C:
+				if err := midleware.Revalidate(ctx, auth.ScopeNotesRead); err != nil {
+					closeUnauthorized(conn)
+					return
+				}
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// tokenExpiry срабатывает в момент истечения токена соединения; у токена
+// без срока — никогда. Отзыв токена ловит Revalidate на каждом heartbeat.
+func tokenExpiry(ctx *gin.Context) (<-chan time.Time, func() bool) {
+	exp := midleware.TokenExpiry(ctx)
+	if exp.IsZero() {
+		return nil, func() bool { return false }
+	}
+	t := time.NewTimer(time.Until(exp))
+	return t.C, t.Stop
+}
+
+func closeUnauthorized(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(wsCloseUnauthorized, "token expired or revoked")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+}
+
+// Last-Event-ID из заголовка; WebSocket из браузера заголовки слать не
+// умеет — для него параметр last_event_id
+func lastEventID(ctx *gin.Context) string {
+	if id := ctx.GetHeader("Last-Event-ID"); id != "" {
+		return id
+	}
+	return ctx.Query("last_event_id")
+}
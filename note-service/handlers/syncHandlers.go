@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/dto"
+	"myproject/internal/logger"
+	"myproject/midleware"
+	"myproject/problem"
+	"myproject/repository"
+	"myproject/service"
+)
+
+// GET /sync?since=<token>&limit=N
+func GetSyncChanges(s service.SyncService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(service.SyncPageDefault)))
+		if err != nil || limit < 1 || limit > service.SyncPageMax {
+			problem.Write(ctx, problem.Invalid("limit", "out_of_range", fmt.Sprintf("limit must be between 1 and %d", service.SyncPageMax)))
+			return
+		}
+
+		page, err := s.Changes(ctx.Request.Context(), userID, ctx.Query("since"), limit)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, dto.SyncResponse{
+			Notes:   page.Notes,
+			Deleted: page.Deleted,
+			Next:    page.Next,
+			HasMore: page.More,
+		})
+	}
+}
+
+// POST /sync
+func PushSyncChanges(s service.SyncService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		var req dto.SyncRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondInvalidJSON(ctx, err)
+			return
+		}
+
+		results, err := s.Push(ctx.Request.Context(), userID, req)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+
+		resp := dto.SyncPushResponse{Results: make([]dto.SyncItemResult, 0, len(results))}
+		for i, res := range results {
+			resp.Results = append(resp.Results, syncItemResult(ctx, i, res))
+		}
+		// статусы изменений — в теле, как у POST /notes/batch
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+func syncItemResult(ctx *gin.Context, i int, res service.SyncResult) dto.SyncItemResult {
+	item := dto.SyncItemResult{Index: i, Op: res.Op, ClientID: res.ClientID, Deleted: res.Deleted}
+	if res.Note != nil {
+		item.ID = res.Note.Id
+	} else if res.Deleted != nil {
+		item.ID = res.Deleted.ID
+	}
+
+	if res.Err != nil {
+		p, ok := ErrorTable.Lookup(res.Err)
+		if !ok {
+			logger.Errorf("request_id=%s internal_error: %v", getRequestID(ctx), res.Err)
+			p = problem.Internal()
+		}
+		item.Status = p.Status
+		item.Error = p
+		if errors.Is(res.Err, service.ErrSyncConflict) {
+			item.Server = res.Note
+		}
+		return item
+	}
+
+	item.Note = res.Note
+	switch {
+	case res.Duplicate:
+		item.Status = http.StatusOK
+	case res.Op == repository.BatchCreate:
+		item.Status = http.StatusCreated
+	case res.Op == repository.BatchUpdate:
+		item.Status = http.StatusOK
+	case res.Op == repository.BatchDelete:
+		item.Status = http.StatusNoContent
+	}
+	return item
+}
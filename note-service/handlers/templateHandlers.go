@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/auth"
+	"myproject/dto"
+	"myproject/midleware"
+	"myproject/problem"
+	"myproject/service"
+)
+
+// GET /templates?locale= — свои и системные шаблоны
+func ListTemplates(s service.TemplateService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		list, err := s.ListTemplates(ctx.Request.Context(), userID, ctx.Query("locale"))
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, list)
+	}
+}
+
+func GetTemplate(s service.TemplateService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, id, ok := templateParams(ctx)
+		if !ok {
+			return
+		}
+
+		t, err := s.GetTemplate(ctx.Request.Context(), userID, id)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, t)
+	}
+}
+
+// POST /templates — шаблон пользователя; POST /admin/templates — системный
+func CreateTemplate(s service.TemplateService, system bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		var req dto.TemplateRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondInvalidJSON(ctx, err)
+			return
+		}
+
+		t, err := s.CreateTemplate(ctx.Request.Context(), userID, system, req)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Header("Location", fmt.Sprintf("/templates/%d", t.ID))
+		ctx.JSON(http.StatusCreated, t)
+	}
+}
+
+// PATCH /templates/:id — системные шаблоны меняет только admin
+func UpdateTemplate(s service.TemplateService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, id, ok := templateParams(ctx)
+		if !ok {
+			return
+		}
+
+		var req dto.TemplateUpdateRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondInvalidJSON(ctx, err)
+			return
+		}
+
+		admin := midleware.GetRole(ctx) == auth.RoleAdmin
+		t, err := s.UpdateTemplate(ctx.Request.Context(), userID, admin, id, req)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, t)
+	}
+}
+
+func DeleteTemplate(s service.TemplateService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, id, ok := templateParams(ctx)
+		if !ok {
+			return
+		}
+
+		admin := midleware.GetRole(ctx) == auth.RoleAdmin
+		if err := s.DeleteTemplate(ctx.Request.Context(), userID, admin, id); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func templateParams(ctx *gin.Context) (int, int64, bool) {
+	userID, ok := midleware.GetUserID(ctx)
+	if !ok || userID <= 0 {
+		respondUnauthorized(ctx)
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		problem.Write(ctx, problem.Invalid("id", "invalid", ErrBadPathID.Error()))
+		return 0, 0, false
+	}
+	return userID, id, true
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/dto"
+	"myproject/midleware"
+	"myproject/service"
+)
+
+// GET /users/me/settings — часовой пояс и язык
+func GetUserSettings(s service.UserService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		settings, err := s.GetSettings(ctx.Request.Context(), userID)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, settings)
+	}
+}
+
+func UpdateUserSettings(s service.UserService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userID, ok := midleware.GetUserID(ctx)
+		if !ok || userID <= 0 {
+			respondUnauthorized(ctx)
+			return
+		}
+
+		var req dto.UserSettings
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondInvalidJSON(ctx, err)
+			return
+		}
+
+		settings, err := s.UpdateSettings(ctx.Request.Context(), userID, req)
+		if err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, settings)
+	}
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"time"
+
+	"myproject/models"
+)
+
+// Формат дат в ENEX: 20200131T235959Z
+const enexTime = "20060102T150405Z"
+
+type enexNote struct {
+	Title   string `xml:"title"`
+	Content string `xml:"content"`
+	Created string `xml:"created"`
+	Updated string `xml:"updated"`
+}
+
+// notes обходит элементы <note> верхнего уровня; fn получает декодер,
+// стоящий на начале элемента
+func eachENEXNote(data []byte, fn func(d *xml.Decoder, start xml.StartElement) (bool, error)) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 && t.Name.Local == "note" {
+				more, err := fn(d, t)
+				if err != nil {
+					return err
+				}
+				if !more {
+					return nil
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func parseENEX(data []byte) (int, iter.Seq[Item], error) {
+	// первый проход только считает заметки и проверяет, что XML цел
+	total := 0
+	err := eachENEXNote(data, func(d *xml.Decoder, _ xml.StartElement) (bool, error) {
+		total++
+		return total <= maxItems, d.Skip()
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	if total > maxItems {
+		return 0, nil, ErrTooManyFiles
+	}
+
+	return total, func(yield func(Item) bool) {
+		n := 0
+		_ = eachENEXNote(data, func(d *xml.Decoder, start xml.StartElement) (bool, error) {
+			n++
+			var note enexNote
+			if err := d.DecodeElement(&note, &start); err != nil {
+				return false, err
+			}
+
+			item := Item{
+				File:      fmt.Sprintf("%d. %s", n, strings.TrimSpace(note.Title)),
+				Title:     strings.TrimSpace(note.Title),
+				Format:    models.FormatMarkdown,
+				CreatedAt: enexTimeValue(note.Created),
+				UpdatedAt: enexTimeValue(note.Updated),
+			}
+			item.Content, item.Err = ENMLToMarkdown(note.Content)
+			return yield(item), nil
+		})
+	}, nil
+}
+
+func enexTimeValue(s string) time.Time {
+	t, err := time.Parse(enexTime, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,292 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ENMLToMarkdown переводит содержимое заметки Evernote (ENML — XHTML
+// с элементами en-note, en-todo, en-media) в Markdown. Вложения пока не
+// переносятся: на их месте остаётся пометка.
+func ENMLToMarkdown(enml string) (string, error) {
+	// HTML-парсер не знает, что en-todo и en-media пустые, и без этого
+	// вложил бы в них всё, что идёт следом
+	enml = selfClosing.ReplaceAllString(enml, "<$1$2></$1>")
+	doc, err := html.Parse(strings.NewReader(enml))
+	if err != nil {
+		return "", fmt.Errorf("invalid ENML: %w", err)
+	}
+	root := findElement(doc, "en-note")
+	if root == nil {
+		root = findElement(doc, "body")
+	}
+	if root == nil {
+		return "", nil
+	}
+
+	var c mdConverter
+	c.children(root)
+	return tidy(c.out.String()), nil
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if found := findElement(ch, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+var (
+	selfClosing  = regexp.MustCompile(`<(en-todo|en-media)\b([^>]*?)\s*/>`)
+	spaceRun     = regexp.MustCompile(`[ \t\r\n]+`)
+	trailingWS   = regexp.MustCompile(`[ \t]+\n`)
+	blankLineRun = regexp.MustCompile(`\n{3,}`)
+)
+
+func tidy(s string) string {
+	s = trailingWS.ReplaceAllString(s, "\n")
+	s = blankLineRun.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// mdConverter пишет Markdown в out. Вложенные блоки (элементы списков,
+// цитаты) рендерятся отдельным конвертером и затем получают отступ или префикс.
+type mdConverter struct {
+	out strings.Builder
+	pre int
+}
+
+func (c *mdConverter) atLineStart() bool {
+	s := c.out.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// newline завершает текущую строку, blank — ещё и отделяет абзац
+func (c *mdConverter) newline() {
+	if !c.atLineStart() {
+		c.out.WriteByte('\n')
+	}
+}
+
+func (c *mdConverter) blank() {
+	c.newline()
+	if s := c.out.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		c.out.WriteByte('\n')
+	}
+}
+
+func (c *mdConverter) text(s string) {
+	if c.pre > 0 {
+		c.out.WriteString(s)
+		return
+	}
+	s = spaceRun.ReplaceAllString(s, " ")
+	if c.atLineStart() {
+		s = strings.TrimLeft(s, " ")
+	}
+	c.out.WriteString(s)
+}
+
+func (c *mdConverter) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.node(ch)
+	}
+}
+
+// inline рендерит содержимое элемента в строку без переводов строк
+func inline(n *html.Node) string {
+	var sub mdConverter
+	sub.children(n)
+	return strings.TrimSpace(spaceRun.ReplaceAllString(sub.out.String(), " "))
+}
+
+// wrap — выделение вроде **жирного**; пустое не пишем
+func (c *mdConverter) wrap(n *html.Node, mark string) {
+	if s := inline(n); s != "" {
+		c.text(mark + s + mark)
+	}
+}
+
+func (c *mdConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "br":
+		c.out.WriteByte('\n')
+	case "p":
+		c.blank()
+		c.children(n)
+		c.blank()
+	case "div":
+		// Evernote пишет каждую строку отдельным div
+		c.newline()
+		c.children(n)
+		c.newline()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.blank()
+		c.out.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " " + inline(n))
+		c.blank()
+	case "b", "strong":
+		c.wrap(n, "**")
+	case "i", "em":
+		c.wrap(n, "*")
+	case "s", "strike", "del":
+		c.wrap(n, "~~")
+	case "code", "tt":
+		if c.pre > 0 {
+			c.children(n)
+		} else {
+			c.wrap(n, "`")
+		}
+	case "a":
+		href, text := attr(n, "href"), inline(n)
+		switch {
+		case href == "":
+			c.text(text)
+		case text == "" || text == href:
+			c.text("<" + href + ">")
+		default:
+			c.text("[" + text + "](" + href + ")")
+		}
+	case "img":
+		c.text("![" + attr(n, "alt") + "](" + attr(n, "src") + ")")
+	case "hr":
+		c.blank()
+		c.out.WriteString("---")
+		c.blank()
+	case "pre":
+		c.blank()
+		c.out.WriteString("```\n")
+		c.pre++
+		c.children(n)
+		c.pre--
+		c.newline()
+		c.out.WriteString("```")
+		c.blank()
+	case "blockquote":
+		c.blank()
+		c.prefixed(n, "> ", "> ")
+		c.blank()
+	case "ul", "ol":
+		c.blank()
+		c.list(n)
+		c.blank()
+	case "table":
+		c.blank()
+		c.table(n)
+		c.blank()
+	case "en-todo":
+		if attr(n, "checked") == "true" {
+			c.text("[x] ")
+		} else {
+			c.text("[ ] ")
+		}
+	case "en-media":
+		c.text("[вложение: " + attr(n, "type") + "]")
+	case "en-crypt":
+		c.text("[зашифрованный фрагмент]")
+	case "script", "style", "title", "head":
+	default:
+		c.children(n)
+	}
+}
+
+// prefixed рендерит содержимое n отдельно и добавляет first к первой
+// строке и rest к остальным
+func (c *mdConverter) prefixed(n *html.Node, first, rest string) {
+	var sub mdConverter
+	sub.pre = c.pre
+	sub.children(n)
+	lines := strings.Split(tidy(sub.out.String()), "\n")
+	for i, line := range lines {
+		p := rest
+		if i == 0 {
+			p = first
+		}
+		if line == "" {
+			p = strings.TrimRight(p, " ")
+		}
+		c.out.WriteString(p + line + "\n")
+	}
+}
+
+func (c *mdConverter) list(n *html.Node) {
+	i := 0
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		i++
+		marker := "- "
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%d. ", i)
+		}
+		c.prefixed(li, marker, strings.Repeat(" ", len(marker)))
+	}
+}
+
+// table — таблица GFM; первая строка считается заголовком
+func (c *mdConverter) table(n *html.Node) {
+	var rows [][]string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type != html.ElementNode {
+				continue
+			}
+			if ch.Data != "tr" {
+				collect(ch)
+				continue
+			}
+			var row []string
+			for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					row = append(row, strings.ReplaceAll(inline(cell), "|", `\|`))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	for i, r := range rows {
+		for len(r) < width {
+			r = append(r, "")
+		}
+		c.out.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			c.out.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package importer разбирает файлы, из которых импортируются заметки:
+// ZIP с Markdown (Obsidian и т.п., с YAML front-matter) и экспорт Evernote
+// (ENEX, текст в ENML). Результат — последовательность Item; ошибка
+// отдельного файла не прерывает разбор остальных.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"time"
+)
+
+const (
+	FormatMarkdown = "markdown" // ZIP с .md-файлами
+	FormatENEX     = "enex"
+)
+
+var (
+	ErrUnknownFormat = errors.New("file must be a ZIP of Markdown files or an Evernote ENEX export")
+	ErrTooManyFiles  = errors.New("archive contains too many files")
+)
+
+// Больше заметок из одного файла не берём
+const maxItems = 10000
+
+// Item — одна заметка из файла. File — откуда она взята (путь в архиве
+// или номер и заголовок заметки ENEX). Err — заметку разобрать не удалось.
+type Item struct {
+	File      string
+	Title     string
+	Content   string
+	Format    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Err       error
+}
+
+// Detect определяет формат по содержимому: ZIP — по сигнатуре, ENEX — по
+// корневому элементу
+func Detect(data []byte) (string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FormatMarkdown, nil
+	}
+	head := data[:min(len(data), 1024)]
+	if bytes.Contains(head, []byte("<en-export")) {
+		return FormatENEX, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func Valid(format string) bool {
+	return format == FormatMarkdown || format == FormatENEX
+}
+
+// Parse проверяет файл целиком и возвращает число заметок в нём и их
+// последовательность; сами заметки разбираются по мере обхода
+func Parse(format string, data []byte) (int, iter.Seq[Item], error) {
+	switch format {
+	case FormatMarkdown:
+		return parseMarkdownZIP(data)
+	case FormatENEX:
+		return parseENEX(data)
+	}
+	return 0, nil, ErrUnknownFormat
+}
@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+
+	"myproject/models"
+	"myproject/validation"
+)
+
+var (
+	errFileTooLarge   = errors.New("file is too large")
+	errNotUTF8        = errors.New("file is not valid UTF-8")
+	errBadFrontMatter = errors.New("front-matter is not closed with ---")
+)
+
+// Ключи front-matter с датами: наш экспорт и распространённые варианты
+var (
+	createdKeys = []string{"created_at", "created", "date"}
+	updatedKeys = []string{"updated_at", "updated", "modified"}
+)
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func isMarkdown(f *zip.File) bool {
+	if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") {
+		return false
+	}
+	base := path.Base(f.Name)
+	ext := strings.ToLower(path.Ext(base))
+	return !strings.HasPrefix(base, ".") && (ext == ".md" || ext == ".markdown")
+}
+
+func parseMarkdownZIP(data []byte) (int, iter.Seq[Item], error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+
+	var files []*zip.File
+	for _, f := range zr.File {
+		if isMarkdown(f) {
+			files = append(files, f)
+		}
+	}
+	if len(files) > maxItems {
+		return 0, nil, ErrTooManyFiles
+	}
+
+	// заголовок и front-matter сверх лимита текста; остальное отсечёт проверка длины
+	maxBytes := int64(validation.Limit("note.content"))*utf8.UTFMax + 64<<10
+
+	return len(files), func(yield func(Item) bool) {
+		for _, f := range files {
+			item := Item{File: f.Name}
+			if err := readMarkdown(f, maxBytes, &item); err != nil {
+				item.Err = err
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}, nil
+}
+
+func readMarkdown(f *zip.File, maxBytes int64, item *Item) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// размер в заголовке ZIP может врать, поэтому читаем с ограничением
+	raw, err := io.ReadAll(io.LimitReader(rc, maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(raw)) > maxBytes {
+		return errFileTooLarge
+	}
+	if !utf8.Valid(raw) {
+		return errNotUTF8
+	}
+
+	text := strings.ReplaceAll(string(raw), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+	meta, body, err := splitFrontMatter(text)
+	if err != nil {
+		return err
+	}
+
+	item.Content = strings.TrimLeft(body, "\n")
+	// наш же экспорт помнит исходный формат; остальные файлы — markdown
+	item.Format = models.FormatMarkdown
+	if f := stringValue(meta["format"]); f == models.FormatPlain {
+		item.Format = f
+	}
+	item.Title = stringValue(meta["title"])
+	if item.Title == "" {
+		item.Title = headingTitle(item.Content)
+	}
+	if item.Title == "" {
+		// Obsidian хранит заголовок только в имени файла
+		base := path.Base(f.Name)
+		item.Title = strings.TrimSuffix(base, path.Ext(base))
+	}
+	item.CreatedAt = timeValue(meta, createdKeys)
+	item.UpdatedAt = timeValue(meta, updatedKeys)
+	// без даты в архиве время файла — начало эпохи DOS; такое не берём
+	if f.Modified.Year() > 1980 {
+		if item.CreatedAt.IsZero() {
+			item.CreatedAt = f.Modified
+		}
+		if item.UpdatedAt.IsZero() {
+			item.UpdatedAt = f.Modified
+		}
+	}
+	return nil
+}
+
+// splitFrontMatter отделяет блок между строками --- в начале файла
+func splitFrontMatter(text string) (map[string]any, string, error) {
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, text, nil
+	}
+	// ведущий перевод строки — чтобы найти и пустой блок
+	rest := text[len("---"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 || (len(rest) > end+4 && rest[end+4] != '\n') {
+		return nil, "", errBadFrontMatter
+	}
+
+	meta := map[string]any{}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &meta); err != nil {
+		return nil, "", fmt.Errorf("invalid front-matter: %w", err)
+	}
+	body := rest[min(len(rest), end+5):]
+	return meta, body, nil
+}
+
+// Заголовок первой строки вида "# Заголовок"
+func headingTitle(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	if title, ok := strings.CutPrefix(line, "# "); ok {
+		return strings.TrimSpace(title)
+	}
+	return ""
+}
+
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case nil:
+		return ""
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// Первая дата, которая нашлась по одному из ключей и разобралась
+func timeValue(meta map[string]any, keys []string) time.Time {
+	for _, k := range keys {
+		switch v := meta[k].(type) {
+		case time.Time:
+			return v
+		case string:
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
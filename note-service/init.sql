@@ -4,3 +4,324 @@ CREATE TABLE IF NOT EXISTS notes (
     title   TEXT NOT NULL,
     content TEXT
 );
+
+-- журнал аудита: только добавление записей
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INT,
+    user_id     INT,
+    action      TEXT NOT NULL,
+    target_type TEXT,
+    target_id   TEXT,
+    request_id  TEXT,
+    ip          TEXT,
+    user_agent  TEXT,
+    before_hash TEXT,
+    after_hash  TEXT,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_idx    ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_idx ON audit_log (created_at);
+
+-- изменять записи нельзя; удалять — только очистке по сроку хранения: она
+-- передаёт AUDIT_RETENTION_DAYS в audit.retention_days своей транзакции
+CREATE OR REPLACE FUNCTION audit_log_protect() RETURNS trigger AS $$
+DECLARE
+    retention INT := NULLIF(current_setting('audit.retention_days', true), '')::INT;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        RAISE EXCEPTION 'audit_log is append-only';
+    END IF;
+    IF retention IS NULL OR retention <= 0 THEN
+        RAISE EXCEPTION 'audit_log entries are deleted only by retention';
+    END IF;
+    IF OLD.created_at >= NOW() - make_interval(days => retention) THEN
+        RAISE EXCEPTION 'audit_log entries younger than % days cannot be deleted', retention;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_protect ON audit_log;
+CREATE TRIGGER audit_log_protect BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_protect();
+
+-- версия набора заметок пользователя: растёт при каждом изменении в той же
+-- транзакции, что и запись. По ней кэш отличает свежие данные от устаревших.
+CREATE TABLE IF NOT EXISTS note_versions (
+    user_id INT PRIMARY KEY,
+    version BIGINT NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION notes_bump_version() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        INSERT INTO note_versions (user_id, version) VALUES (OLD.user_id, 1)
+        ON CONFLICT (user_id) DO UPDATE SET version = note_versions.version + 1;
+    END IF;
+    IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.user_id <> OLD.user_id) THEN
+        INSERT INTO note_versions (user_id, version) VALUES (NEW.user_id, 1)
+        ON CONFLICT (user_id) DO UPDATE SET version = note_versions.version + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_bump_version ON notes;
+CREATE TRIGGER notes_bump_version AFTER INSERT OR UPDATE OR DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_bump_version();
+
+-- время создания и последнего изменения заметки (экспорт)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE OR REPLACE FUNCTION notes_touch() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at := NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_touch ON notes;
+CREATE TRIGGER notes_touch BEFORE UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_touch();
+
+-- хэш заголовка и текста: по нему импорт пропускает уже существующие заметки
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS content_hash TEXT;
+
+CREATE OR REPLACE FUNCTION notes_hash() RETURNS trigger AS $$
+BEGIN
+    NEW.content_hash := encode(sha256(convert_to(NEW.title || E'\n' || COALESCE(NEW.content, ''), 'UTF8')), 'hex');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_hash ON notes;
+CREATE TRIGGER notes_hash BEFORE INSERT OR UPDATE OF title, content ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_hash();
+
+UPDATE notes SET content_hash = encode(sha256(convert_to(title || E'\n' || COALESCE(content, ''), 'UTF8')), 'hex')
+WHERE content_hash IS NULL;
+
+CREATE INDEX IF NOT EXISTS notes_user_hash_idx ON notes (user_id, content_hash);
+
+-- задания импорта: загруженный файл, прогресс и отчёт об ошибках по файлам
+CREATE TABLE IF NOT EXISTS imports (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT NOT NULL,
+    format      TEXT NOT NULL,
+    status      TEXT NOT NULL DEFAULT 'pending',
+    source      BYTEA,
+    total       INT NOT NULL DEFAULT 0,
+    processed   INT NOT NULL DEFAULT 0,
+    created     INT NOT NULL DEFAULT 0,
+    duplicates  INT NOT NULL DEFAULT 0,
+    failed      INT NOT NULL DEFAULT 0,
+    errors      JSONB NOT NULL DEFAULT '[]',
+    error       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS imports_user_idx ON imports (user_id, id);
+
+-- очередь фоновых задач. Задачу забирает воркер (FOR UPDATE SKIP LOCKED) и
+-- держит аренду locked_until, продлевая её; задачу с истёкшей арендой (воркер
+-- упал) заберёт другой.
+CREATE TABLE IF NOT EXISTS jobs (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          INT,
+    kind             TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    status           TEXT NOT NULL DEFAULT 'queued',
+    attempts         INT NOT NULL DEFAULT 0,
+    max_attempts     INT NOT NULL DEFAULT 5,
+    progress         INT NOT NULL DEFAULT 0,
+    total            INT NOT NULL DEFAULT 0,
+    error            TEXT,
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    run_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_by        TEXT,
+    locked_until     TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at       TIMESTAMPTZ,
+    finished_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS jobs_queued_idx  ON jobs (run_at, id) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_user_idx    ON jobs (user_id, id);
+
+ALTER TABLE imports ADD COLUMN IF NOT EXISTS job_id BIGINT;
+
+-- формат текста заметки: plain или markdown (рендер — GET /notes/{id}?render=html)
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS format TEXT NOT NULL DEFAULT 'plain'
+    CHECK (format IN ('plain', 'markdown'));
+
+-- вложения заметок: сами файлы — в хранилище (blob), здесь — метаданные.
+-- Удаляются вместе с заметкой; файлы потом удаляет задача blob.delete.
+CREATE TABLE IF NOT EXISTS attachments (
+    id           BIGSERIAL PRIMARY KEY,
+    note_id      INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    user_id      INT NOT NULL,
+    file_name    TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size         BIGINT NOT NULL,
+    sha256       TEXT NOT NULL,
+    blob_key     TEXT NOT NULL,
+    thumb_key    TEXT,
+    width        INT,
+    height       INT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS attachments_note_idx ON attachments (note_id, id);
+CREATE INDEX IF NOT EXISTS attachments_user_idx ON attachments (user_id);
+
+-- файлы удалённых вложений удаляет очередь задач: в транзакции удаления
+-- заметки ходить в хранилище нельзя, а её откат не должен терять файлы
+CREATE OR REPLACE FUNCTION attachments_enqueue_blob_delete() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO jobs (kind, payload)
+    VALUES ('blob.delete', jsonb_build_object('keys', to_jsonb(array_remove(ARRAY[OLD.blob_key, OLD.thumb_key], NULL))));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS attachments_blob_delete ON attachments;
+CREATE TRIGGER attachments_blob_delete AFTER DELETE ON attachments
+    FOR EACH ROW EXECUTE FUNCTION attachments_enqueue_blob_delete();
+
+-- синхронизация офлайн-клиентов (GET/POST /sync). seq заметки — значение
+-- note_versions.version, присвоенное её последнему изменению: у пользователя
+-- это монотонная последовательность изменений, и токен синхронизации — её
+-- позиция. Заметки, созданные до появления seq, имеют seq = 0.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS notes_user_seq_idx ON notes (user_id, seq, id);
+
+-- надгробия удалённых заметок: по ним клиенты узнают об удалении
+CREATE TABLE IF NOT EXISTS note_tombstones (
+    user_id    INT NOT NULL,
+    note_id    INT NOT NULL,
+    seq        BIGINT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, note_id)
+);
+
+CREATE INDEX IF NOT EXISTS note_tombstones_seq_idx     ON note_tombstones (user_id, seq);
+CREATE INDEX IF NOT EXISTS note_tombstones_deleted_idx ON note_tombstones (deleted_at);
+
+-- надгробия старше срока хранения удаляются; токен до purged_seq уже не
+-- покрывает все удаления — такому клиенту нужна полная синхронизация
+ALTER TABLE note_versions ADD COLUMN IF NOT EXISTS purged_seq BIGINT NOT NULL DEFAULT 0;
+
+-- client_id заметок, созданных через POST /sync: повтор того же пакета
+-- после обрыва связи не создаёт дубликатов
+CREATE TABLE IF NOT EXISTS note_client_ids (
+    user_id    INT NOT NULL,
+    client_id  TEXT NOT NULL,
+    note_id    INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- версия теперь присваивается до записи строки (BEFORE), чтобы попасть в seq
+CREATE OR REPLACE FUNCTION notes_bump_version() RETURNS trigger AS $$
+DECLARE
+    v BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' OR (TG_OP = 'UPDATE' AND NEW.user_id <> OLD.user_id) THEN
+        INSERT INTO note_versions (user_id, version) VALUES (OLD.user_id, 1)
+        ON CONFLICT (user_id) DO UPDATE SET version = note_versions.version + 1
+        RETURNING version INTO v;
+        INSERT INTO note_tombstones (user_id, note_id, seq) VALUES (OLD.user_id, OLD.id, v)
+        ON CONFLICT (user_id, note_id) DO UPDATE SET seq = EXCLUDED.seq, deleted_at = NOW();
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO note_versions (user_id, version) VALUES (NEW.user_id, 1)
+    ON CONFLICT (user_id) DO UPDATE SET version = note_versions.version + 1
+    RETURNING version INTO v;
+    NEW.seq := v;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_bump_version ON notes;
+CREATE TRIGGER notes_bump_version BEFORE INSERT OR UPDATE OR DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_bump_version();
+
+-- пользователи глазами note-service: заполняется из события user_registered,
+-- нужен шаблонам ({{user.email}}) и приветственной заметке (locale)
+CREATE TABLE IF NOT EXISTS note_users (
+    user_id    INT PRIMARY KEY,
+    email      TEXT NOT NULL DEFAULT '',
+    locale     TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- шаблоны заметок. user_id IS NULL — системный шаблон: виден всем, меняют
+-- его только администраторы. fields — поля шаблона со значениями по умолчанию.
+CREATE TABLE IF NOT EXISTS note_templates (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT,
+    name       TEXT NOT NULL,
+    locale     TEXT NOT NULL DEFAULT '',
+    title      TEXT NOT NULL,
+    content    TEXT NOT NULL DEFAULT '',
+    format     TEXT NOT NULL DEFAULT 'plain',
+    fields     JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS note_templates_name_idx ON note_templates ((COALESCE(user_id, 0)), name, locale);
+
+-- приветственная заметка нового пользователя (WELCOME_TEMPLATE)
+INSERT INTO note_templates (user_id, name, locale, title, content) VALUES
+    (NULL, 'welcome', 'ru', 'Добро пожаловать!', 'Привет, {{user.email}}! Это ваша первая заметка.'),
+    (NULL, 'welcome', 'en', 'Welcome!', 'Hi, {{user.email}}! This is your first note.')
+ON CONFLICT ((COALESCE(user_id, 0)), name, locale) DO NOTHING;
+
+-- заметки-задачи: срок и время напоминания. Время хранится абсолютным;
+-- локальное время клиента переводится по note_users.timezone при записи.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS remind_at TIMESTAMPTZ;
+
+ALTER TABLE note_users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
+
+-- напоминание — задача note.reminder в очереди jobs с run_at = remind_at:
+-- её забирает ровно одна реплика (SKIP LOCKED), а аренда переживает падение
+-- воркера. При переносе или удалении заметки ждущая задача отменяется;
+-- выполняемую обработчик сверит с текущим remind_at.
+CREATE INDEX IF NOT EXISTS jobs_note_reminder_idx ON jobs (((payload->>'note_id')::int))
+    WHERE kind = 'note.reminder' AND status = 'queued';
+
+CREATE OR REPLACE FUNCTION notes_schedule_reminder() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.remind_at IS NOT DISTINCT FROM OLD.remind_at THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP <> 'INSERT' THEN
+        UPDATE jobs SET status = 'canceled', finished_at = NOW()
+        WHERE kind = 'note.reminder' AND status = 'queued' AND (payload->>'note_id')::int = OLD.id;
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.remind_at IS NOT NULL THEN
+        INSERT INTO jobs (kind, payload, run_at)
+        VALUES ('note.reminder',
+                jsonb_build_object('note_id', NEW.id, 'user_id', NEW.user_id, 'remind_at', NEW.remind_at),
+                NEW.remind_at);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notes_schedule_reminder ON notes;
+CREATE TRIGGER notes_schedule_reminder AFTER INSERT OR UPDATE OF remind_at OR DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION notes_schedule_reminder();
+
+-- due_before: заметки пользователя со сроком раньше границы, по сроку
+CREATE INDEX IF NOT EXISTS notes_user_due_idx ON notes (user_id, due_at) WHERE due_at IS NOT NULL;
@@ -0,0 +1,357 @@
+// Package jobs — очередь фоновых задач в Postgres и пул воркеров, который их
+// выполняет: повторы с нарастающей задержкой, прогресс, отмена и мягкая
+// остановка вместе с сервисом.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"myproject/internal/logger"
+	"myproject/models"
+	"myproject/repository"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+
+	// Причины отмены контекста задачи — обработчик различает их через context.Cause
+	ErrCanceled = errors.New("job canceled")
+	ErrShutdown = errors.New("service shutting down")
+)
+
+// Progress сообщает, сколько сделано из total; пишется в БД не чаще раза в секунду
+type Progress func(done, total int)
+
+// Handler выполняет задачу одного вида. Ошибка — повтор с задержкой, пока не
+// кончатся попытки; Permanent(err) — сразу failed. Задачу могут выполнить
+// повторно (ошибка, падение воркера, остановка), поэтому обработчик должен
+// быть идемпотентным.
+type Handler func(ctx context.Context, job models.Job, progress Progress) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent — ошибка, которую повтор не исправит
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+type Queue struct {
+	repo     *repository.JobRepository
+	handlers map[string]Handler
+	wake     chan struct{}
+
+	worker          string
+	concurrency     int
+	maxAttempts     int
+	poll            time.Duration
+	lease           time.Duration
+	heartbeat       time.Duration
+	retryBase       time.Duration
+	retryMax        time.Duration
+	shutdownTimeout time.Duration
+}
+
+func NewQueue(repo *repository.JobRepository) *Queue {
+	host, _ := os.Hostname()
+	q := &Queue{
+		repo:     repo,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+
+		worker:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+		concurrency:     getInt("JOBS_CONCURRENCY", 4),
+		maxAttempts:     getInt("JOBS_MAX_ATTEMPTS", 5),
+		poll:            getDuration("JOBS_POLL_INTERVAL", time.Second),
+		lease:           getDuration("JOBS_LEASE", time.Minute),
+		heartbeat:       getDuration("JOBS_HEARTBEAT", 5*time.Second),
+		retryBase:       getDuration("JOBS_RETRY_BASE", 5*time.Second),
+		retryMax:        getDuration("JOBS_RETRY_MAX", 10*time.Minute),
+		shutdownTimeout: getDuration("JOBS_SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	// аренду продлеваем заметно чаще, чем она истекает
+	q.heartbeat = min(q.heartbeat, q.lease/3)
+	return q
+}
+
+// Handle регистрирует обработчик вида задач; вызывать до Run
+func (q *Queue) Handle(kind string, h Handler) {
+	q.handlers[kind] = h
+}
+
+// Enqueue ставит задачу в очередь; payload сериализуется в JSON.
+// userID=0 — системная задача, пользователю она не видна.
+func (q *Queue) Enqueue(ctx context.Context, userID int, kind string, payload any) (models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("jobs: encode payload kind=%s: %w", kind, err)
+	}
+	job, err := q.repo.Enqueue(ctx, userID, kind, data, q.maxAttempts)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("jobs: enqueue: %w", err)
+	}
+
+	// будим простаивающий воркер, чтобы не ждать очередного опроса
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Задача пользователя; чужие не видны
+func (q *Queue) Get(ctx context.Context, userID int, id int64) (models.Job, error) {
+	job, err := q.repo.Get(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.Job{}, ErrNotFound
+		}
+		return models.Job{}, fmt.Errorf("jobs: get: %w", err)
+	}
+	return job, nil
+}
+
+func (q *Queue) List(ctx context.Context, userID, limit, offset int) ([]models.Job, error) {
+	jobs, err := q.repo.List(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: list: %w", err)
+	}
+	return jobs, nil
+}
+
+// Cancel просит отменить задачу; состояние canceled она получит, когда её
+// снимет воркер
+func (q *Queue) Cancel(ctx context.Context, userID int, id int64) (models.Job, error) {
+	job, err := q.repo.Cancel(ctx, userID, id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return models.Job{}, ErrNotFound
+	case errors.Is(err, repository.ErrJobFinished):
+		return models.Job{}, ErrFinished
+	case err != nil:
+		return models.Job{}, fmt.Errorf("jobs: cancel: %w", err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Run запускает воркеров и блокируется до отмены ctx. После неё новые задачи
+// не берутся, а выполняемым даётся JOBS_SHUTDOWN_TIMEOUT на завершение;
+// не успевшие прерываются (ErrShutdown) и возвращаются в очередь без
+// списания попытки.
+func (q *Queue) Run(ctx context.Context) {
+	running, interrupt := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer interrupt(nil)
+
+	var wg sync.WaitGroup
+	for i := range q.concurrency {
+		worker := fmt.Sprintf("%s/%d", q.worker, i)
+		wg.Go(func() { q.work(ctx, running, worker) })
+	}
+	logger.Infof("jobs: %d workers started", q.concurrency)
+
+	<-ctx.Done()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(q.shutdownTimeout):
+		logger.Infof("jobs: shutdown timeout, interrupting running jobs")
+		interrupt(ErrShutdown)
+		<-done
+	}
+	logger.Infof("jobs: workers stopped")
+}
+
+// work забирает задачи, пока не отменён ctx; сами задачи выполняются в running
+func (q *Queue) work(ctx, running context.Context, worker string) {
+	for ctx.Err() == nil {
+		job, ok, err := q.repo.Claim(ctx, worker, q.lease)
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("jobs: claim: %v", err)
+		}
+		if err != nil || !ok {
+			q.idle(ctx)
+			continue
+		}
+		q.execute(running, worker, job)
+	}
+}
+
+func (q *Queue) idle(ctx context.Context) {
+	t := time.NewTimer(q.poll)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-q.wake:
+	case <-t.C:
+	}
+}
+
+func (q *Queue) execute(parent context.Context, worker string, job models.Job) {
+	// итог пишем, даже если задачу прервали
+	store := context.WithoutCancel(parent)
+
+	h, ok := q.handlers[job.Kind]
+	if !ok {
+		logger.Errorf("job=%d kind=%s: no handler", job.ID, job.Kind)
+		q.finish(store, worker, job, models.JobFailed, "unknown job kind")
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+	if job.CancelRequested {
+		// отменили, пока задача ждала: обработчик получит уже отменённый контекст
+		cancel(ErrCanceled)
+	}
+	stopBeat := q.keepAlive(ctx, cancel, worker, job.ID)
+
+	start := time.Now()
+	err := call(ctx, h, job, q.progress(store, worker, job.ID))
+	stopBeat()
+	cause := context.Cause(ctx)
+
+	switch {
+	case err == nil:
+		logger.Infof("job=%d kind=%s done in %v", job.ID, job.Kind, time.Since(start))
+		q.finish(store, worker, job, models.JobDone, "")
+	case errors.Is(cause, ErrCanceled):
+		logger.Infof("job=%d kind=%s canceled", job.ID, job.Kind)
+		q.finish(store, worker, job, models.JobCanceled, "")
+	case errors.Is(cause, ErrShutdown):
+		logger.Infof("job=%d kind=%s interrupted by shutdown, requeued", job.ID, job.Kind)
+		q.retry(store, worker, job, time.Now(), "", true)
+	default:
+		if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+			logger.Errorf("job=%d kind=%s failed (attempt %d/%d): %v", job.ID, job.Kind, job.Attempts, job.MaxAttempts, err)
+			q.finish(store, worker, job, models.JobFailed, "job failed")
+			return
+		}
+		delay := q.backoff(job.Attempts)
+		logger.Errorf("job=%d kind=%s attempt %d/%d failed, retry in %v: %v",
+			job.ID, job.Kind, job.Attempts, job.MaxAttempts, delay, err)
+		q.retry(store, worker, job, time.Now().Add(delay), fmt.Sprintf("attempt %d failed", job.Attempts), false)
+	}
+}
+
+// Паника в обработчике не должна ронять воркер; повтор её вряд ли исправит
+func call(ctx context.Context, h Handler, job models.Job, p Progress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return h(ctx, job, p)
+}
+
+// keepAlive продлевает аренду, пока задача выполняется, и отменяет её
+// контекст, если пользователь попросил отмену или аренду перехватили
+func (q *Queue) keepAlive(ctx context.Context, cancel context.CancelCauseFunc, worker string, id int64) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		t := time.NewTicker(q.heartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+
+			canceled, owned, err := q.repo.Heartbeat(context.WithoutCancel(ctx), id, worker, q.lease)
+			switch {
+			case err != nil:
+				logger.Errorf("job=%d heartbeat: %v", id, err)
+			case !owned:
+				logger.Errorf("job=%d lease lost", id)
+				cancel(errors.New("lease lost"))
+			case canceled:
+				cancel(ErrCanceled)
+			}
+		}
+	})
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (q *Queue) progress(ctx context.Context, worker string, id int64) Progress {
+	var last time.Time
+	return func(done, total int) {
+		if done < total && time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		if err := q.repo.Progress(ctx, id, worker, done, total); err != nil {
+			logger.Errorf("job=%d progress: %v", id, err)
+		}
+	}
+}
+
+func (q *Queue) finish(ctx context.Context, worker string, job models.Job, status, msg string) {
+	if err := q.repo.Finish(ctx, job.ID, worker, status, msg); err != nil {
+		logger.Errorf("job=%d finish: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) retry(ctx context.Context, worker string, job models.Job, at time.Time, msg string, refund bool) {
+	if err := q.repo.Retry(ctx, job.ID, worker, msg, at, refund); err != nil {
+		logger.Errorf("job=%d retry: %v", job.ID, err)
+	}
+}
+
+// Задержка перед попыткой attempt+1: base·2^(attempt-1), не больше retryMax,
+// плюс до 25% случайного разброса, чтобы повторы не сбивались в кучу
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.retryMax
+	if attempt < 30 {
+		d = min(q.retryBase<<(attempt-1), q.retryMax)
+	}
+	return d + time.Duration(rand.Int64N(int64(d)/4+1))
+}
+
+// Длительность в формате time.ParseDuration ("30s", "1m")
+func getDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+func getInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
@@ -2,15 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"myproject/audit"
+	"myproject/blob"
 	"myproject/cache"
+	"myproject/collab"
 	"myproject/db"
 	"myproject/events"
+	"myproject/grpcserver"
+	"myproject/jobs"
 	"myproject/midleware"
+	"myproject/notify"
+	"myproject/openapi"
+	"myproject/problem"
 	"myproject/repository"
 	"myproject/routes"
 	"myproject/service"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	// база часовых поясов в бинарнике: в образе alpine её нет
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,42 +41,293 @@ func main() {
 	defer database.Close()
 
 	repo := repository.CreateNoteRepository(database)
+	users := repository.CreateUserRepository(database)
 	notesCache := cache.NewNotesCache()
-	srv := service.CreateNoteService(repo, notesCache)
+	auditor := audit.NewRecorder(repository.CreateAuditRepository(database))
+	broker := notify.NewBroker(notesCache.Redis())
+	collabNotifier := collab.NewNotifier(notesCache.Redis())
+	srv := service.CreateNoteService(repo, users, notesCache, auditor, broker, collabNotifier)
+	queue := jobs.NewQueue(repository.CreateJobRepository(database))
+	importSrv := service.CreateImportService(repository.CreateImportRepository(database), repo, notesCache, auditor, queue, broker)
+	queue.Handle(service.JobImport, importSrv.RunJob)
 
-	// контекст для Kafka-consumer'а
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	blobs, err := blob.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	attachSrv := service.CreateAttachmentService(repository.CreateAttachmentRepository(database), blobs, auditor, attachmentConfig())
+	queue.Handle(service.JobBlobDelete, attachSrv.RunBlobDelete)
+	syncSrv := service.CreateSyncService(repo, users, notesCache, auditor, broker, collabNotifier)
+	hub := collab.NewHub(notesCache.Redis(), srv)
+	templateSrv := service.CreateTemplateService(repository.CreateTemplateRepository(database), users, srv, templateConfig())
+	userSrv := service.CreateUserService(users)
+
+	// напоминания о заметках-задачах: задачи очереди → Kafka (и вебхук)
+	reminders := events.NewReminderPublisher()
+	defer reminders.Close()
+	reminderSrv := service.CreateReminderService(repo, users, queue, reminders, reminderConfig())
+	queue.Handle(service.JobNoteReminder, reminderSrv.RunReminder)
+	queue.Handle(service.JobReminderWebhook, reminderSrv.RunWebhook)
+
+	// контекст для Kafka-consumer'а и фоновых задач; отменяется по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go auditor.RunRetention(ctx, auditRetentionDays())
+	go syncSrv.RunTombstoneRetention(ctx, tombstoneRetentionDays())
+
+	// пул воркеров очереди задач; queueDone закрывается, когда он остановится
+	queueDone := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(queueDone)
+	}()
+
+	// сбрасываем локальные копии кэша по сигналам других реплик
+	go notesCache.ListenInvalidations(ctx)
+
+	// раздаём изменения заметок открытым SSE/WebSocket-подключениям
+	go broker.Run(ctx)
+
+	// сеансы совместного редактирования; collabDone — когда они сохранились и закрылись
+	collabDone := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(collabDone)
+	}()
 
 	// запускаем consumer, который слушает user_registered и создаёт приветственные заметки
-	if err := events.RunUserRegisteredConsumer(ctx, srv); err != nil {
+	if err := events.RunUserRegisteredConsumer(ctx, templateSrv); err != nil {
 		fmt.Println("failed to start Kafka consumer:", err)
 	}
 
+	r, err := newRouter(api{
+		broker:      broker,
+		notes:       srv,
+		cache:       notesCache,
+		auditor:     auditor,
+		imports:     importSrv,
+		queue:       queue,
+		attachments: attachSrv,
+		sync:        syncSrv,
+		collab:      hub,
+		templates:   templateSrv,
+		users:       userSrv,
+	}, openapi.ModeFromEnv())
+	if err != nil {
+		panic(err)
+	}
+
+	if err := database.Ping(); err != nil {
+		panic("Не удалось подключиться к БД: " + err.Error())
+	}
+
+	fmt.Println("Подключение к БД успешно!")
+
+	// gRPC для внутренних сервисов — рядом с REST, на отдельном порту
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9091"
+	}
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		panic("Не удалось открыть порт gRPC: " + err.Error())
+	}
+	grpcServer := grpcserver.NewServer(srv)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			fmt.Println("gRPC server stopped:", err)
+		}
+	}()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8081"
+	}
+
+	httpServer := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	<-ctx.Done()
+	fmt.Println("Останавливаем сервис...")
+
+	// сначала перестаём принимать запросы, затем ждём воркеров очереди:
+	// незавершённые задачи вернутся в очередь и продолжатся после рестарта
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("HTTP server shutdown:", err)
+	}
+	grpcServer.GracefulStop()
+	<-queueDone
+	<-collabDone
+}
+
+// api — зависимости HTTP-маршрутов
+type api struct {
+	broker      *notify.Broker
+	notes       service.NoteService
+	cache       *cache.NotesCache
+	auditor     *audit.Recorder
+	imports     service.ImportService
+	queue       *jobs.Queue
+	attachments service.AttachmentService
+	sync        service.SyncService
+	collab      *collab.Hub
+	templates   service.TemplateService
+	users       service.UserService
+}
+
+// newRouter собирает REST API: ошибки в problem+json, контракт OpenAPI
+// (/openapi.json, /docs и проверка в режиме validate) и маршруты
+func newRouter(a api, validate string) (*gin.Engine, error) {
 	r := gin.New()
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	r.Use(gin.Recovery())
+	// паника и неизвестный маршрут — тоже problem+json
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		problem.Write(c, problem.Internal())
+	}))
+	r.NoRoute(func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusNotFound, problem.CodeNotFound, "route not found"))
+	})
 	r.Use(midleware.RequestID())
 	r.Use(midleware.RequestLogger())
 
-	routes.RegisterNoteRoutes(r, srv)
+	spec, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := openapi.Register(r, spec); err != nil {
+		return nil, err
+	}
+	validator, err := openapi.Validator(spec, validate)
+	if err != nil {
+		return nil, err
+	}
+	r.Use(validator)
+
+	routes.RegisterStreamRoutes(r, a.broker)
+	routes.RegisterNoteRoutes(r, a.notes, a.templates)
+	routes.RegisterAdminRoutes(r, a.notes, a.cache)
+	routes.RegisterAuditRoutes(r, a.auditor)
+	routes.RegisterImportRoutes(r, a.imports, importMaxBytes())
+	routes.RegisterJobRoutes(r, a.queue)
+	routes.RegisterAttachmentRoutes(r, a.attachments, attachmentMaxBytes())
+	routes.RegisterSyncRoutes(r, a.sync)
+	routes.RegisterCollabRoutes(r, a.collab)
+	routes.RegisterTemplateRoutes(r, a.templates)
+	routes.RegisterUserRoutes(r, a.users)
+	return r, nil
+}
 
-	if err := database.Ping(); err != nil {
-		panic("Не удалось подключиться к БД: " + err.Error())
+// Сколько ждать завершения текущих HTTP-запросов при остановке (SHUTDOWN_TIMEOUT)
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
 	}
+	return 15 * time.Second
+}
 
-	fmt.Println("Подключение к БД успешно!")
+// Сколько дней хранить журнал аудита (AUDIT_RETENTION_DAYS, по умолчанию год)
+func auditRetentionDays() int {
+	if v := os.Getenv("AUDIT_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return 365
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+// Сколько дней хранить надгробия удалённых заметок для GET /sync
+// (SYNC_TOMBSTONE_RETENTION_DAYS, по умолчанию 90)
+func tombstoneRetentionDays() int {
+	return int(envInt64("SYNC_TOMBSTONE_RETENTION_DAYS", 90))
+}
+
+// Предельный размер загружаемого для импорта файла (IMPORT_MAX_BYTES, по умолчанию 32 МБ)
+func importMaxBytes() int64 {
+	if v := os.Getenv("IMPORT_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
 	}
+	return 32 << 20
+}
 
-	if err := r.Run(":" + port); err != nil {
-		panic(err)
+// Предельный размер вложения (ATTACHMENT_MAX_BYTES, по умолчанию 10 МБ)
+func attachmentMaxBytes() int64 {
+	return envInt64("ATTACHMENT_MAX_BYTES", 10<<20)
+}
+
+// Вложения: квота на пользователя (STORAGE_QUOTA_BYTES, по умолчанию 100 МБ),
+// размер миниатюр (THUMBNAIL_SIZE) и подписанные ссылки на скачивание
+// (ATTACHMENT_URL_SECRET, ATTACHMENT_URL_TTL, PUBLIC_BASE_URL)
+func attachmentConfig() service.AttachmentConfig {
+	cfg := service.AttachmentConfig{
+		Quota:         envInt64("STORAGE_QUOTA_BYTES", 100<<20),
+		ThumbnailSize: int(envInt64("THUMBNAIL_SIZE", 256)),
+		URLSecret:     []byte(os.Getenv("ATTACHMENT_URL_SECRET")),
+		URLTTL:        15 * time.Minute,
+		BaseURL:       os.Getenv("PUBLIC_BASE_URL"),
+	}
+	if d, err := time.ParseDuration(os.Getenv("ATTACHMENT_URL_TTL")); err == nil && d > 0 {
+		cfg.URLTTL = d
+	}
+	if len(cfg.URLSecret) == 0 {
+		// ссылки будут жить до рестарта и открываться только на этой реплике
+		fmt.Println("ATTACHMENT_URL_SECRET is not set, using a random key")
+		cfg.URLSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.URLSecret); err != nil {
+			panic(err)
+		}
+	}
+	return cfg
+}
+
+// Вебхук напоминаний (REMINDER_WEBHOOK_URL; пусто — только Kafka), ключ
+// подписи REMINDER_WEBHOOK_SECRET и таймаут REMINDER_WEBHOOK_TIMEOUT (10s)
+func reminderConfig() service.ReminderConfig {
+	cfg := service.ReminderConfig{
+		WebhookURL:     os.Getenv("REMINDER_WEBHOOK_URL"),
+		WebhookSecret:  []byte(os.Getenv("REMINDER_WEBHOOK_SECRET")),
+		WebhookTimeout: 10 * time.Second,
+	}
+	if d, err := time.ParseDuration(os.Getenv("REMINDER_WEBHOOK_TIMEOUT")); err == nil && d > 0 {
+		cfg.WebhookTimeout = d
+	}
+	return cfg
+}
+
+// Приветственная заметка: имя системного шаблона (WELCOME_TEMPLATE, по
+// умолчанию welcome) и его локаль, если на языке пользователя шаблона нет
+// (WELCOME_LOCALE, ru)
+func templateConfig() service.TemplateConfig {
+	cfg := service.TemplateConfig{
+		WelcomeName:   os.Getenv("WELCOME_TEMPLATE"),
+		DefaultLocale: os.Getenv("WELCOME_LOCALE"),
+	}
+	if cfg.WelcomeName == "" {
+		cfg.WelcomeName = "welcome"
+	}
+	if cfg.DefaultLocale == "" {
+		cfg.DefaultLocale = "ru"
+	}
+	return cfg
+}
+
+func envInt64(key string, def int64) int64 {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
 	}
+	return def
 }
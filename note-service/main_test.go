@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+
+	"myproject/audit"
+	"myproject/auth"
+	"myproject/collab"
+	"myproject/dto"
+	"myproject/jobs"
+	"myproject/models"
+	"myproject/notify"
+	"myproject/openapi"
+	"myproject/repository"
+	"myproject/service"
+)
+
+// Контракт: каждая операция из openapi.yaml проходит через собранный
+// роутер с проверкой в режиме strict. Ответ, который расходится со
+// спецификацией, валидатор заменяет на 500 response_spec_mismatch.
+
+var (
+	testTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	testNote = models.Note{Id: 7, UserID: 1, Title: "t", Content: "c", Format: models.FormatPlain, DueAt: &testTime}
+)
+
+func testSyncNote() models.SyncNote {
+	return models.SyncNote{StoredNote: models.StoredNote{Note: testNote, CreatedAt: testTime, UpdatedAt: testTime}, Version: 3}
+}
+
+type fakeNotes struct{ service.NoteService }
+
+func (fakeNotes) GetNote(context.Context, int, int) (models.Note, error) { return testNote, nil }
+func (fakeNotes) GetAllNotes(context.Context, int) ([]models.Note, error) {
+	return []models.Note{testNote}, nil
+}
+func (fakeNotes) GetNotesDueBefore(context.Context, int, string) ([]models.Note, error) {
+	return []models.Note{testNote}, nil
+}
+func (fakeNotes) CreateNote(context.Context, int, dto.NoteRequest) (int, error) {
+	return testNote.Id, nil
+}
+func (fakeNotes) DeleteNote(context.Context, int, int) error { return nil }
+func (fakeNotes) UpdateNote(context.Context, int, int, dto.NoteUpdateRequest) (models.Note, error) {
+	return testNote, nil
+}
+func (fakeNotes) CountNotes(context.Context, int) (int, error) { return 1, nil }
+func (fakeNotes) BatchNotes(_ context.Context, _ int, req dto.BatchRequest) ([]service.BatchResult, bool, error) {
+	out := make([]service.BatchResult, len(req.Operations))
+	for i, op := range req.Operations {
+		out[i] = service.BatchResult{Op: op.Op, Note: testNote}
+	}
+	return out, true, nil
+}
+func (fakeNotes) ExportNotes(_ context.Context, _ int, _ string, w io.Writer) error {
+	_, err := io.WriteString(w, "[]")
+	return err
+}
+func (fakeNotes) RenderNote(context.Context, int, int) (string, error) { return "<p>c</p>", nil }
+func (fakeNotes) GetVersionedNote(context.Context, int, int) (models.SyncNote, error) {
+	return testSyncNote(), nil
+}
+
+type fakeAttachments struct{ service.AttachmentService }
+
+func testAttachment() models.Attachment {
+	return models.Attachment{
+		ID: 5, NoteID: testNote.Id, UserID: 1, FileName: "a.txt", ContentType: "text/plain",
+		Size: 1, SHA256: strings.Repeat("0", 64), CreatedAt: testTime,
+		URL: "/attachments/5/content?expires=1&sig=x", URLExpiresAt: testTime,
+	}
+}
+
+func (fakeAttachments) Upload(context.Context, int, int, string, int64, io.ReadSeeker) (models.Attachment, error) {
+	return testAttachment(), nil
+}
+func (fakeAttachments) ListAttachments(context.Context, int, int) ([]models.Attachment, error) {
+	return []models.Attachment{testAttachment()}, nil
+}
+func (fakeAttachments) GetAttachment(context.Context, int, int, int64) (models.Attachment, error) {
+	return testAttachment(), nil
+}
+func (fakeAttachments) DeleteAttachment(context.Context, int, int, int64) error { return nil }
+func (fakeAttachments) StorageUsage(context.Context, int) (models.StorageUsage, error) {
+	return models.StorageUsage{Used: 1, Quota: 100, Files: 1}, nil
+}
+func (fakeAttachments) Download(context.Context, int64, string, int64, string) (service.Download, error) {
+	return service.Download{Body: io.NopCloser(strings.NewReader("x")), ContentType: "text/plain", FileName: "a.txt", Size: 1}, nil
+}
+
+type fakeImports struct{ service.ImportService }
+
+func testImport() models.Import {
+	return models.Import{ID: 9, UserID: 1, JobID: 4, Format: "markdown", Status: models.ImportPending,
+		Errors: []models.ImportError{}, CreatedAt: testTime}
+}
+
+func (fakeImports) StartImport(context.Context, int, string, []byte) (models.Import, error) {
+	return testImport(), nil
+}
+func (fakeImports) GetImport(context.Context, int, int64) (models.Import, error) {
+	return testImport(), nil
+}
+
+type fakeSync struct{ service.SyncService }
+
+func (fakeSync) Changes(context.Context, int, string, int) (service.SyncPage, error) {
+	return service.SyncPage{
+		Notes:   []models.SyncNote{testSyncNote()},
+		Deleted: []models.Tombstone{{ID: 8, Version: 4, DeletedAt: testTime}},
+		Next:    "next",
+	}, nil
+}
+func (fakeSync) Push(_ context.Context, _ int, req dto.SyncRequest) ([]service.SyncResult, error) {
+	n := testSyncNote()
+	out := make([]service.SyncResult, len(req.Changes))
+	for i, ch := range req.Changes {
+		out[i] = service.SyncResult{Op: ch.Op, ClientID: ch.ClientID, Note: &n}
+	}
+	return out, nil
+}
+
+type fakeTemplates struct{ service.TemplateService }
+
+func testTemplate() models.Template {
+	return models.Template{ID: 2, Name: "daily", Locale: "ru", Title: "{{date}}", Content: "",
+		Format: models.FormatPlain, Fields: map[string]string{}, CreatedAt: testTime, UpdatedAt: testTime}
+}
+
+func (fakeTemplates) ListTemplates(context.Context, int, string) ([]models.Template, error) {
+	return []models.Template{testTemplate()}, nil
+}
+func (fakeTemplates) GetTemplate(context.Context, int, int64) (models.Template, error) {
+	return testTemplate(), nil
+}
+func (fakeTemplates) CreateTemplate(context.Context, int, bool, dto.TemplateRequest) (models.Template, error) {
+	return testTemplate(), nil
+}
+func (fakeTemplates) UpdateTemplate(context.Context, int, bool, int64, dto.TemplateUpdateRequest) (models.Template, error) {
+	return testTemplate(), nil
+}
+func (fakeTemplates) DeleteTemplate(context.Context, int, bool, int64) error { return nil }
+
+type fakeUsers struct{ service.UserService }
+
+func (fakeUsers) GetSettings(context.Context, int) (dto.UserSettings, error) {
+	return dto.UserSettings{Timezone: "Europe/Moscow", Locale: "ru"}, nil
+}
+func (fakeUsers) UpdateSettings(_ context.Context, _ int, req dto.UserSettings) (dto.UserSettings, error) {
+	return req, nil
+}
+
+type contractCase struct {
+	method, route string // операция в спецификации
+	path          string
+	contentType   string
+	body          string
+	status        int
+	// поток: SSE читается до таймаута, WebSocket открывается настоящим рукопожатием
+	stream, ws bool
+	// заглушки SQL для маршрутов на репозиториях
+	sql func(sqlmock.Sqlmock)
+}
+
+func TestContractStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// user-service: токен тестового админа активен
+	introspection := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"active": true, "token_type": "jwt", "user_id": 1, "role": auth.RoleAdmin, "scopes": auth.AllScopes,
+		})
+	}))
+	defer introspection.Close()
+	t.Setenv("USER_SERVICE_URL", introspection.URL)
+	token, err := auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Redis недоступен: поток заметок работает без журнала, а совместное
+	// редактирование отвечает 503 до апгрейда
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+	notes := fakeNotes{}
+
+	r, err := newRouter(api{
+		broker:      notify.NewBroker(rdb),
+		notes:       notes,
+		auditor:     audit.NewRecorder(repository.CreateAuditRepository(db)),
+		imports:     fakeImports{},
+		queue:       jobs.NewQueue(repository.CreateJobRepository(db)),
+		attachments: fakeAttachments{},
+		sync:        fakeSync{},
+		collab:      collab.NewHub(rdb, notes),
+		templates:   fakeTemplates{},
+		users:       fakeUsers{},
+	}, openapi.ValidateStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditRows := func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(regexp.QuoteMeta("FROM audit_log")).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "actor_id", "user_id", "action", "target_type", "target_id",
+			"request_id", "ip", "user_agent", "before_hash", "after_hash", "created_at",
+		}).AddRow(1, 1, 1, "note.create", "note", "7", "rid", "127.0.0.1", "ua", "", "h", testTime))
+	}
+	jobRow := func(status string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{
+			"id", "user_id", "kind", "payload", "status", "attempts", "max_attempts",
+			"progress", "total", "error", "cancel_requested", "run_at", "created_at", "started_at", "finished_at",
+		}).AddRow(4, 1, "import", []byte("{}"), status, 0, 3, 0, 0, "", false, testTime, testTime, nil, nil)
+	}
+
+	cases := []contractCase{
+		{method: "GET", route: "/health", path: "/health", status: 200},
+		{method: "GET", route: "/notes", path: "/notes", status: 200},
+		{method: "GET", route: "/notes", path: "/notes?due_before=2026-02-01T00:00:00Z", status: 200},
+		{method: "POST", route: "/notes", path: "/notes", contentType: "application/json",
+			body: `{"title":"t","content":"c","due_at":"2026-02-01T10:00:00Z"}`, status: 201},
+		{method: "POST", route: "/notes/batch", path: "/notes/batch", contentType: "application/json",
+			body: `{"mode":"atomic","operations":[{"op":"create","title":"t"},{"op":"update","id":7,"due_at":null}]}`, status: 200},
+		{method: "GET", route: "/notes/export", path: "/notes/export?format=json", status: 200},
+		{method: "POST", route: "/notes/import", path: "/notes/import", status: 202},
+		{method: "GET", route: "/notes/stream", path: "/notes/stream", status: 200, stream: true},
+		{method: "GET", route: "/notes/ws", path: "/notes/ws", status: 101, ws: true},
+		{method: "GET", route: "/notes/{id}", path: "/notes/7", status: 200},
+		{method: "GET", route: "/notes/{id}", path: "/notes/7?render=html", status: 200},
+		{method: "PATCH", route: "/notes/{id}", path: "/notes/7", contentType: "application/json",
+			body: `{"title":"t2","remind_at":null}`, status: 200},
+		{method: "DELETE", route: "/notes/{id}", path: "/notes/7", status: 204},
+		{method: "GET", route: "/notes/{id}/collab", path: "/notes/7/collab", status: 503},
+		{method: "POST", route: "/notes/{id}/attachments", path: "/notes/7/attachments", status: 201},
+		{method: "GET", route: "/notes/{id}/attachments", path: "/notes/7/attachments", status: 200},
+		{method: "GET", route: "/notes/{id}/attachments/{aid}", path: "/notes/7/attachments/5", status: 200},
+		{method: "DELETE", route: "/notes/{id}/attachments/{aid}", path: "/notes/7/attachments/5", status: 204},
+		{method: "GET", route: "/attachments/{id}/content", path: "/attachments/5/content?expires=1&sig=x", status: 200},
+		{method: "GET", route: "/attachments/{id}/thumbnail", path: "/attachments/5/thumbnail?expires=1&sig=x", status: 200},
+		{method: "GET", route: "/templates", path: "/templates?locale=ru", status: 200},
+		{method: "POST", route: "/templates", path: "/templates", contentType: "application/json",
+			body: `{"name":"daily","title":"{{date}}"}`, status: 201},
+		{method: "GET", route: "/templates/{id}", path: "/templates/2", status: 200},
+		{method: "PATCH", route: "/templates/{id}", path: "/templates/2", contentType: "application/json",
+			body: `{"name":"daily2"}`, status: 200},
+		{method: "DELETE", route: "/templates/{id}", path: "/templates/2", status: 204},
+		{method: "GET", route: "/sync", path: "/sync?limit=10", status: 200},
+		{method: "POST", route: "/sync", path: "/sync", contentType: "application/json",
+			body: `{"changes":[{"op":"create","client_id":"c1","title":"t"}]}`, status: 200},
+		{method: "GET", route: "/imports/{id}", path: "/imports/9", status: 200},
+		{method: "GET", route: "/jobs", path: "/jobs", status: 200, sql: func(m sqlmock.Sqlmock) {
+			m.ExpectQuery(regexp.QuoteMeta("FROM jobs")).WillReturnRows(jobRow(models.JobQueued))
+		}},
+		{method: "GET", route: "/jobs/{id}", path: "/jobs/4", status: 200, sql: func(m sqlmock.Sqlmock) {
+			m.ExpectQuery(regexp.QuoteMeta("FROM jobs")).WillReturnRows(jobRow(models.JobQueued))
+		}},
+		{method: "POST", route: "/jobs/{id}/cancel", path: "/jobs/4/cancel", status: 202, sql: func(m sqlmock.Sqlmock) {
+			m.ExpectQuery(regexp.QuoteMeta("UPDATE jobs")).WillReturnRows(jobRow(models.JobRunning))
+		}},
+		{method: "GET", route: "/users/me/audit", path: "/users/me/audit?limit=10", status: 200, sql: auditRows},
+		{method: "GET", route: "/users/me/storage", path: "/users/me/storage", status: 200},
+		{method: "GET", route: "/users/me/settings", path: "/users/me/settings", status: 200},
+		{method: "PATCH", route: "/users/me/settings", path: "/users/me/settings", contentType: "application/json",
+			body: `{"timezone":"Europe/Moscow","locale":"ru"}`, status: 200},
+		{method: "GET", route: "/admin/audit", path: "/admin/audit?user_id=1", status: 200, sql: auditRows},
+		{method: "GET", route: "/admin/users/{id}/notes/count", path: "/admin/users/1/notes/count", status: 200},
+		{method: "GET", route: "/admin/cache/stats", path: "/admin/cache/stats", status: 200},
+		{method: "POST", route: "/admin/templates", path: "/admin/templates", contentType: "application/json",
+			body: `{"name":"welcome","locale":"en","title":"Hi"}`, status: 201},
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := map[string]bool{}
+	for _, c := range cases {
+		covered[c.method+" "+c.route] = true
+	}
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			if !covered[method+" "+path] {
+				t.Errorf("operation %s %s has no contract case", method, path)
+			}
+		}
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			if c.sql != nil {
+				c.sql(mock)
+			}
+			body, contentType := c.body, c.contentType
+			switch c.route {
+			case "/notes/import":
+				body, contentType = multipartFile(t, "notes.zip", []byte("PK"), map[string]string{"format": "markdown"})
+			case "/notes/{id}/attachments":
+				body, contentType = multipartFile(t, "a.txt", []byte("x"), nil)
+			}
+
+			if c.ws {
+				srv := httptest.NewServer(r)
+				defer srv.Close()
+				conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+c.path,
+					http.Header{"Authorization": {"Bearer " + token}})
+				if err != nil {
+					if resp == nil {
+						t.Fatalf("dial: %v", err)
+					}
+					// отказ до апгрейда: ответ есть, сверяем его статус
+					if resp.StatusCode != c.status {
+						t.Fatalf("status %d, want %d: %v", resp.StatusCode, c.status, err)
+					}
+					return
+				}
+				conn.Close()
+				if resp.StatusCode != c.status {
+					t.Fatalf("status %d, want %d", resp.StatusCode, c.status)
+				}
+				return
+			}
+
+			timeout := 5 * time.Second
+			if c.stream {
+				timeout = 200 * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(body)).WithContext(ctx)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if !strings.HasPrefix(c.route, "/attachments/") && c.route != "/health" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.status, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func multipartFile(t *testing.T, name string, data []byte, fields map[string]string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+	return buf.String(), mw.FormDataContentType()
+}
@@ -0,0 +1,101 @@
+// Package media — миниатюры картинок из вложений. Поддерживаются PNG, JPEG,
+// GIF (первый кадр) и WebP; остальное миниатюр не получает.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupported = errors.New("not a supported image")
+	// защита от «бомб»: крошечный файл с гигантскими размерами съест память
+	ErrTooLarge = errors.New("image dimensions too large")
+)
+
+// maxPixels — больше не декодируем (≈ 8000×6000)
+const maxPixels = 50_000_000
+
+// IsImage — есть ли смысл строить миниатюру для такого типа
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Thumbnail — картинка, не больше size по длинной стороне
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	// размеры исходной картинки
+	Width, Height int
+}
+
+// Make уменьшает картинку из r; формат результата — ThumbnailType.
+// Картинки меньше size не увеличиваются.
+func Make(r io.ReadSeeker, contentType string, size int) (Thumbnail, error) {
+	if !IsImage(contentType) {
+		return Thumbnail{}, ErrUnsupported
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return Thumbnail{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return Thumbnail{}, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Thumbnail{}, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return Thumbnail{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	w, h := fit(cfg.Width, cfg.Height, size)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	t := Thumbnail{ContentType: ThumbnailType(contentType), Width: cfg.Width, Height: cfg.Height}
+	if t.ContentType == "image/png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return Thumbnail{}, fmt.Errorf("media: encode thumbnail: %w", err)
+	}
+	t.Data = buf.Bytes()
+	return t, nil
+}
+
+// ThumbnailType — тип миниатюры для картинки такого типа
+func ThumbnailType(contentType string) string {
+	if contentType == "image/png" || contentType == "image/gif" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// fit вписывает w×h в квадрат size с сохранением пропорций
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
@@ -1,45 +1,143 @@
 package midleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"myproject/auth" // <-- ПОДСТАВЬ свой module path из note-service/go.mod
+	"myproject/internal/logger"
+	"myproject/problem"
 )
 
 // ключ, под которым будем класть user_id в контекст
 const userIDContextKey = "userID"
 
+// ключи для scope'ов токена и роли пользователя
+const (
+	scopesContextKey = "scopes"
+	roleContextKey   = "role"
+	// сам токен и его срок — для долгих соединений, см. Revalidate
+	tokenContextKey  = "token"
+	expiryContextKey = "tokenExpiry"
+)
+
+// AuthMiddleware принимает JWT из user-service и персональные токены (PAT)
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if header == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "missing Authorization header"))
 			return
 		}
 
 		parts := strings.SplitN(header, " ", 2)
 		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header"})
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid Authorization header"))
 			return
 		}
 		tokenStr := parts[1]
 
-		userID, err := auth.ParseToken(tokenStr)
+		p, err := auth.Authenticate(c.Request.Context(), tokenStr)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			if errors.Is(err, auth.ErrIntrospection) {
+				logger.Errorf("token introspection: %v", err)
+				problem.Write(c, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, "token verification unavailable"))
+				return
+			}
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid token"))
 			return
 		}
 
 		// кладём userID в контекст
-		c.Set(userIDContextKey, userID)
+		c.Set(userIDContextKey, p.UserID)
+		c.Set(scopesContextKey, p.Scopes)
+		c.Set(roleContextKey, p.Role)
+		c.Set(tokenContextKey, tokenStr)
+		c.Set(expiryContextKey, p.ExpiresAt)
+
+		c.Next()
+	}
+}
+
+// Revalidate заново проверяет токен, с которым открыто долгое соединение
+// (SSE, WebSocket): его могли отозвать, пользователя — заблокировать, а
+// срок — истечь. Если user-service недоступен, соединение живёт до срока
+// токена: обрывать всех клиентов из-за сбоя проверки незачем.
+func Revalidate(c *gin.Context, scope string) error {
+	if exp := TokenExpiry(c); !exp.IsZero() && !time.Now().Before(exp) {
+		return auth.ErrInvalidToken
+	}
+	token := c.GetString(tokenContextKey)
+	p, err := auth.Authenticate(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, auth.ErrIntrospection) {
+			logger.Errorf("token introspection: %v", err)
+			return nil
+		}
+		return err
+	}
+	if userID, _ := GetUserID(c); p.UserID != userID || !p.HasScope(scope) {
+		return auth.ErrInvalidToken
+	}
+	return nil
+}
 
+// TokenExpiry — срок токена запроса; нулевой, если срока нет
+func TokenExpiry(c *gin.Context) time.Time {
+	v, _ := c.Get(expiryContextKey)
+	exp, _ := v.(time.Time)
+	return exp
+}
+
+// TokenFromQuery ставится перед AuthMiddleware на потоковых маршрутах:
+// EventSource и WebSocket в браузере не умеют слать заголовок Authorization,
+// поэтому токен можно передать параметром access_token
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("access_token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
 		c.Next()
 	}
 }
 
+// RequireScope ставится после AuthMiddleware и проверяет права токена на маршрут
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, _ := c.Get(scopesContextKey)
+		scopes, _ := v.([]string)
+
+		p := auth.Principal{Scopes: scopes}
+		if !p.HasScope(scope) {
+			p := problem.New(http.StatusForbidden, "insufficient_scope", "insufficient scope")
+			p.RequiredScope = scope
+			problem.Write(c, p)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole пропускает только пользователей с одной из указанных ролей
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetRole(c)
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		problem.Write(c, problem.New(http.StatusForbidden, problem.CodeForbidden, "forbidden"))
+	}
+}
+
 // Хелпер для хендлеров
 func GetUserID(c *gin.Context) (int, bool) {
 	v, ok := c.Get(userIDContextKey)
@@ -49,3 +147,9 @@ func GetUserID(c *gin.Context) (int, bool) {
 	id, ok := v.(int)
 	return id, ok
 }
+
+func GetRole(c *gin.Context) string {
+	v, _ := c.Get(roleContextKey)
+	role, _ := v.(string)
+	return role
+}
@@ -1,6 +1,8 @@
 package midleware
 
 import (
+	"myproject/audit"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -17,6 +19,13 @@ func RequestID() gin.HandlerFunc {
 		ctx.Set(RequestIDKey, rid)
 		ctx.Writer.Header().Set("X-Request-ID", rid)
 
+		// те же данные нужны сервисному слою для журнала аудита
+		ctx.Request = ctx.Request.WithContext(audit.WithMeta(ctx.Request.Context(), audit.Meta{
+			RequestID: rid,
+			IP:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		}))
+
 		ctx.Next()
 	}
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Attachment — файл, прикреплённый к заметке. Ссылки на скачивание подписаны
+// и действуют до URLExpiresAt; их выдаёт сервис при каждом чтении.
+type Attachment struct {
+	ID           int64     `json:"id"`
+	NoteID       int       `json:"note_id"`
+	UserID       int       `json:"user_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	BlobKey      string    `json:"-"`
+	ThumbKey     string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	URLExpiresAt time.Time `json:"url_expires_at"`
+}
+
+// StorageUsage — сколько места занимают вложения пользователя
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+	Files int   `json:"files"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Состояния задания импорта
+const (
+	ImportPending  = "pending"
+	ImportRunning  = "running"
+	ImportDone     = "done"
+	ImportFailed   = "failed"
+	ImportCanceled = "canceled"
+)
+
+// ImportError — файл (или заметка ENEX), который не удалось импортировать
+type ImportError struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+type Import struct {
+	ID         int64         `json:"id"`
+	UserID     int           `json:"user_id"`
+	JobID      int64         `json:"job_id,omitempty"`
+	Format     string        `json:"format"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Created    int           `json:"created"`
+	Duplicates int           `json:"duplicates"`
+	Failed     int           `json:"failed"`
+	Errors     []ImportError `json:"errors"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
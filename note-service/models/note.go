@@ -1,8 +1,28 @@
 package models
 
+import "time"
+
+// Форматы текста заметки
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// DueAt — срок заметки-задачи, RemindAt — когда напомнить о ней (см.
+// service.JobNoteReminder); nil — не заданы
 type Note struct {
-	Id      int    `json:"id"`
-	UserID  int    `json:"user_id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Id       int        `json:"id"`
+	UserID   int        `json:"user_id"`
+	Title    string     `json:"title"`
+	Content  string     `json:"content"`
+	Format   string     `json:"format"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	RemindAt *time.Time `json:"remind_at,omitempty"`
+}
+
+// StoredNote — заметка вместе со служебными полями из БД (для экспорта)
+type StoredNote struct {
+	Note
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Reminder — событие note_reminder. Доставка — «хотя бы раз»: у повторов
+// одного напоминания одинаковый ID, по нему получатели отбрасывают дубли.
+// LocalTime — RemindAt в часовом поясе пользователя (RFC 3339).
+type Reminder struct {
+	ID        string     `json:"reminder_id"`
+	NoteID    int        `json:"note_id"`
+	UserID    int        `json:"user_id"`
+	Title     string     `json:"title"`
+	RemindAt  time.Time  `json:"remind_at"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+	Timezone  string     `json:"timezone"`
+	LocalTime string     `json:"local_time"`
+	Email     string     `json:"email,omitempty"`
+	Locale    string     `json:"locale,omitempty"`
+}
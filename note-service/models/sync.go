@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SyncNote — заметка для синхронизации. Version — позиция её последнего
+// изменения в последовательности пользователя; клиент присылает её как
+// base_version, когда меняет заметку.
+type SyncNote struct {
+	StoredNote
+	Version int64 `json:"version"`
+}
+
+// Tombstone — удалённая заметка
+type Tombstone struct {
+	ID        int       `json:"id"`
+	Version   int64     `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
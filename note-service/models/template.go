@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Template — шаблон заметки. System — системный шаблон (общий для всех);
+// Fields — поля шаблона ({{имя}}) со значениями по умолчанию.
+type Template struct {
+	ID        int64             `json:"id"`
+	UserID    int               `json:"-"`
+	System    bool              `json:"system"`
+	Name      string            `json:"name"`
+	Locale    string            `json:"locale"`
+	Title     string            `json:"title"`
+	Content   string            `json:"content"`
+	Format    string            `json:"format"`
+	Fields    map[string]string `json:"fields"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
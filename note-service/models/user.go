@@ -0,0 +1,11 @@
+package models
+
+// UserProfile — данные пользователя, нужные note-service: email и locale
+// приходят из user-service, timezone (IANA, например Europe/Moscow) задаёт
+// сам пользователь; пусто — UTC
+type UserProfile struct {
+	UserID   int
+	Email    string
+	Locale   string
+	Timezone string
+}
@@ -0,0 +1,228 @@
+// Package notify доставляет клиентам изменения их заметок в реальном
+// времени (SSE и WebSocket). Событие пишется в короткий журнал пользователя
+// в Redis (stream) и одновременно публикуется в pub/sub-канал; каждая
+// реплика слушает канал и раздаёт события своим подключениям. По
+// Last-Event-ID переподключившийся клиент дочитывает пропущенное из журнала.
+//
+// Раскладка в Redis:
+//
+//	events:{userID}  — STREAM последних событий пользователя (MAXLEN ~ NOTIFY_LOG_SIZE)
+//	notes:events     — канал: "userID streamID json"
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"myproject/internal/logger"
+	"myproject/models"
+)
+
+// Типы событий
+const (
+	NoteCreated = "note.created"
+	NoteUpdated = "note.updated"
+	NoteDeleted = "note.deleted"
+	// журнал не покрывает Last-Event-ID клиента: часть событий потеряна,
+	// список заметок нужно перечитать целиком
+	Reset = "reset"
+	// последнее событие потока: токен истёк или отозван; переподключаться
+	// нужно с новым токеном
+	Unauthorized = "unauthorized"
+)
+
+const (
+	channel = "notes:events"
+	// запись события не должна задерживать ответ на запрос
+	publishTimeout = 500 * time.Millisecond
+)
+
+var ErrUnavailable = errors.New("notifications unavailable")
+
+// Event — изменение заметки. ID — id записи журнала, его клиент присылает
+// в Last-Event-ID. У note.deleted заметки нет, только NoteID.
+type Event struct {
+	ID     string       `json:"id"`
+	Type   string       `json:"type"`
+	NoteID int          `json:"note_id,omitempty"`
+	Note   *models.Note `json:"note,omitempty"`
+	At     time.Time    `json:"at"`
+}
+
+// XADD и PUBLISH одним скриптом: порядок id в журнале совпадает с порядком
+// доставки через канал
+var publishScript = redis.NewScript(`
+local id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'e', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PUBLISH', ARGV[4], ARGV[5] .. ' ' .. id .. ' ' .. ARGV[2])
+return id
+`)
+
+type Broker struct {
+	client  redis.UniversalClient
+	logSize int
+	logTTL  time.Duration
+	buffer  int
+
+	mu      sync.Mutex
+	subs    map[int]map[*Subscription]struct{}
+	stopped bool
+}
+
+// NewBroker — настройки из окружения: NOTIFY_LOG_SIZE (сколько событий
+// пользователя хранить для дочитывания, по умолчанию 1000), NOTIFY_LOG_TTL
+// (24h), NOTIFY_BUFFER (очередь подключения; кто не успевает её
+// разбирать, отключается и дочитывает по Last-Event-ID; 64)
+func NewBroker(client redis.UniversalClient) *Broker {
+	return &Broker{
+		client:  client,
+		logSize: getInt("NOTIFY_LOG_SIZE", 1000),
+		logTTL:  getDuration("NOTIFY_LOG_TTL", 24*time.Hour),
+		buffer:  getInt("NOTIFY_BUFFER", 64),
+		subs:    make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+func logKey(userID int) string {
+	return fmt.Sprintf("events:{%d}", userID)
+}
+
+// Publish записывает событие в журнал и рассылает его. Ошибка только
+// логируется: изменение уже сохранено, а клиенты без события дочитают
+// его при следующем полном обновлении.
+func (b *Broker) Publish(ctx context.Context, userID int, ev Event) {
+	if b == nil || userID <= 0 {
+		return
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	ev.ID = ""
+	data, err := json.Marshal(ev)
+	if err != nil {
+		logger.Errorf("notify user=%d: marshal %s: %v", userID, ev.Type, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+	err = publishScript.Run(ctx, b.client, []string{logKey(userID)},
+		b.logSize, data, b.logTTL.Milliseconds(), channel, userID).Err()
+	if err != nil {
+		logger.Errorf("notify user=%d: publish %s note=%d: %v", userID, ev.Type, ev.NoteID, err)
+	}
+}
+
+// Run слушает канал и раздаёт события подключениям этой реплики, пока жив
+// ctx; затем закрывает все подписки, чтобы потоки завершились вместе с
+// сервисом. События, пришедшие, пока связь с Redis рвалась, до открытых
+// подключений не дойдут — их клиент дочитает после переподключения.
+func (b *Broker) Run(ctx context.Context) {
+	defer b.stop()
+
+	sub := b.client.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			userID, ev, err := parseMessage(m.Payload)
+			if err != nil {
+				logger.Errorf("notify: bad message: %v", err)
+				continue
+			}
+			b.dispatch(userID, ev)
+		}
+	}
+}
+
+func parseMessage(payload string) (int, Event, error) {
+	userPart, rest, ok1 := strings.Cut(payload, " ")
+	id, data, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return 0, Event{}, fmt.Errorf("malformed payload %.40q", payload)
+	}
+	userID, err := strconv.Atoi(userPart)
+	if err != nil {
+		return 0, Event{}, err
+	}
+	ev, err := decodeEvent(id, data)
+	return userID, ev, err
+}
+
+func decodeEvent(id, data string) (Event, error) {
+	var ev Event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		return Event{}, err
+	}
+	ev.ID = id
+	return ev, nil
+}
+
+func (b *Broker) dispatch(userID int, ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[userID] {
+		select {
+		case s.live <- ev:
+		default:
+			// медленный клиент не должен тормозить остальных
+			b.remove(s)
+		}
+	}
+}
+
+func (b *Broker) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopped = true
+	for _, set := range b.subs {
+		for s := range set {
+			b.remove(s)
+		}
+	}
+}
+
+// remove вызывается под b.mu
+func (b *Broker) remove(s *Subscription) {
+	set := b.subs[s.userID]
+	if _, ok := set[s]; !ok {
+		return
+	}
+	delete(set, s)
+	if len(set) == 0 {
+		delete(b.subs, s.userID)
+	}
+	close(s.live)
+}
+
+func getDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+func getInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
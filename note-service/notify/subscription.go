@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subscription — поток событий одного подключения: сначала пропущенное из
+// журнала, затем новые события. Events закрывается, когда подписку закрыли,
+// клиент не успевал читать или сервис останавливается.
+type Subscription struct {
+	userID int
+	broker *Broker
+	live   chan Event
+	out    chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Subscribe подписывает подключение пользователя. lastID — Last-Event-ID
+// клиента; пусто — только новые события. Если журнал уже не содержит
+// lastID, первым придёт событие Reset.
+func (b *Broker) Subscribe(ctx context.Context, userID int, lastID string) (*Subscription, error) {
+	s := &Subscription{
+		userID: userID,
+		broker: b,
+		live:   make(chan Event, b.buffer),
+		out:    make(chan Event),
+		done:   make(chan struct{}),
+	}
+
+	// подписываемся до чтения журнала, чтобы не потерять событие между
+	// ними; повторы отсеет forward
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return nil, ErrUnavailable
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][s] = struct{}{}
+	b.mu.Unlock()
+
+	backlog, err := b.replay(ctx, userID, lastID)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	go s.forward(backlog, lastID)
+	return s, nil
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.out
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.broker.mu.Lock()
+		s.broker.remove(s)
+		s.broker.mu.Unlock()
+	})
+}
+
+func (s *Subscription) forward(backlog []Event, last string) {
+	defer close(s.out)
+	for _, ev := range backlog {
+		if !s.send(ev) {
+			return
+		}
+		if ev.ID != "" {
+			last = ev.ID
+		}
+	}
+	for ev := range s.live {
+		if last != "" && !idAfter(ev.ID, last) {
+			continue
+		}
+		if !s.send(ev) {
+			return
+		}
+		last = ev.ID
+	}
+}
+
+func (s *Subscription) send(ev Event) bool {
+	select {
+	case s.out <- ev:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// replay читает из журнала события после lastID
+func (b *Broker) replay(ctx context.Context, userID int, lastID string) ([]Event, error) {
+	if lastID == "" {
+		return nil, nil
+	}
+	reset := []Event{{Type: Reset, At: time.Now().UTC()}}
+	if _, _, ok := parseID(lastID); !ok {
+		return reset, nil
+	}
+
+	// диапазон включает сам lastID: так видно, что журнал его ещё помнит
+	msgs, err := b.client.XRange(ctx, logKey(userID), lastID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 || msgs[0].ID != lastID {
+		// журнал обрезан или истёк; продолжать клиент будет с последнего события
+		if len(msgs) > 0 {
+			reset[0].ID = msgs[len(msgs)-1].ID
+		}
+		return reset, nil
+	}
+
+	events := make([]Event, 0, len(msgs)-1)
+	for _, m := range msgs[1:] {
+		data, _ := m.Values["e"].(string)
+		ev, err := decodeEvent(m.ID, data)
+		if err != nil {
+			return nil, fmt.Errorf("decode event %s: %w", m.ID, err)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// idAfter сравнивает id записей stream ("ms-seq")
+func idAfter(a, b string) bool {
+	am, as, _ := parseID(a)
+	bm, bs, _ := parseID(b)
+	return am > bm || (am == bm && as > bs)
+}
+
+func parseID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err1 := strconv.ParseUint(msPart, 10, 64)
+	seq, err2 := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq, err1 == nil && err2 == nil
+}
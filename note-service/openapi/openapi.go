@@ -0,0 +1,253 @@
+// Package openapi хранит контракт REST API (openapi.yaml), отдаёт его
+// клиентам и умеет сверять с ним живые запросы и ответы.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+
+	"myproject/internal/logger"
+	"myproject/midleware"
+	"myproject/problem"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+// Режимы проверки (OPENAPI_VALIDATE)
+const (
+	ValidateOff      = ""
+	ValidateRequests = "requests" // только запросы — безопасно и для прода
+	ValidateStrict   = "strict"   // запросы и ответы — для dev и CI
+)
+
+// отрендеренная заметка (GET /notes/{id}?render=html) сверяется как строка
+func init() {
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.PlainBodyDecoder)
+}
+
+// Load разбирает встроенную спецификацию и проверяет, что она корректна
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: load: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("openapi: invalid spec: %w", err)
+	}
+	return doc, nil
+}
+
+// ModeFromEnv читает OPENAPI_VALIDATE; неизвестное значение считаем strict,
+// чтобы опечатка в CI не выключала проверку молча
+func ModeFromEnv() string {
+	switch v := os.Getenv("OPENAPI_VALIDATE"); v {
+	case "", "off", "false", "0":
+		return ValidateOff
+	case ValidateRequests:
+		return ValidateRequests
+	default:
+		return ValidateStrict
+	}
+}
+
+// Register вешает GET /openapi.json и Swagger UI на /docs
+func Register(r gin.IRouter, doc *openapi3.T) error {
+	spec, err := doc.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("openapi: marshal: %w", err)
+	}
+	r.GET("/openapi.json", func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json", spec)
+	})
+	r.GET("/docs", func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUI)
+	})
+	return nil
+}
+
+// Validator сверяет запросы (и в режиме strict — ответы) со спецификацией.
+// Маршруты, которых в спецификации нет, пропускаются: им ответит сам gin.
+func Validator(doc *openapi3.T, mode string) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: router: %w", err)
+	}
+	opts := &openapi3filter.Options{
+		// токены проверяет AuthMiddleware, здесь нужна только форма запроса
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(ctx *gin.Context) {
+		if mode == ValidateOff {
+			ctx.Next()
+			return
+		}
+
+		route, params, err := router.FindRoute(ctx.Request)
+		if err != nil {
+			if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+				ctx.Next()
+				return
+			}
+			abortInvalid(ctx, err)
+			return
+		}
+
+		// x-stream: тело запроса или ответа идёт потоком и может быть большим —
+		// его не буферизуем и со схемой не сверяем; параметры проверяются как обычно
+		stream := route.Operation.Extensions["x-stream"] == true
+		in := &openapi3filter.RequestValidationInput{
+			Request:    ctx.Request,
+			PathParams: params,
+			Route:      route,
+			Options:    opts,
+		}
+		if stream {
+			streamOpts := *opts
+			streamOpts.ExcludeRequestBody = true
+			in.Options = &streamOpts
+		}
+		if err := openapi3filter.ValidateRequest(ctx.Request.Context(), in); err != nil {
+			abortInvalid(ctx, err)
+			return
+		}
+
+		if mode != ValidateStrict || stream {
+			ctx.Next()
+			return
+		}
+
+		// ответ копим в буфере: если он расходится со спецификацией,
+		// клиент вместо него получит 500
+		w := &bufferedWriter{ResponseWriter: ctx.Writer, status: http.StatusOK}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		err = openapi3filter.ValidateResponse(ctx.Request.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: in,
+			Status:                 w.status,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(w.body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			logger.Errorf("request_id=%s openapi: response %s %s %d does not match spec: %v",
+				requestID(ctx), ctx.Request.Method, route.Path, w.status, err)
+			p := problem.New(http.StatusInternalServerError, "response_spec_mismatch", "response does not match API spec")
+			p.RequestID = requestID(ctx)
+			p.Instance = ctx.Request.URL.Path
+			body, _ := json.Marshal(p)
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Type", problem.ContentType)
+			w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.ResponseWriter.Write(body)
+			return
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}, nil
+}
+
+func abortInvalid(ctx *gin.Context, err error) {
+	logger.Errorf("request_id=%s openapi: invalid request: %v", requestID(ctx), err)
+	problem.Write(ctx, requestProblem(err))
+}
+
+// Клиенту отдаём только причину и поле, без дампа схемы
+func requestProblem(err error) *problem.Problem {
+	var re *openapi3filter.RequestError
+	if !errors.As(err, &re) {
+		return problem.New(http.StatusBadRequest, problem.CodeValidation, "request does not match API spec")
+	}
+
+	var se *openapi3.SchemaError
+	hasSchemaErr := errors.As(re.Err, &se)
+	reason := re.Reason
+	if hasSchemaErr {
+		reason = se.Reason
+	} else if reason == "" && re.Err != nil {
+		reason = re.Err.Error()
+	}
+
+	switch {
+	case re.Parameter != nil:
+		return problem.Invalid(re.Parameter.Name, "invalid", reason)
+	case re.RequestBody != nil:
+		field := "body"
+		if hasSchemaErr {
+			if ptr := se.JSONPointer(); len(ptr) > 0 {
+				field = strings.Join(ptr, ".")
+			}
+		}
+		if !hasSchemaErr && re.Err != nil {
+			// тело не разобралось как JSON вовсе
+			return problem.New(http.StatusBadRequest, problem.CodeInvalidJSON, "invalid JSON: "+reason)
+		}
+		return problem.Invalid(field, "invalid", reason)
+	}
+	return problem.New(http.StatusBadRequest, problem.CodeValidation, reason)
+}
+
+func requestID(ctx *gin.Context) string {
+	return ctx.GetString(midleware.RequestIDKey)
+}
+
+// bufferedWriter придерживает статус и тело до проверки ответа
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
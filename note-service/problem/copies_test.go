@@ -0,0 +1,26 @@
+package problem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Копия пакета в user-service должна совпадать с этой с точностью до пути
+// модуля. Вне репозитория (например, в образе Docker) проверка пропускается.
+func TestSameAsUserService(t *testing.T) {
+	other := filepath.Join("..", "..", "user-service", "problem", "problem.go")
+	theirs, err := os.ReadFile(other)
+	if err != nil {
+		t.Skip("user-service not found next to note-service")
+	}
+	mine, err := os.ReadFile("problem.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs = bytes.ReplaceAll(theirs, []byte(`"user-service/`), []byte(`"myproject/`))
+	if !bytes.Equal(mine, theirs) {
+		t.Error("problem.go differs from user-service/problem/problem.go")
+	}
+}
@@ -0,0 +1,62 @@
+package problem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"myproject/validation"
+)
+
+func TestValidationErrorsInOneResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type dto struct {
+		Title string `json:"title" validate:"notblank"`
+		Kind  string `json:"kind" validate:"oneof=a b"`
+		Email string `json:"email" validate:"email"`
+	}
+	err := fmt.Errorf("service: %w", validation.Struct(dto{Kind: "c", Email: "a@"}))
+
+	p, ok := Table{}.Lookup(err)
+	if !ok {
+		t.Fatalf("Lookup(%v) found nothing", err)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/x", nil)
+	Write(c, p)
+
+	var got Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || got.Code != CodeValidation || got.Detail != "request has invalid fields" {
+		t.Fatalf("status %d, problem %+v", w.Code, got)
+	}
+	want := []FieldError{
+		{Field: "title", Code: "required", Message: "title is required"},
+		{Field: "kind", Code: "invalid", Message: "kind must be one of: a, b"},
+		{Field: "email", Code: "invalid", Message: "email is not a valid email address"},
+	}
+	if len(got.Errors) != len(want) {
+		t.Fatalf("errors %+v, want %+v", got.Errors, want)
+	}
+	for i := range want {
+		if got.Errors[i] != want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, got.Errors[i], want[i])
+		}
+	}
+}
+
+func TestSingleViolationDetail(t *testing.T) {
+	p := FromValidation(&validation.Error{Violations: []validation.Violation{
+		{Field: "title", Code: "required", Message: "title is required"},
+	}})
+	if p.Detail != "title is required" || len(p.Errors) != 1 {
+		t.Fatalf("problem %+v", p)
+	}
+}
@@ -0,0 +1,5 @@
+// Package proto содержит описания gRPC-API и сгенерированный из них код.
+// Для перегенерации нужны protoc, protoc-gen-go и protoc-gen-go-grpc.
+package proto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative notes/v1/notes.proto
@@ -0,0 +1,94 @@
+// Package render превращает текст заметки в безопасный HTML: markdown
+// рендерится по CommonMark с расширениями GFM (таблицы, списки задач,
+// зачёркивание, автоссылки) и подсветкой кода, затем всё проходит через
+// санитайзер — в заметке может оказаться что угодно.
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+
+	"myproject/models"
+)
+
+// Version меняется вместе с правилами рендера или санитайзера: от неё
+// зависит ключ кэша, и старые результаты просто перестают находиться
+const Version = "1"
+
+var ErrUnknownFormat = errors.New("format must be one of: plain, markdown")
+
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			// цвета — классами (.chroma .k и т.п.), стили подключает клиент:
+			// инлайновые style санитайзер всё равно бы вырезал
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+	// сырой HTML goldmark по умолчанию не пропускает; id заголовков — для якорей
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// классы подсветки и language-* у блоков кода
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9_ -]+$`)).OnElements("pre", "code", "span", "div")
+	// чекбоксы списков задач; отмечать их в отрендеренной заметке нельзя
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	// ссылки из заметки уводят с сайта
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+func Valid(format string) bool {
+	return format == models.FormatPlain || format == models.FormatMarkdown
+}
+
+// HTML — фрагмент для вставки в страницу. Простой текст экранируется и
+// остаётся как есть, в <pre>.
+func HTML(format, content string) (string, error) {
+	switch format {
+	case models.FormatPlain, "":
+		return `<pre class="note-plain">` + html.EscapeString(content) + "</pre>", nil
+	case models.FormatMarkdown:
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(content), &buf); err != nil {
+			return "", fmt.Errorf("render: markdown: %w", err)
+		}
+		return strings.TrimSpace(policy.Sanitize(buf.String())), nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// CSS — стили подсветки кода для страниц с отрендеренными заметками
+func CSS() string {
+	var buf bytes.Buffer
+	_ = chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get("github"))
+	return buf.String()
+}
+
+// Key — ключ кэша результата: одинаковый текст в одинаковом формате
+// рендерится одинаково, поэтому инвалидировать его не нужно
+func Key(format, content string) string {
+	sum := sha256.Sum256([]byte(Version + "\x00" + format + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"myproject/models"
+)
+
+const attachmentColumns = `id, note_id, user_id, file_name, content_type, size, sha256, blob_key,
+	COALESCE(thumb_key, ''), COALESCE(width, 0), COALESCE(height, 0), created_at`
+
+// ErrQuotaExceeded — новый файл не помещается в квоту пользователя
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+func CreateAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+func scanAttachment(row rowScanner) (models.Attachment, error) {
+	var a models.Attachment
+	err := row.Scan(
+		&a.ID, &a.NoteID, &a.UserID, &a.FileName, &a.ContentType, &a.Size, &a.SHA256, &a.BlobKey,
+		&a.ThumbKey, &a.Width, &a.Height, &a.CreatedAt,
+	)
+	return a, err
+}
+
+// Сохранить вложение, если заметка принадлежит пользователю (иначе
+// ErrNotFound) и файл помещается в квоту (иначе ErrQuotaExceeded). Загрузки
+// одного пользователя проверяют квоту по очереди — под advisory-блокировкой.
+func (r *AttachmentRepository) Create(ctx context.Context, a models.Attachment, quota int64) (models.Attachment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("repo: create attachment: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext('attachments_quota'), $1)`, a.UserID); err != nil {
+		return models.Attachment{}, fmt.Errorf("repo: create attachment: lock: %w", err)
+	}
+	var used int64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = $1`, a.UserID,
+	).Scan(&used); err != nil {
+		return models.Attachment{}, fmt.Errorf("repo: create attachment: usage: %w", err)
+	}
+	if used+a.Size > quota {
+		return models.Attachment{}, ErrQuotaExceeded
+	}
+
+	row := tx.QueryRowContext(ctx,
+		`INSERT INTO attachments (note_id, user_id, file_name, content_type, size, sha256, blob_key, thumb_key, width, height)
+		 SELECT id, user_id, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, 0)
+		 FROM notes WHERE id = $1 AND user_id = $2
+		 RETURNING `+attachmentColumns,
+		a.NoteID, a.UserID, a.FileName, a.ContentType, a.Size, a.SHA256, a.BlobKey, a.ThumbKey, a.Width, a.Height,
+	)
+	created, err := scanAttachment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Attachment{}, ErrNotFound
+		}
+		return models.Attachment{}, fmt.Errorf("repo: create attachment: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Attachment{}, fmt.Errorf("repo: create attachment: commit: %w", err)
+	}
+	return created, nil
+}
+
+// Вложения заметки пользователя в порядке загрузки
+func (r *AttachmentRepository) List(ctx context.Context, userID, noteID int) ([]models.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+attachmentColumns+` FROM attachments WHERE note_id = $1 AND user_id = $2 ORDER BY id`,
+		noteID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: list attachments note id=%d: %w", noteID, err)
+	}
+	defer rows.Close()
+
+	list := []models.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repo: list attachments: scan: %w", err)
+		}
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: list attachments: %w", err)
+	}
+	return list, nil
+}
+
+// Вложение заметки пользователя; чужое — ErrNotFound
+func (r *AttachmentRepository) Get(ctx context.Context, userID, noteID int, id int64) (models.Attachment, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+attachmentColumns+` FROM attachments WHERE id = $1 AND note_id = $2 AND user_id = $3`,
+		id, noteID, userID,
+	)
+	a, err := scanAttachment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Attachment{}, ErrNotFound
+		}
+		return models.Attachment{}, fmt.Errorf("repo: get attachment id=%d: %w", id, err)
+	}
+	return a, nil
+}
+
+// Вложение по id без проверки владельца — для скачивания по подписанной ссылке
+func (r *AttachmentRepository) ByID(ctx context.Context, id int64) (models.Attachment, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE id = $1`, id)
+	a, err := scanAttachment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Attachment{}, ErrNotFound
+		}
+		return models.Attachment{}, fmt.Errorf("repo: get attachment id=%d: %w", id, err)
+	}
+	return a, nil
+}
+
+// Удалить вложение; файлы удалит задача, которую ставит триггер
+func (r *AttachmentRepository) Delete(ctx context.Context, userID, noteID int, id int64) (models.Attachment, error) {
+	row := r.db.QueryRowContext(ctx,
+		`DELETE FROM attachments WHERE id = $1 AND note_id = $2 AND user_id = $3 RETURNING `+attachmentColumns,
+		id, noteID, userID,
+	)
+	a, err := scanAttachment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Attachment{}, ErrNotFound
+		}
+		return models.Attachment{}, fmt.Errorf("repo: delete attachment id=%d: %w", id, err)
+	}
+	return a, nil
+}
+
+// Сколько байт и файлов занимают вложения пользователя
+func (r *AttachmentRepository) Usage(ctx context.Context, userID int) (used int64, files int, err error) {
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(size), 0), COUNT(*) FROM attachments WHERE user_id = $1`, userID,
+	).Scan(&used, &files)
+	if err != nil {
+		return 0, 0, fmt.Errorf("repo: attachment usage user=%d: %w", userID, err)
+	}
+	return used, files, nil
+}
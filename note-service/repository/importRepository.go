@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"myproject/models"
+)
+
+const importColumns = `id, user_id, COALESCE(job_id, 0), format, status, total, processed, created, duplicates, failed,
+	errors, COALESCE(error, ''), created_at, finished_at`
+
+type ImportRepository struct {
+	db *sql.DB
+}
+
+func CreateImportRepository(db *sql.DB) *ImportRepository {
+	return &ImportRepository{db: db}
+}
+
+// Создать задание вместе с загруженным файлом
+func (r *ImportRepository) Create(ctx context.Context, userID int, format string, source []byte) (models.Import, error) {
+	row := r.db.QueryRowContext(ctx,
+		`INSERT INTO imports (user_id, format, source) VALUES ($1, $2, $3)
+		 RETURNING `+importColumns,
+		userID, format, source,
+	)
+	imp, err := scanImport(row)
+	if err != nil {
+		return models.Import{}, fmt.Errorf("repo: create import: %w", err)
+	}
+	return imp, nil
+}
+
+// Задание пользователя; чужое — ErrNotFound
+func (r *ImportRepository) Get(ctx context.Context, userID int, id int64) (models.Import, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+importColumns+` FROM imports WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	)
+	imp, err := scanImport(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Import{}, ErrNotFound
+		}
+		return models.Import{}, fmt.Errorf("repo: get import id=%d: %w", id, err)
+	}
+	return imp, nil
+}
+
+// Задание по id без проверки владельца — для фоновой задачи
+func (r *ImportRepository) ByID(ctx context.Context, id int64) (models.Import, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+importColumns+` FROM imports WHERE id = $1`, id)
+	imp, err := scanImport(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Import{}, ErrNotFound
+		}
+		return models.Import{}, fmt.Errorf("repo: get import id=%d: %w", id, err)
+	}
+	return imp, nil
+}
+
+// Связать задание с задачей очереди, которая его выполняет
+func (r *ImportRepository) AttachJob(ctx context.Context, id, jobID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE imports SET job_id = $2 WHERE id = $1`, id, jobID)
+	if err != nil {
+		return fmt.Errorf("repo: attach job import id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// Перевести задание в running; total — сколько заметок найдено в файле.
+// Счётчики обнуляются: повторная попытка проходит файл заново.
+func (r *ImportRepository) Start(ctx context.Context, id int64, total int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE imports SET status = 'running', total = $2, processed = 0, created = 0,
+		        duplicates = 0, failed = 0, errors = '[]'
+		 WHERE id = $1`,
+		id, total,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: start import id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// Загруженный файл задания
+func (r *ImportRepository) Source(ctx context.Context, id int64) ([]byte, error) {
+	var source []byte
+	err := r.db.QueryRowContext(ctx, `SELECT source FROM imports WHERE id = $1`, id).Scan(&source)
+	if err != nil {
+		return nil, fmt.Errorf("repo: import source id=%d: %w", id, err)
+	}
+	return source, nil
+}
+
+// Сохранить прогресс; imp.Errors — полный отчёт на текущий момент
+func (r *ImportRepository) Progress(ctx context.Context, imp models.Import) error {
+	errs, err := json.Marshal(imp.Errors)
+	if err != nil {
+		return fmt.Errorf("repo: import progress id=%d: %w", imp.ID, err)
+	}
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE imports SET processed = $2, created = $3, duplicates = $4, failed = $5, errors = $6
+		 WHERE id = $1`,
+		imp.ID, imp.Processed, imp.Created, imp.Duplicates, imp.Failed, errs,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: import progress id=%d: %w", imp.ID, err)
+	}
+	return nil
+}
+
+// Завершить задание: записать итог и освободить место под файл
+func (r *ImportRepository) Finish(ctx context.Context, imp models.Import) error {
+	if err := r.Progress(ctx, imp); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE imports SET status = $2, error = NULLIF($3, ''), source = NULL, finished_at = NOW()
+		 WHERE id = $1`,
+		imp.ID, imp.Status, imp.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: finish import id=%d: %w", imp.ID, err)
+	}
+	return nil
+}
+
+func scanImport(row *sql.Row) (models.Import, error) {
+	var imp models.Import
+	var errs []byte
+	var finished sql.NullTime
+	err := row.Scan(
+		&imp.ID, &imp.UserID, &imp.JobID, &imp.Format, &imp.Status, &imp.Total, &imp.Processed,
+		&imp.Created, &imp.Duplicates, &imp.Failed, &errs, &imp.Error, &imp.CreatedAt, &finished,
+	)
+	if err != nil {
+		return models.Import{}, err
+	}
+	if err := json.Unmarshal(errs, &imp.Errors); err != nil {
+		return models.Import{}, fmt.Errorf("decode errors: %w", err)
+	}
+	if finished.Valid {
+		imp.FinishedAt = &finished.Time
+	}
+	return imp, nil
+}
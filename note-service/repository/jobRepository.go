@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"myproject/models"
+)
+
+const jobColumns = `id, COALESCE(user_id, 0), kind, payload, status, attempts, max_attempts,
+	progress, total, COALESCE(error, ''), cancel_requested, run_at, created_at, started_at, finished_at`
+
+// ErrJobFinished — задача уже завершена, отменять нечего
+var ErrJobFinished = errors.New("job already finished")
+
+type JobRepository struct {
+	db *sql.DB
+}
+
+func CreateJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (models.Job, error) {
+	var j models.Job
+	var payload []byte
+	var started, finished sql.NullTime
+	err := row.Scan(
+		&j.ID, &j.UserID, &j.Kind, &payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.Progress, &j.Total, &j.Error, &j.CancelRequested, &j.RunAt, &j.CreatedAt, &started, &finished,
+	)
+	if err != nil {
+		return models.Job{}, err
+	}
+	j.Payload = payload
+	if started.Valid {
+		j.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		j.FinishedAt = &finished.Time
+	}
+	return j, nil
+}
+
+// Поставить задачу в очередь; userID=0 — системная задача
+func (r *JobRepository) Enqueue(ctx context.Context, userID int, kind string, payload []byte, maxAttempts int) (models.Job, error) {
+	row := r.db.QueryRowContext(ctx,
+		`INSERT INTO jobs (user_id, kind, payload, max_attempts) VALUES (NULLIF($1, 0), $2, $3, $4)
+		 RETURNING `+jobColumns,
+		userID, kind, payload, maxAttempts,
+	)
+	j, err := scanJob(row)
+	if err != nil {
+		return models.Job{}, fmt.Errorf("repo: enqueue job kind=%s: %w", kind, err)
+	}
+	return j, nil
+}
+
+// Claim забирает одну готовую задачу: из очереди или брошенную упавшим
+// воркером (аренда истекла). Параллельные воркеры не ждут друг друга
+// благодаря SKIP LOCKED. ok=false — задач нет.
+func (r *JobRepository) Claim(ctx context.Context, worker string, lease time.Duration) (models.Job, bool, error) {
+	row := r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_by = $1,
+		        locked_until = NOW() + make_interval(secs => $2), started_at = COALESCE(started_at, NOW())
+		 WHERE id = (
+		     SELECT id FROM jobs
+		     WHERE (status = 'queued' AND run_at <= NOW())
+		        OR (status = 'running' AND locked_until < NOW())
+		     ORDER BY run_at, id
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+jobColumns,
+		worker, lease.Seconds(),
+	)
+	j, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Job{}, false, nil
+		}
+		return models.Job{}, false, fmt.Errorf("repo: claim job: %w", err)
+	}
+	return j, true, nil
+}
+
+// Heartbeat продлевает аренду и сообщает, не просили ли отменить задачу.
+// owned=false — аренду уже забрал другой воркер.
+func (r *JobRepository) Heartbeat(ctx context.Context, id int64, worker string, lease time.Duration) (cancel, owned bool, err error) {
+	err = r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET locked_until = NOW() + make_interval(secs => $3)
+		 WHERE id = $1 AND locked_by = $2 AND status = 'running'
+		 RETURNING cancel_requested`,
+		id, worker, lease.Seconds(),
+	).Scan(&cancel)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("repo: job heartbeat id=%d: %w", id, err)
+	}
+	return cancel, true, nil
+}
+
+func (r *JobRepository) Progress(ctx context.Context, id int64, worker string, done, total int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET progress = $3, total = $4 WHERE id = $1 AND locked_by = $2`,
+		id, worker, done, total,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: job progress id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// Finish переводит задачу в конечное состояние (done, failed, canceled)
+func (r *JobRepository) Finish(ctx context.Context, id int64, worker, status, errMsg string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET status = $3, error = NULLIF($4, ''), locked_by = NULL, locked_until = NULL,
+		        finished_at = NOW()
+		 WHERE id = $1 AND locked_by = $2`,
+		id, worker, status, errMsg,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: finish job id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// Retry возвращает задачу в очередь до runAt. refund=true — попытка не
+// засчитывается (задачу прервала остановка сервиса, а не ошибка).
+func (r *JobRepository) Retry(ctx context.Context, id int64, worker, errMsg string, runAt time.Time, refund bool) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET status = 'queued', error = NULLIF($3, ''), run_at = $4,
+		        attempts = attempts - CASE WHEN $5 THEN 1 ELSE 0 END,
+		        locked_by = NULL, locked_until = NULL
+		 WHERE id = $1 AND locked_by = $2`,
+		id, worker, errMsg, runAt, refund,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: retry job id=%d: %w", id, err)
+	}
+	return nil
+}
+
+// Cancel помечает задачу пользователя к отмене. Снимает её воркер: у
+// выполняемой он увидит флаг при продлении аренды, а ожидающую (в том числе
+// отложенный повтор) заберёт сразу — run_at сдвигается на сейчас, — чтобы
+// обработчик успел прибрать за собой.
+func (r *JobRepository) Cancel(ctx context.Context, userID int, id int64) (models.Job, error) {
+	row := r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET cancel_requested = TRUE, run_at = LEAST(run_at, NOW())
+		 WHERE id = $1 AND user_id = $2 AND status IN ('queued', 'running')
+		 RETURNING `+jobColumns,
+		id, userID,
+	)
+	j, err := scanJob(row)
+	if err == nil {
+		return j, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.Job{}, fmt.Errorf("repo: cancel job id=%d: %w", id, err)
+	}
+
+	// не нашли: либо задачи нет, либо она уже закончилась
+	if _, err := r.Get(ctx, userID, id); err != nil {
+		return models.Job{}, err
+	}
+	return models.Job{}, ErrJobFinished
+}
+
+// Задача пользователя; чужая — ErrNotFound
+func (r *JobRepository) Get(ctx context.Context, userID int, id int64) (models.Job, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	)
+	j, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Job{}, ErrNotFound
+		}
+		return models.Job{}, fmt.Errorf("repo: get job id=%d: %w", id, err)
+	}
+	return j, nil
+}
+
+// Задачи пользователя, новые сначала
+func (r *JobRepository) List(ctx context.Context, userID, limit, offset int) ([]models.Job, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repo: scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: rows: %w", err)
+	}
+	return jobs, nil
+}
@@ -2,21 +2,40 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"myproject/models"
 )
 
 var ErrNotFound = errors.New("not found")
 
+const noteColumns = `id, user_id, title, content, format, due_at, remind_at`
+
+// Методы возвращают версию набора заметок пользователя (note_versions),
+// согласованную с прочитанными или записанными данными. Кэш по ней понимает,
+// не устарело ли то, что он собирается сохранить.
 type NoteRepo interface {
-	GetAll(ctx context.Context, userID int) ([]models.Note, error)
-	GetById(ctx context.Context, userID, id int) (models.Note, error)
-	Create(ctx context.Context, userID int, title, content string) (int, error)
-	Delete(ctx context.Context, userID, id int) error
-	Update(ctx context.Context, userID, id int, title *string, content *string) (models.Note, error)
+	GetAll(ctx context.Context, userID int) ([]models.Note, int64, error)
+	GetById(ctx context.Context, userID, id int) (models.Note, int64, error)
+	Create(ctx context.Context, note models.Note) (int, int64, error)
+	Delete(ctx context.Context, userID, id int) (int64, error)
+	Update(ctx context.Context, userID, id int, patch NotePatch) (models.Note, int64, error)
+	CountByUser(ctx context.Context, userID int) (int, error)
+}
+
+// NotePatch — частичное изменение заметки: nil-поля не меняются. У сроков
+// Valid=false сбрасывает срок.
+type NotePatch struct {
+	Title    *string
+	Content  *string
+	Format   *string
+	DueAt    *sql.NullTime
+	RemindAt *sql.NullTime
 }
 
 type NoteRepository struct {
@@ -27,114 +46,504 @@ func CreateNoteRepository(db *sql.DB) *NoteRepository {
 	return &NoteRepository{db: db}
 }
 
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func currentVersion(ctx context.Context, q queryer, userID int) (int64, error) {
+	var v int64
+	err := q.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT version FROM note_versions WHERE user_id = $1), 0)`,
+		userID,
+	).Scan(&v)
+	if err != nil {
+		return 0, fmt.Errorf("repo: note version: %w", err)
+	}
+	return v, nil
+}
+
+func scanNote(row rowScanner) (models.Note, error) {
+	var n models.Note
+	var due, remind sql.NullTime
+	if err := row.Scan(&n.Id, &n.UserID, &n.Title, &n.Content, &n.Format, &due, &remind); err != nil {
+		return models.Note{}, err
+	}
+	n.DueAt = timePtr(due)
+	n.RemindAt = timePtr(remind)
+	return n, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+func nullTimePtr(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// Чтение в одном снимке: версия соответствует именно этим данным
+func (r *NoteRepository) readTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
 // Получить все заметки конкретного пользователя
-func (r *NoteRepository) GetAll(ctx context.Context, userID int) ([]models.Note, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, user_id, title, content FROM notes WHERE user_id = $1`,
+func (r *NoteRepository) GetAll(ctx context.Context, userID int) ([]models.Note, int64, error) {
+	tx, err := r.readTx(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("repo: get all notes: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	version, err := currentVersion(ctx, tx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+noteColumns+` FROM notes WHERE user_id = $1 ORDER BY id`,
 		userID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("repo: get all notes: %w", err)
+		return nil, 0, fmt.Errorf("repo: get all notes: %w", err)
 	}
 	defer rows.Close()
 
 	var notes []models.Note
 
 	for rows.Next() {
-		var note models.Note
-		err := rows.Scan(&note.Id, &note.UserID, &note.Title, &note.Content)
+		note, err := scanNote(rows)
 		if err != nil {
-			return nil, fmt.Errorf("repo: scan notes %w", err)
+			return nil, 0, fmt.Errorf("repo: scan notes %w", err)
 		}
 		notes = append(notes, note)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("repo: rows: %w", err)
+		return nil, 0, fmt.Errorf("repo: rows: %w", err)
 	}
-	return notes, nil
+	return notes, version, nil
 }
 
-// Получить одну заметку пользователя по id
-func (r *NoteRepository) GetById(ctx context.Context, userID, id int) (models.Note, error) {
-	var note models.Note
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, user_id, title, content FROM notes WHERE id = $1 AND user_id = $2`,
+// Получить одну заметку пользователя по id. Версия возвращается и вместе
+// с ErrNotFound: отсутствие заметки тоже можно закэшировать.
+func (r *NoteRepository) GetById(ctx context.Context, userID, id int) (models.Note, int64, error) {
+	tx, err := r.readTx(ctx)
+	if err != nil {
+		return models.Note{}, 0, fmt.Errorf("repo: get note by id: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	version, err := currentVersion(ctx, tx, userID)
+	if err != nil {
+		return models.Note{}, 0, err
+	}
+
+	note, err := scanNote(tx.QueryRowContext(ctx,
+		`SELECT `+noteColumns+` FROM notes WHERE id = $1 AND user_id = $2`,
 		id, userID,
-	).Scan(&note.Id, &note.UserID, &note.Title, &note.Content)
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Note{}, version, ErrNotFound
+		}
+		return models.Note{}, 0, fmt.Errorf("repo: get note by id: %w", err)
+	}
+	return note, version, nil
+}
+
+// Find — заметка по id без проверки владельца, мимо кэша; для фоновых задач
+func (r *NoteRepository) Find(ctx context.Context, id int) (models.Note, error) {
+	note, err := scanNote(r.db.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = $1`, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.Note{}, ErrNotFound
 		}
-		return models.Note{}, fmt.Errorf("repo: get note by id: %w", err)
+		return models.Note{}, fmt.Errorf("repo: find note id=%d: %w", id, err)
 	}
 	return note, nil
 }
 
-// Создать заметку для пользователя
-func (r *NoteRepository) Create(ctx context.Context, userID int, title, content string) (int, error) {
+// DueBefore — заметки пользователя со сроком раньше before, ближайшие
+// сначала (индекс notes_user_due_idx)
+func (r *NoteRepository) DueBefore(ctx context.Context, userID int, before time.Time) ([]models.Note, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+noteColumns+` FROM notes WHERE user_id = $1 AND due_at < $2 ORDER BY due_at, id`,
+		userID, before,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: due notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := []models.Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repo: scan due notes: %w", err)
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: due notes: %w", err)
+	}
+	return notes, nil
+}
+
+// write выполняет изменение и читает версию в той же транзакции. Триггер
+// уже заблокировал строку note_versions, поэтому версия — ровно наша.
+func (r *NoteRepository) write(ctx context.Context, userID int, fn func(tx *sql.Tx) error) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repo: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return 0, err
+	}
+
+	version, err := currentVersion(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repo: commit: %w", err)
+	}
+	return version, nil
+}
+
+// Создать заметку для пользователя note.UserID
+func (r *NoteRepository) Create(ctx context.Context, note models.Note) (int, int64, error) {
 	var id int
-	err := r.db.QueryRowContext(ctx,
-		`INSERT INTO notes (user_id, title, content) VALUES ($1, $2, $3) RETURNING id`,
-		userID, title, content,
-	).Scan(&id)
+	version, err := r.write(ctx, note.UserID, func(tx *sql.Tx) error {
+		var err error
+		id, err = createNote(ctx, tx, note)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, version, nil
+}
+
+// Удалить заметку пользователя; DELETE ... RETURNING отдаёт строку такой,
+// какой её удалила эта транзакция (для аудита)
+func (r *NoteRepository) Delete(ctx context.Context, userID, id int) (deleted models.Note, version int64, err error) {
+	version, err = r.write(ctx, userID, func(tx *sql.Tx) error {
+		var err error
+		deleted, err = deleteNote(ctx, tx, userID, id)
+		return err
+	})
+	if err != nil {
+		return models.Note{}, 0, err
+	}
+	return deleted, version, nil
+}
+
+// Частично обновить заметку пользователя; before — строка, заблокированная
+// в той же транзакции (для аудита)
+func (r *NoteRepository) Update(ctx context.Context, userID, id int, patch NotePatch) (before, updated models.Note, version int64, err error) {
+	version, err = r.write(ctx, userID, func(tx *sql.Tx) error {
+		var err error
+		before, updated, err = updateNote(ctx, tx, userID, id, patch)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("repo: create note title = %q: %w", title, err)
+		return models.Note{}, models.Note{}, 0, err
 	}
+	return before, updated, version, nil
+}
 
+func createNote(ctx context.Context, tx *sql.Tx, n models.Note) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO notes (user_id, title, content, format, due_at, remind_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		n.UserID, n.Title, n.Content, n.Format, nullTimePtr(n.DueAt), nullTimePtr(n.RemindAt),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("repo: create note title = %q: %w", n.Title, err)
+	}
 	return id, nil
 }
 
-// Удалить заметку пользователя
-func (r *NoteRepository) Delete(ctx context.Context, userID, id int) error {
-	result, err := r.db.ExecContext(ctx,
-		`DELETE FROM notes WHERE id = $1 AND user_id = $2`,
+// deleteNote возвращает удалённую заметку
+func deleteNote(ctx context.Context, tx *sql.Tx, userID, id int) (models.Note, error) {
+	deleted, err := scanNote(tx.QueryRowContext(ctx,
+		`DELETE FROM notes WHERE id = $1 AND user_id = $2 RETURNING `+noteColumns,
 		id, userID,
-	)
+	))
 	if err != nil {
-		return fmt.Errorf("repo: delete note id=%d: %w", id, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Note{}, ErrNotFound
+		}
+		return models.Note{}, fmt.Errorf("repo: delete note id=%d: %w", id, err)
 	}
+	return deleted, nil
+}
 
-	n, err := result.RowsAffected()
+// updateNote возвращает заметку до и после изменения
+func updateNote(ctx context.Context, tx *sql.Tx, userID, id int, patch NotePatch) (before, after models.Note, err error) {
+	// Проверим, есть ли такая заметка и принадлежит ли она этому пользователю;
+	// строку блокируем, чтобы параллельный PATCH не затёр наши поля
+	before, err = scanNote(tx.QueryRowContext(ctx,
+		`SELECT `+noteColumns+` FROM notes WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		id, userID,
+	))
 	if err != nil {
-		return fmt.Errorf("repo: delete id=%d: rowsAffected: %w", id, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Note{}, models.Note{}, ErrNotFound
+		}
+		return models.Note{}, models.Note{}, fmt.Errorf("repo: update-note: %w", err)
+	}
+
+	// Обновляем только те поля, которые пришли
+	after = before
+	if patch.Title != nil {
+		after.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		after.Content = *patch.Content
+	}
+	if patch.Format != nil {
+		after.Format = *patch.Format
 	}
-	if n == 0 {
-		return ErrNotFound
+	if patch.DueAt != nil {
+		after.DueAt = timePtr(*patch.DueAt)
+	}
+	if patch.RemindAt != nil {
+		after.RemindAt = timePtr(*patch.RemindAt)
 	}
 
-	return nil
+	query := `UPDATE notes SET title = $1, content = $2, format = $3, due_at = $4, remind_at = $5 WHERE id = $6 AND user_id = $7`
+	_, err = tx.ExecContext(ctx, query, after.Title, after.Content, after.Format,
+		nullTimePtr(after.DueAt), nullTimePtr(after.RemindAt), id, userID)
+	if err != nil {
+		return models.Note{}, models.Note{}, fmt.Errorf("repo: update-note: %w", err)
+	}
+	return before, after, nil
+}
+
+// Виды операций пакета
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// ErrRolledBack — атомарный пакет откатан из-за ошибки одной из операций
+var ErrRolledBack = errors.New("batch rolled back")
+
+// BatchOp — одна операция пакета. Для update nil-поля не меняются, сроки —
+// как в NotePatch.
+type BatchOp struct {
+	Kind     string
+	ID       int
+	Title    *string
+	Content  *string
+	Format   *string
+	DueAt    *sql.NullTime
+	RemindAt *sql.NullTime
 }
 
-// Частично обновить заметку пользователя
-func (r *NoteRepository) Update(ctx context.Context, userID, id int, title *string, content *string) (models.Note, error) {
-	// Проверим, есть ли такая заметка и принадлежит ли она этому пользователю
-	existing, err := r.GetById(ctx, userID, id)
+// BatchResult — заметка до и после операции (у create нет Before, у delete —
+// After) и ошибка именно этой операции
+type BatchResult struct {
+	Before models.Note
+	After  models.Note
+	Err    error
+}
+
+// Batch выполняет операции по порядку в одной транзакции. В атомарном режиме
+// первая ошибка откатывает всё и Batch возвращает ErrRolledBack; иначе каждая
+// операция идёт под своей точкой сохранения, и ошибка откатывает только её.
+// Результаты возвращаются в обоих случаях; version — версия после коммита.
+func (r *NoteRepository) Batch(ctx context.Context, userID int, ops []BatchOp, atomic bool) ([]BatchResult, int64, error) {
+	results := make([]BatchResult, len(ops))
+	version, err := r.write(ctx, userID, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			if atomic {
+				results[i] = applyBatchOp(ctx, tx, userID, op)
+				if results[i].Err != nil {
+					return ErrRolledBack
+				}
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_op`); err != nil {
+				return fmt.Errorf("repo: batch savepoint: %w", err)
+			}
+			results[i] = applyBatchOp(ctx, tx, userID, op)
+			release := `RELEASE SAVEPOINT batch_op`
+			if results[i].Err != nil {
+				release = `ROLLBACK TO SAVEPOINT batch_op`
+			}
+			if _, err := tx.ExecContext(ctx, release); err != nil {
+				return fmt.Errorf("repo: batch savepoint: %w", err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return models.Note{}, err // здесь ErrNotFound пробросится вверх
+		return results, 0, err
 	}
+	return results, version, nil
+}
 
-	// Обновляем только те поля, которые пришли
-	newTitle := existing.Title
-	newContent := existing.Content
+func applyBatchOp(ctx context.Context, tx *sql.Tx, userID int, op BatchOp) BatchResult {
+	var res BatchResult
+	switch op.Kind {
+	case BatchCreate:
+		var title, content string
+		format := models.FormatPlain
+		if op.Title != nil {
+			title = *op.Title
+		}
+		if op.Content != nil {
+			content = *op.Content
+		}
+		if op.Format != nil && *op.Format != "" {
+			format = *op.Format
+		}
+		res.After = models.Note{UserID: userID, Title: title, Content: content, Format: format}
+		if op.DueAt != nil {
+			res.After.DueAt = timePtr(*op.DueAt)
+		}
+		if op.RemindAt != nil {
+			res.After.RemindAt = timePtr(*op.RemindAt)
+		}
+		res.After.Id, res.Err = createNote(ctx, tx, res.After)
+	case BatchUpdate:
+		res.Before, res.After, res.Err = updateNote(ctx, tx, userID, op.ID, NotePatch{
+			Title: op.Title, Content: op.Content, Format: op.Format, DueAt: op.DueAt, RemindAt: op.RemindAt,
+		})
+	case BatchDelete:
+		res.Before, res.Err = deleteNote(ctx, tx, userID, op.ID)
+	default:
+		res.Err = fmt.Errorf("repo: unknown batch op %q", op.Kind)
+	}
+	return res
+}
 
-	if title != nil {
-		newTitle = *title
+// Количество заметок пользователя (для поддержки и админки)
+func (r *NoteRepository) CountByUser(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notes WHERE user_id = $1`,
+		userID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("repo: count notes user=%d: %w", userID, err)
 	}
-	if content != nil {
-		newContent = *content
+	return n, nil
+}
+
+// NoteCursor отдаёт заметки пользователя по одной, не собирая список в памяти.
+// Все строки читаются из одного снимка; Close обязателен.
+type NoteCursor struct {
+	tx   *sql.Tx
+	rows *sql.Rows
+	note models.StoredNote
+	err  error
+}
+
+// Открыть курсор по заметкам пользователя в порядке id
+func (r *NoteRepository) OpenCursor(ctx context.Context, userID int) (*NoteCursor, error) {
+	tx, err := r.readTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("repo: open cursor: begin: %w", err)
 	}
 
-	query := `UPDATE notes SET title = $1, content = $2 WHERE id = $3 AND user_id = $4`
-	_, err = r.db.ExecContext(ctx, query, newTitle, newContent, id, userID)
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, user_id, title, COALESCE(content, ''), format, created_at, updated_at
+		 FROM notes WHERE user_id = $1 ORDER BY id`,
+		userID,
+	)
 	if err != nil {
-		return models.Note{}, fmt.Errorf("repo: update-note: %w", err)
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("repo: open cursor: %w", err)
+	}
+	return &NoteCursor{tx: tx, rows: rows}, nil
+}
+
+func (c *NoteCursor) Next() bool {
+	if c.err != nil || !c.rows.Next() {
+		return false
+	}
+	n := &c.note
+	if err := c.rows.Scan(&n.Id, &n.UserID, &n.Title, &n.Content, &n.Format, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		c.err = fmt.Errorf("repo: scan note: %w", err)
+		return false
+	}
+	return true
+}
+
+// Note — текущая заметка; действительна до следующего Next
+func (c *NoteCursor) Note() models.StoredNote {
+	return c.note
+}
+
+func (c *NoteCursor) Err() error {
+	if c.err != nil {
+		return c.err
 	}
+	if err := c.rows.Err(); err != nil {
+		return fmt.Errorf("repo: rows: %w", err)
+	}
+	return nil
+}
+
+func (c *NoteCursor) Close() error {
+	c.rows.Close()
+	return c.tx.Rollback()
+}
+
+// ContentHash — тот же хэш, что считает триггер notes_hash
+func ContentHash(title, content string) string {
+	sum := sha256.Sum256([]byte(title + "\n" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Есть ли у пользователя заметка с таким хэшем заголовка и текста
+func (r *NoteRepository) ExistsByHash(ctx context.Context, userID int, hash string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM notes WHERE user_id = $1 AND content_hash = $2)`,
+		userID, hash,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("repo: note exists by hash: %w", err)
+	}
+	return exists, nil
+}
+
+// Создать заметку с исходными датами (импорт); нулевые даты — текущее время
+func (r *NoteRepository) CreateImported(ctx context.Context, n models.StoredNote) (int, int64, error) {
+	var id int
+	version, err := r.write(ctx, n.UserID, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO notes (user_id, title, content, format, created_at, updated_at)
+			 VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'plain'), COALESCE($5, NOW()), COALESCE($6, $5, NOW()))
+			 RETURNING id`,
+			n.UserID, n.Title, n.Content, n.Format, nullTime(n.CreatedAt), nullTime(n.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("repo: import note title = %q: %w", n.Title, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, version, nil
+}
 
-	// Возвращаем обновлённую заметку
-	return models.Note{
-		Id:      id,
-		UserID:  userID,
-		Title:   newTitle,
-		Content: newContent,
-	}, nil
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
 }
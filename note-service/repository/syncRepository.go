@@ -0,0 +1,415 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"myproject/models"
+)
+
+const syncColumns = `id, user_id, title, COALESCE(content, ''), format, due_at, remind_at, created_at, updated_at, seq`
+
+var (
+	// ErrSyncExpired — позиция не покрывается журналом: надгробия после неё
+	// уже удалены по сроку или она впереди текущей версии
+	ErrSyncExpired = errors.New("sync position expired")
+	// ErrConflict — base_version клиента не совпала с текущей версией заметки
+	ErrConflict = errors.New("version conflict")
+)
+
+// SyncPos — позиция в последовательности изменений пользователя: переданы
+// все изменения до (Seq, AfterID) в порядке (seq, id). Full — идёт полная
+// синхронизация: клиент начал с пустого состояния.
+type SyncPos struct {
+	Seq     int64
+	AfterID int
+	Full    bool
+}
+
+// SyncChanges — страница изменений после позиции. Next — позиция после
+// страницы; без More — текущая версия пользователя.
+type SyncChanges struct {
+	Notes   []models.SyncNote
+	Deleted []models.Tombstone
+	Next    SyncPos
+	More    bool
+}
+
+// SyncOp — изменение от клиента; BaseVersion — версия заметки, которую он
+// менял. Для create ClientID делает повтор идемпотентным. Сроки — как в
+// NotePatch.
+type SyncOp struct {
+	Kind        string
+	ID          int
+	BaseVersion int64
+	ClientID    string
+	Title       *string
+	Content     *string
+	Format      *string
+	DueAt       *sql.NullTime
+	RemindAt    *sql.NullTime
+}
+
+// SyncApplied — итог изменения. Note — заметка после create/update, при
+// конфликте — текущая на сервере; Deleted — надгробие после delete или
+// заметки, удалённой на сервере. Duplicate — create с уже виденным ClientID.
+type SyncApplied struct {
+	Before    models.Note
+	Note      models.SyncNote
+	Deleted   *models.Tombstone
+	Duplicate bool
+	Err       error
+}
+
+func scanSyncNote(row rowScanner) (models.SyncNote, error) {
+	var n models.SyncNote
+	var due, remind sql.NullTime
+	err := row.Scan(&n.Id, &n.UserID, &n.Title, &n.Content, &n.Format, &due, &remind, &n.CreatedAt, &n.UpdatedAt, &n.Version)
+	n.DueAt = timePtr(due)
+	n.RemindAt = timePtr(remind)
+	return n, err
+}
+
+// patchTime — аргументы "менять ли срок" и "новое значение" для UPDATE
+func patchTime(t *sql.NullTime) (bool, sql.NullTime) {
+	if t == nil {
+		return false, sql.NullTime{}
+	}
+	return true, *t
+}
+
+// Changes — до limit изменений после since одним снимком БД: заметки
+// (созданные и изменённые) и надгробия в порядке (seq, id)
+func (r *NoteRepository) Changes(ctx context.Context, userID int, since SyncPos, limit int) (SyncChanges, error) {
+	tx, err := r.readTx(ctx)
+	if err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version, purged int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0), COALESCE(MAX(purged_seq), 0) FROM note_versions WHERE user_id = $1`,
+		userID,
+	).Scan(&version, &purged)
+	if err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: version: %w", err)
+	}
+	if since.Seq > version || (!since.Full && since.Seq < purged) {
+		return SyncChanges{}, ErrSyncExpired
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+syncColumns+` FROM notes
+		 WHERE user_id = $1 AND (seq, id) > ($2, $3) ORDER BY seq, id LIMIT $4`,
+		userID, since.Seq, since.AfterID, limit+1,
+	)
+	if err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: notes: %w", err)
+	}
+	var notes []models.SyncNote
+	for rows.Next() {
+		n, err := scanSyncNote(rows)
+		if err != nil {
+			rows.Close()
+			return SyncChanges{}, fmt.Errorf("repo: sync changes: scan: %w", err)
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: notes: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx,
+		`SELECT note_id, seq, deleted_at FROM note_tombstones
+		 WHERE user_id = $1 AND (seq, note_id) > ($2, $3) ORDER BY seq, note_id LIMIT $4`,
+		userID, since.Seq, since.AfterID, limit+1,
+	)
+	if err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: tombstones: %w", err)
+	}
+	var tombs []models.Tombstone
+	for rows.Next() {
+		var t models.Tombstone
+		if err := rows.Scan(&t.ID, &t.Version, &t.DeletedAt); err != nil {
+			rows.Close()
+			return SyncChanges{}, fmt.Errorf("repo: sync changes: scan: %w", err)
+		}
+		tombs = append(tombs, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return SyncChanges{}, fmt.Errorf("repo: sync changes: tombstones: %w", err)
+	}
+
+	// сливаем два упорядоченных списка и берём первые limit
+	out := SyncChanges{Notes: []models.SyncNote{}, Deleted: []models.Tombstone{}}
+	i, j := 0, 0
+	for n := 0; n < limit && (i < len(notes) || j < len(tombs)); n++ {
+		if j >= len(tombs) || (i < len(notes) && before(notes[i].Version, notes[i].Id, tombs[j].Version, tombs[j].ID)) {
+			out.Notes = append(out.Notes, notes[i])
+			out.Next = SyncPos{Seq: notes[i].Version, AfterID: notes[i].Id, Full: since.Full}
+			i++
+		} else {
+			out.Deleted = append(out.Deleted, tombs[j])
+			out.Next = SyncPos{Seq: tombs[j].Version, AfterID: tombs[j].ID, Full: since.Full}
+			j++
+		}
+	}
+	out.More = i < len(notes) || j < len(tombs)
+	if !out.More {
+		// всё до текущей версии передано: дальше — обычная синхронизация
+		out.Next = SyncPos{Seq: version}
+	}
+	return out, nil
+}
+
+func before(seqA int64, idA int, seqB int64, idB int) bool {
+	return seqA < seqB || (seqA == seqB && idA < idB)
+}
+
+// ApplySync применяет изменения клиента в одной транзакции; каждое — под
+// своей точкой сохранения, ошибка или конфликт не мешают остальным.
+// Изменения одного пользователя применяются по очереди: транзакция сразу
+// блокирует его строку note_versions.
+func (r *NoteRepository) ApplySync(ctx context.Context, userID int, ops []SyncOp) ([]SyncApplied, int64, error) {
+	results := make([]SyncApplied, len(ops))
+	version, err := r.write(ctx, userID, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO note_versions (user_id, version) VALUES ($1, 0)
+			 ON CONFLICT (user_id) DO UPDATE SET version = note_versions.version`,
+			userID,
+		); err != nil {
+			return fmt.Errorf("repo: sync lock: %w", err)
+		}
+
+		for i, op := range ops {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT sync_op`); err != nil {
+				return fmt.Errorf("repo: sync savepoint: %w", err)
+			}
+			results[i] = applySyncOp(ctx, tx, userID, op)
+			release := `RELEASE SAVEPOINT sync_op`
+			if results[i].Err != nil {
+				release = `ROLLBACK TO SAVEPOINT sync_op`
+			}
+			if _, err := tx.ExecContext(ctx, release); err != nil {
+				return fmt.Errorf("repo: sync savepoint: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, version, nil
+}
+
+func applySyncOp(ctx context.Context, tx *sql.Tx, userID int, op SyncOp) SyncApplied {
+	var res SyncApplied
+	switch op.Kind {
+	case BatchCreate:
+		if op.ClientID != "" {
+			var id int
+			err := tx.QueryRowContext(ctx,
+				`SELECT note_id FROM note_client_ids WHERE user_id = $1 AND client_id = $2`,
+				userID, op.ClientID,
+			).Scan(&id)
+			if err == nil {
+				// уже создана прошлым пакетом; возможно, с тех пор изменена или удалена
+				res.Duplicate = true
+				res.Note, res.Deleted, res.Err = lockSyncNote(ctx, tx, userID, id)
+				return res
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				res.Err = fmt.Errorf("repo: sync client id: %w", err)
+				return res
+			}
+		}
+
+		format := models.FormatPlain
+		if op.Format != nil && *op.Format != "" {
+			format = *op.Format
+		}
+		var due, remind sql.NullTime
+		if op.DueAt != nil {
+			due = *op.DueAt
+		}
+		if op.RemindAt != nil {
+			remind = *op.RemindAt
+		}
+		row := tx.QueryRowContext(ctx,
+			`INSERT INTO notes (user_id, title, content, format, due_at, remind_at)
+			 VALUES ($1, COALESCE($2, ''), COALESCE($3, ''), $4, $5, $6)
+			 RETURNING `+syncColumns,
+			userID, op.Title, op.Content, format, due, remind,
+		)
+		if res.Note, res.Err = scanSyncNote(row); res.Err != nil {
+			res.Err = fmt.Errorf("repo: sync create: %w", res.Err)
+			return res
+		}
+		if op.ClientID != "" {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO note_client_ids (user_id, client_id, note_id) VALUES ($1, $2, $3)`,
+				userID, op.ClientID, res.Note.Id,
+			); err != nil {
+				res.Err = fmt.Errorf("repo: sync client id: %w", err)
+			}
+		}
+
+	case BatchUpdate, BatchDelete:
+		cur, deleted, err := lockSyncNote(ctx, tx, userID, op.ID)
+		switch {
+		case err != nil:
+			res.Err = err
+			return res
+		case deleted != nil:
+			res.Deleted = deleted
+			// удалить уже удалённое — не конфликт
+			if op.Kind == BatchUpdate {
+				res.Err = ErrConflict
+			}
+			return res
+		case cur.Version != op.BaseVersion:
+			res.Note, res.Err = cur, ErrConflict
+			return res
+		}
+		res.Before = cur.Note
+
+		if op.Kind == BatchUpdate {
+			setDue, due := patchTime(op.DueAt)
+			setRemind, remind := patchTime(op.RemindAt)
+			row := tx.QueryRowContext(ctx,
+				`UPDATE notes SET title = COALESCE($3, title), content = COALESCE($4, content), format = COALESCE($5, format),
+				        due_at = CASE WHEN $6 THEN $7::timestamptz ELSE due_at END,
+				        remind_at = CASE WHEN $8 THEN $9::timestamptz ELSE remind_at END
+				 WHERE id = $1 AND user_id = $2 RETURNING `+syncColumns,
+				op.ID, userID, op.Title, op.Content, op.Format, setDue, due, setRemind, remind,
+			)
+			if res.Note, res.Err = scanSyncNote(row); res.Err != nil {
+				res.Err = fmt.Errorf("repo: sync update id=%d: %w", op.ID, res.Err)
+			}
+			return res
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM notes WHERE id = $1 AND user_id = $2`, op.ID, userID); err != nil {
+			res.Err = fmt.Errorf("repo: sync delete id=%d: %w", op.ID, err)
+			return res
+		}
+		t, err := tombstone(ctx, tx, userID, op.ID)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Deleted = &t
+
+	default:
+		res.Err = fmt.Errorf("repo: unknown sync op %q", op.Kind)
+	}
+	return res
+}
+
+// GetVersioned — заметка пользователя с версией, прямо из БД
+func (r *NoteRepository) GetVersioned(ctx context.Context, userID, id int) (models.SyncNote, error) {
+	n, err := scanSyncNote(r.db.QueryRowContext(ctx,
+		`SELECT `+syncColumns+` FROM notes WHERE id = $1 AND user_id = $2`, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SyncNote{}, ErrNotFound
+		}
+		return models.SyncNote{}, fmt.Errorf("repo: get versioned note id=%d: %w", id, err)
+	}
+	return n, nil
+}
+
+// UpdateContent меняет текст заметки, только если её версия всё ещё base.
+// Иначе — ErrConflict и текущая заметка в after.
+func (r *NoteRepository) UpdateContent(ctx context.Context, userID, id int, content string, base int64) (before models.Note, after models.SyncNote, version int64, err error) {
+	version, err = r.write(ctx, userID, func(tx *sql.Tx) error {
+		cur, err := scanSyncNote(tx.QueryRowContext(ctx,
+			`SELECT `+syncColumns+` FROM notes WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("repo: update content id=%d: %w", id, err)
+		}
+		if cur.Version != base {
+			after = cur
+			return ErrConflict
+		}
+		before = cur.Note
+
+		after, err = scanSyncNote(tx.QueryRowContext(ctx,
+			`UPDATE notes SET content = $3 WHERE id = $1 AND user_id = $2 RETURNING `+syncColumns,
+			id, userID, content))
+		if err != nil {
+			return fmt.Errorf("repo: update content id=%d: %w", id, err)
+		}
+		return nil
+	})
+	return before, after, version, err
+}
+
+// lockSyncNote — текущая заметка (строка заблокирована до конца транзакции)
+// или её надгробие; ни того ни другого — ErrNotFound
+func lockSyncNote(ctx context.Context, tx *sql.Tx, userID, id int) (models.SyncNote, *models.Tombstone, error) {
+	row := tx.QueryRowContext(ctx,
+		`SELECT `+syncColumns+` FROM notes WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID)
+	n, err := scanSyncNote(row)
+	if err == nil {
+		return n, nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.SyncNote{}, nil, fmt.Errorf("repo: sync get id=%d: %w", id, err)
+	}
+	t, err := tombstone(ctx, tx, userID, id)
+	if err != nil {
+		return models.SyncNote{}, nil, err
+	}
+	return models.SyncNote{}, &t, nil
+}
+
+func tombstone(ctx context.Context, tx *sql.Tx, userID, id int) (models.Tombstone, error) {
+	var t models.Tombstone
+	err := tx.QueryRowContext(ctx,
+		`SELECT note_id, seq, deleted_at FROM note_tombstones WHERE user_id = $1 AND note_id = $2`,
+		userID, id,
+	).Scan(&t.ID, &t.Version, &t.DeletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Tombstone{}, ErrNotFound
+		}
+		return models.Tombstone{}, fmt.Errorf("repo: tombstone id=%d: %w", id, err)
+	}
+	return t, nil
+}
+
+// PurgeTombstones удаляет надгробия старше retentionDays и запоминает, до
+// какой позиции они удалены; заодно — старые client_id пакетов
+func (r *NoteRepository) PurgeTombstones(ctx context.Context, retentionDays int) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx,
+		`WITH purged AS (
+			DELETE FROM note_tombstones WHERE deleted_at < NOW() - make_interval(days => $1)
+			RETURNING user_id, seq
+		), horizon AS (
+			UPDATE note_versions v SET purged_seq = GREATEST(v.purged_seq, p.max_seq)
+			FROM (SELECT user_id, MAX(seq) AS max_seq FROM purged GROUP BY user_id) p
+			WHERE v.user_id = p.user_id
+		)
+		SELECT COUNT(*) FROM purged`,
+		retentionDays,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("repo: purge-tombstones: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM note_client_ids WHERE created_at < NOW() - make_interval(days => $1)`, retentionDays,
+	); err != nil {
+		return n, fmt.Errorf("repo: purge-client-ids: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"myproject/models"
+)
+
+const templateColumns = `id, COALESCE(user_id, 0), user_id IS NULL, name, locale, title, content, format, fields, created_at, updated_at`
+
+// ErrTemplateExists — у владельца уже есть шаблон с таким name и locale
+var ErrTemplateExists = errors.New("template already exists")
+
+type TemplateRepository struct {
+	db *sql.DB
+}
+
+func CreateTemplateRepository(db *sql.DB) *TemplateRepository {
+	return &TemplateRepository{db: db}
+}
+
+func scanTemplate(row rowScanner) (models.Template, error) {
+	var t models.Template
+	var fields []byte
+	err := row.Scan(&t.ID, &t.UserID, &t.System, &t.Name, &t.Locale, &t.Title, &t.Content, &t.Format, &fields,
+		&t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(fields, &t.Fields); err != nil {
+		return t, fmt.Errorf("decode fields: %w", err)
+	}
+	return t, nil
+}
+
+// Шаблоны пользователя и системные; locale != "" — только этой локали
+func (r *TemplateRepository) List(ctx context.Context, userID int, locale string) ([]models.Template, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+templateColumns+` FROM note_templates
+		 WHERE (user_id = $1 OR user_id IS NULL) AND ($2 = '' OR locale = $2)
+		 ORDER BY user_id IS NULL, name, locale`,
+		userID, locale,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: list templates: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repo: list templates: %w", err)
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: list templates: %w", err)
+	}
+	return list, nil
+}
+
+// Шаблон пользователя или системный
+func (r *TemplateRepository) Get(ctx context.Context, userID int, id int64) (models.Template, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+templateColumns+` FROM note_templates WHERE id = $1 AND (user_id = $2 OR user_id IS NULL)`,
+		id, userID,
+	)
+	t, err := scanTemplate(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Template{}, ErrNotFound
+		}
+		return models.Template{}, fmt.Errorf("repo: get template id=%d: %w", id, err)
+	}
+	return t, nil
+}
+
+// Системный шаблон name первой найденной локали из locales
+func (r *TemplateRepository) FindSystem(ctx context.Context, name string, locales []string) (models.Template, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+templateColumns+` FROM note_templates
+		 WHERE user_id IS NULL AND name = $1 AND locale = ANY($2)
+		 ORDER BY array_position($2, locale) LIMIT 1`,
+		name, pq.Array(locales),
+	)
+	t, err := scanTemplate(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Template{}, ErrNotFound
+		}
+		return models.Template{}, fmt.Errorf("repo: find template %q: %w", name, err)
+	}
+	return t, nil
+}
+
+// Создать шаблон; UserID = 0 — системный
+func (r *TemplateRepository) Create(ctx context.Context, t models.Template) (models.Template, error) {
+	fields, err := json.Marshal(t.Fields)
+	if err != nil {
+		return models.Template{}, err
+	}
+	row := r.db.QueryRowContext(ctx,
+		`INSERT INTO note_templates (user_id, name, locale, title, content, format, fields)
+		 VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT ((COALESCE(user_id, 0)), name, locale) DO NOTHING
+		 RETURNING `+templateColumns,
+		t.UserID, t.Name, t.Locale, t.Title, t.Content, t.Format, fields,
+	)
+	created, err := scanTemplate(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Template{}, ErrTemplateExists
+		}
+		return models.Template{}, fmt.Errorf("repo: create template: %w", err)
+	}
+	return created, nil
+}
+
+// Перезаписать шаблон целиком (права проверяет сервис)
+func (r *TemplateRepository) Update(ctx context.Context, t models.Template) (models.Template, error) {
+	fields, err := json.Marshal(t.Fields)
+	if err != nil {
+		return models.Template{}, err
+	}
+	row := r.db.QueryRowContext(ctx,
+		`UPDATE note_templates
+		 SET name = $2, locale = $3, title = $4, content = $5, format = $6, fields = $7, updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING `+templateColumns,
+		t.ID, t.Name, t.Locale, t.Title, t.Content, t.Format, fields,
+	)
+	updated, err := scanTemplate(row)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.Template{}, ErrNotFound
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			return models.Template{}, ErrTemplateExists
+		}
+		return models.Template{}, fmt.Errorf("repo: update template id=%d: %w", t.ID, err)
+	}
+	return updated, nil
+}
+
+func (r *TemplateRepository) Delete(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM note_templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("repo: delete template id=%d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
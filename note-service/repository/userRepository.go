@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"myproject/models"
+)
+
+// UserRepository — пользователи в note-service (note_users)
+type UserRepository struct {
+	db *sql.DB
+}
+
+func CreateUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Сохранить профиль пользователя; пустое значение не затирает известное
+func (r *UserRepository) Save(ctx context.Context, p models.UserProfile) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO note_users (user_id, email, locale, timezone) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id) DO UPDATE SET
+		     email = COALESCE(NULLIF(EXCLUDED.email, ''), note_users.email),
+		     locale = COALESCE(NULLIF(EXCLUDED.locale, ''), note_users.locale),
+		     timezone = COALESCE(NULLIF(EXCLUDED.timezone, ''), note_users.timezone),
+		     updated_at = NOW()`,
+		p.UserID, p.Email, p.Locale, p.Timezone,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: save profile user=%d: %w", p.UserID, err)
+	}
+	return nil
+}
+
+// Профиль пользователя; неизвестный пользователь — пустой профиль
+func (r *UserRepository) Get(ctx context.Context, userID int) (models.UserProfile, error) {
+	p := models.UserProfile{UserID: userID}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT email, locale, timezone FROM note_users WHERE user_id = $1`, userID,
+	).Scan(&p.Email, &p.Locale, &p.Timezone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("repo: profile user=%d: %w", userID, err)
+	}
+	return p, nil
+}
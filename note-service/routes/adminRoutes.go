@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/cache"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAdminRoutes(r gin.IRouter, s service.NoteService, c *cache.NotesCache) {
+	admin := r.Group("/admin")
+	admin.Use(midleware.AuthMiddleware())
+	admin.Use(midleware.RequireRole(auth.RoleAdmin, auth.RoleSupport))
+
+	admin.GET("/users/:id/notes/count", handlers.GetUserNoteCount(s))
+	admin.GET("/cache/stats", handlers.GetCacheStats(c))
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAttachmentRoutes(r gin.IRouter, s service.AttachmentService, maxBytes int64) {
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
+
+	read := midleware.RequireScope(auth.ScopeNotesRead)
+	write := midleware.RequireScope(auth.ScopeNotesWrite)
+
+	authed.POST("/notes/:id/attachments", write, handlers.UploadAttachment(s, maxBytes))
+	authed.GET("/notes/:id/attachments", read, handlers.ListAttachments(s))
+	authed.GET("/notes/:id/attachments/:aid", read, handlers.GetAttachment(s))
+	authed.DELETE("/notes/:id/attachments/:aid", write, handlers.DeleteAttachment(s))
+	authed.GET("/users/me/storage", read, handlers.GetStorageUsage(s))
+
+	// ссылки подписаны сервисом — токен не нужен
+	r.GET("/attachments/:id/content", handlers.DownloadAttachment(s, service.VariantContent))
+	r.GET("/attachments/:id/thumbnail", handlers.DownloadAttachment(s, service.VariantThumbnail))
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"myproject/audit"
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAuditRoutes(r gin.IRouter, rec *audit.Recorder) {
+	me := r.Group("/users/me")
+	me.Use(midleware.AuthMiddleware())
+	me.GET("/audit", midleware.RequireScope(auth.ScopeNotesRead), handlers.GetMyAudit(rec))
+
+	admin := r.Group("/admin")
+	admin.Use(midleware.AuthMiddleware())
+	admin.GET("/audit", midleware.RequireRole(auth.RoleAdmin), handlers.GetAudit(rec))
+}
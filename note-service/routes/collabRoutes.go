@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/collab"
+	"myproject/handlers"
+	"myproject/midleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterCollabRoutes(r gin.IRouter, h *collab.Hub) {
+	// браузерный WebSocket не шлёт Authorization — токен параметром
+	notes := r.Group("/notes")
+	notes.Use(midleware.TokenFromQuery(), midleware.AuthMiddleware(), midleware.RequireScope(auth.ScopeNotesWrite))
+
+	notes.GET("/:id/collab", handlers.CollabWebSocket(h))
+}
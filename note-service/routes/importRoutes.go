@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterImportRoutes(r gin.IRouter, s service.ImportService, maxBytes int64) {
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
+
+	authed.POST("/notes/import", midleware.RequireScope(auth.ScopeNotesWrite), handlers.StartImport(s, maxBytes))
+	authed.GET("/imports/:id", midleware.RequireScope(auth.ScopeNotesRead), handlers.GetImport(s))
+}
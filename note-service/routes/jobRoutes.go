@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/jobs"
+	"myproject/midleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterJobRoutes(r gin.IRouter, q *jobs.Queue) {
+	authed := r.Group("/jobs")
+	authed.Use(midleware.AuthMiddleware())
+
+	authed.GET("", midleware.RequireScope(auth.ScopeNotesRead), handlers.ListJobs(q))
+	authed.GET("/:id", midleware.RequireScope(auth.ScopeNotesRead), handlers.GetJob(q))
+	authed.POST("/:id/cancel", midleware.RequireScope(auth.ScopeNotesWrite), handlers.CancelJob(q))
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"myproject/auth"
 	"myproject/handlers"
 	"myproject/midleware"
 	"myproject/service"
@@ -8,14 +9,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterNoteRoutes(r gin.IRouter, s service.NoteService) {
+func RegisterNoteRoutes(r gin.IRouter, s service.NoteService, t service.TemplateService) {
 	// Группа маршрутов, которые требуют авторизации
-	auth := r.Group("/")
-	auth.Use(midleware.AuthMiddleware())
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
 
-	auth.GET("/notes", handlers.GetAllNotes(s))
-	auth.GET("/notes/:id", handlers.GetNote(s))
-	auth.POST("/notes", handlers.CreateNote(s))
-	auth.DELETE("/notes/:id", handlers.DeleteNote(s))
-	auth.PATCH("/notes/:id", handlers.UpdateNote(s))
+	// PAT-токены ограничены scope'ами, JWT имеет все права
+	read := midleware.RequireScope(auth.ScopeNotesRead)
+	write := midleware.RequireScope(auth.ScopeNotesWrite)
+
+	authed.GET("/notes", read, handlers.GetAllNotes(s))
+	authed.GET("/notes/export", read, handlers.ExportNotes(s))
+	authed.GET("/notes/:id", read, handlers.GetNote(s))
+	authed.POST("/notes", write, handlers.CreateNote(s, t))
+	authed.POST("/notes/batch", write, handlers.BatchNotes(s))
+	authed.DELETE("/notes/:id", write, handlers.DeleteNote(s))
+	authed.PATCH("/notes/:id", write, handlers.UpdateNote(s))
 }
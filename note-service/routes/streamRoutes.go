@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterStreamRoutes(r gin.IRouter, b *notify.Broker) {
+	// токен можно передать и параметром: браузерные EventSource и WebSocket
+	// не шлют Authorization
+	stream := r.Group("/notes")
+	stream.Use(midleware.TokenFromQuery(), midleware.AuthMiddleware(), midleware.RequireScope(auth.ScopeNotesRead))
+
+	stream.GET("/stream", handlers.StreamNotes(b))
+	stream.GET("/ws", handlers.NotesWebSocket(b))
+}
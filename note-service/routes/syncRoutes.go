@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterSyncRoutes(r gin.IRouter, s service.SyncService) {
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
+
+	authed.GET("/sync", midleware.RequireScope(auth.ScopeNotesRead), handlers.GetSyncChanges(s))
+	authed.POST("/sync", midleware.RequireScope(auth.ScopeNotesWrite), handlers.PushSyncChanges(s))
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterTemplateRoutes(r gin.IRouter, s service.TemplateService) {
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
+
+	read := midleware.RequireScope(auth.ScopeNotesRead)
+	write := midleware.RequireScope(auth.ScopeNotesWrite)
+
+	authed.GET("/templates", read, handlers.ListTemplates(s))
+	authed.GET("/templates/:id", read, handlers.GetTemplate(s))
+	authed.POST("/templates", write, handlers.CreateTemplate(s, false))
+	authed.PATCH("/templates/:id", write, handlers.UpdateTemplate(s))
+	authed.DELETE("/templates/:id", write, handlers.DeleteTemplate(s))
+
+	// системные шаблоны (в том числе приветственный) — только администраторы
+	admin := r.Group("/admin")
+	admin.Use(midleware.AuthMiddleware())
+	admin.Use(midleware.RequireRole(auth.RoleAdmin))
+	admin.POST("/templates", handlers.CreateTemplate(s, true))
+}
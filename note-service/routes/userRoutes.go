@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"myproject/auth"
+	"myproject/handlers"
+	"myproject/midleware"
+	"myproject/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterUserRoutes(r gin.IRouter, s service.UserService) {
+	authed := r.Group("/")
+	authed.Use(midleware.AuthMiddleware())
+
+	read := midleware.RequireScope(auth.ScopeNotesRead)
+	write := midleware.RequireScope(auth.ScopeNotesWrite)
+
+	authed.GET("/users/me/settings", read, handlers.GetUserSettings(s))
+	authed.PATCH("/users/me/settings", write, handlers.UpdateUserSettings(s))
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"myproject/audit"
+	"myproject/blob"
+	"myproject/internal/logger"
+	"myproject/jobs"
+	"myproject/media"
+	"myproject/models"
+	"myproject/repository"
+)
+
+// JobBlobDelete — задача удаления файлов; ставит её триггер на attachments
+const JobBlobDelete = "blob.delete"
+
+// Что скачивается по подписанной ссылке
+const (
+	VariantContent   = "content"
+	VariantThumbnail = "thumbnail"
+)
+
+const maxFileNameLen = 255
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentEmpty    = errors.New("file is empty")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+	ErrInvalidSignature   = errors.New("invalid download link signature")
+	ErrLinkExpired        = errors.New("download link expired")
+)
+
+type AttachmentService interface {
+	Upload(ctx context.Context, userID, noteID int, fileName string, size int64, r io.ReadSeeker) (models.Attachment, error)
+	ListAttachments(ctx context.Context, userID, noteID int) ([]models.Attachment, error)
+	GetAttachment(ctx context.Context, userID, noteID int, id int64) (models.Attachment, error)
+	DeleteAttachment(ctx context.Context, userID, noteID int, id int64) error
+	StorageUsage(ctx context.Context, userID int) (models.StorageUsage, error)
+	Download(ctx context.Context, id int64, variant string, expires int64, sig string) (Download, error)
+}
+
+// Download — открытый файл для ответа на скачивание. Size < 0 — неизвестен.
+type Download struct {
+	Body        io.ReadCloser
+	ContentType string
+	FileName    string
+	Size        int64
+}
+
+// AttachmentConfig — квота и параметры подписанных ссылок
+type AttachmentConfig struct {
+	// байт на пользователя, по всем вложениям
+	Quota int64
+	// длинная сторона миниатюры, px
+	ThumbnailSize int
+	// ключ HMAC для ссылок; у всех реплик должен быть один
+	URLSecret []byte
+	URLTTL    time.Duration
+	// префикс ссылок, например https://notes.example.com; пусто — относительные
+	BaseURL string
+}
+
+type attachmentService struct {
+	repo  *repository.AttachmentRepository
+	store blob.BlobStore
+	audit *audit.Recorder
+	cfg   AttachmentConfig
+	now   func() time.Time
+}
+
+// blobDeleteJob — данные задачи JobBlobDelete
+type blobDeleteJob struct {
+	Keys []string `json:"keys"`
+}
+
+func CreateAttachmentService(repo *repository.AttachmentRepository, store blob.BlobStore, auditor *audit.Recorder, cfg AttachmentConfig) *attachmentService {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return &attachmentService{
+		repo:  repo,
+		store: store,
+		audit: auditor,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Upload сохраняет файл и прикрепляет его к заметке. Тип определяется по
+// содержимому — заголовку клиента не верим. Для картинок строится миниатюра.
+// Файлы пишутся в хранилище до записи в БД; если запись не удалась, они
+// удаляются.
+func (s *attachmentService) Upload(ctx context.Context, userID, noteID int, fileName string, size int64, r io.ReadSeeker) (models.Attachment, error) {
+	if userID <= 0 {
+		return models.Attachment{}, ErrInvalidUserID
+	}
+	if noteID <= 0 {
+		return models.Attachment{}, ErrInvalidID
+	}
+	if size <= 0 {
+		return models.Attachment{}, ErrAttachmentEmpty
+	}
+
+	// заведомо не влезающий файл не гоняем в хранилище; окончательная
+	// проверка — в транзакции вместе со вставкой
+	used, _, err := s.repo.Usage(ctx, userID)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+	}
+	if used+size > s.cfg.Quota {
+		return models.Attachment{}, ErrQuotaExceeded
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return models.Attachment{}, fmt.Errorf("service: upload-attachment: read: %w", err)
+	}
+	contentType := http.DetectContentType(head[:n])
+
+	a := models.Attachment{
+		NoteID:      noteID,
+		UserID:      userID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		BlobKey:     fmt.Sprintf("users/%d/%s", userID, uuid.NewString()),
+	}
+
+	if media.IsImage(contentType) {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+		}
+		thumb, err := media.Make(r, contentType, s.cfg.ThumbnailSize)
+		if err != nil {
+			// файл всё равно сохраняем, просто без миниатюры
+			logger.Errorf("attachment user=%d note=%d: thumbnail: %v", userID, noteID, err)
+		} else {
+			a.Width, a.Height = thumb.Width, thumb.Height
+			a.ThumbKey = a.BlobKey + ".thumb"
+			if err := s.store.Put(ctx, a.ThumbKey, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType); err != nil {
+				return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+			}
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		s.removeBlobs(ctx, a)
+		return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+	}
+	hash := sha256.New()
+	if err := s.store.Put(ctx, a.BlobKey, io.TeeReader(r, hash), size, contentType); err != nil {
+		s.removeBlobs(ctx, a)
+		return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+	}
+	a.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	created, err := s.repo.Create(ctx, a, s.cfg.Quota)
+	if err != nil {
+		s.removeBlobs(ctx, a)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return models.Attachment{}, ErrNoteNotFound
+		case errors.Is(err, repository.ErrQuotaExceeded):
+			return models.Attachment{}, ErrQuotaExceeded
+		}
+		return models.Attachment{}, fmt.Errorf("service: upload-attachment: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionAttachmentCreate, ActorID: userID, UserID: userID,
+		TargetType: "attachment", TargetID: fmt.Sprint(created.ID),
+		After: created,
+	})
+	return s.withURLs(created), nil
+}
+
+// Вложения заметки со свежими ссылками на скачивание
+func (s *attachmentService) ListAttachments(ctx context.Context, userID, noteID int) ([]models.Attachment, error) {
+	if userID <= 0 {
+		return nil, ErrInvalidUserID
+	}
+	if noteID <= 0 {
+		return nil, ErrInvalidID
+	}
+	list, err := s.repo.List(ctx, userID, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("service: list-attachments: %w", err)
+	}
+	for i := range list {
+		list[i] = s.withURLs(list[i])
+	}
+	return list, nil
+}
+
+func (s *attachmentService) GetAttachment(ctx context.Context, userID, noteID int, id int64) (models.Attachment, error) {
+	if userID <= 0 {
+		return models.Attachment{}, ErrInvalidUserID
+	}
+	if noteID <= 0 || id <= 0 {
+		return models.Attachment{}, ErrAttachmentNotFound
+	}
+	a, err := s.repo.Get(ctx, userID, noteID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.Attachment{}, ErrAttachmentNotFound
+		}
+		return models.Attachment{}, fmt.Errorf("service: get-attachment: %w", err)
+	}
+	return s.withURLs(a), nil
+}
+
+// Удалить вложение; сами файлы удалит фоновая задача
+func (s *attachmentService) DeleteAttachment(ctx context.Context, userID, noteID int, id int64) error {
+	if userID <= 0 {
+		return ErrInvalidUserID
+	}
+	if noteID <= 0 || id <= 0 {
+		return ErrAttachmentNotFound
+	}
+	before, err := s.repo.Delete(ctx, userID, noteID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAttachmentNotFound
+		}
+		return fmt.Errorf("service: delete-attachment: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionAttachmentDelete, ActorID: userID, UserID: userID,
+		TargetType: "attachment", TargetID: fmt.Sprint(id),
+		Before: before,
+	})
+	return nil
+}
+
+func (s *attachmentService) StorageUsage(ctx context.Context, userID int) (models.StorageUsage, error) {
+	if userID <= 0 {
+		return models.StorageUsage{}, ErrInvalidUserID
+	}
+	used, files, err := s.repo.Usage(ctx, userID)
+	if err != nil {
+		return models.StorageUsage{}, fmt.Errorf("service: storage-usage: %w", err)
+	}
+	return models.StorageUsage{Used: used, Quota: s.cfg.Quota, Files: files}, nil
+}
+
+// Download открывает файл по подписанной ссылке. Подпись проверяется до
+// похода в БД: перебирать id без ключа бессмысленно.
+func (s *attachmentService) Download(ctx context.Context, id int64, variant string, expires int64, sig string) (Download, error) {
+	if !hmac.Equal([]byte(sig), []byte(s.signature(id, variant, expires))) {
+		return Download{}, ErrInvalidSignature
+	}
+	if s.now().Unix() > expires {
+		return Download{}, ErrLinkExpired
+	}
+
+	a, err := s.repo.ByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return Download{}, ErrAttachmentNotFound
+		}
+		return Download{}, fmt.Errorf("service: download-attachment: %w", err)
+	}
+
+	d := Download{ContentType: a.ContentType, FileName: a.FileName, Size: a.Size}
+	key := a.BlobKey
+	if variant == VariantThumbnail {
+		if a.ThumbKey == "" {
+			return Download{}, ErrAttachmentNotFound
+		}
+		key = a.ThumbKey
+		d.ContentType = media.ThumbnailType(a.ContentType)
+		d.Size = -1
+	}
+
+	d.Body, err = s.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			// строка есть, файла нет — рассинхрон, его стоит видеть в логе
+			logger.Errorf("attachment=%d: blob %s missing", a.ID, key)
+			return Download{}, ErrAttachmentNotFound
+		}
+		return Download{}, fmt.Errorf("service: download-attachment: %w", err)
+	}
+	return d, nil
+}
+
+// RunBlobDelete — обработчик задачи JobBlobDelete. Удаление отсутствующего
+// файла — не ошибка, поэтому повтор безопасен.
+func (s *attachmentService) RunBlobDelete(ctx context.Context, job models.Job, progress jobs.Progress) error {
+	var p blobDeleteJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	for i, key := range p.Keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+		progress(i+1, len(p.Keys))
+	}
+	return nil
+}
+
+// withURLs подписывает ссылки на файл и миниатюру
+func (s *attachmentService) withURLs(a models.Attachment) models.Attachment {
+	a.URLExpiresAt = s.now().Add(s.cfg.URLTTL).Truncate(time.Second)
+	expires := a.URLExpiresAt.Unix()
+	a.URL = s.signedURL(a.ID, VariantContent, expires)
+	if a.ThumbKey != "" {
+		a.ThumbnailURL = s.signedURL(a.ID, VariantThumbnail, expires)
+	}
+	return a
+}
+
+func (s *attachmentService) signedURL(id int64, variant string, expires int64) string {
+	return fmt.Sprintf("%s/attachments/%d/%s?expires=%d&sig=%s",
+		s.cfg.BaseURL, id, variant, expires, s.signature(id, variant, expires))
+}
+
+func (s *attachmentService) signature(id int64, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.cfg.URLSecret)
+	mac.Write([]byte(strconv.FormatInt(id, 10) + ":" + variant + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// removeBlobs убирает файлы неудавшейся загрузки; ошибку только логируем —
+// осиротевший файл лишь занимает место
+func (s *attachmentService) removeBlobs(ctx context.Context, a models.Attachment) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range []string{a.BlobKey, a.ThumbKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			logger.Errorf("attachment user=%d: cleanup %s: %v", a.UserID, key, err)
+		}
+	}
+}
+
+// cleanFileName оставляет от имени файла клиента только базовое имя без
+// управляющих символов
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if runes := []rune(name); len(runes) > maxFileNameLen {
+		name = string(runes[:maxFileNameLen])
+	}
+	return name
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"myproject/audit"
+	"myproject/cache"
+	"myproject/dto"
+	"myproject/importer"
+	"myproject/internal/logger"
+	"myproject/jobs"
+	"myproject/models"
+	"myproject/notify"
+	"myproject/repository"
+	"myproject/validation"
+)
+
+// JobImport — вид задачи очереди, выполняющей импорт
+const JobImport = "note.import"
+
+const (
+	// как часто сохранять прогресс задания
+	importProgressEvery = 20
+	// больше ошибок в отчёт не пишем, только считаем
+	maxImportErrors = 1000
+)
+
+var (
+	ErrImportNotFound = errors.New("import not found")
+	ErrImportFormat   = errors.New("format must be one of: markdown, enex")
+
+	// в отчёт вместо подробностей сбоя БД; сами они — в логе
+	errImportInternal = errors.New("internal error")
+)
+
+type ImportService interface {
+	StartImport(ctx context.Context, userID int, format string, data []byte) (models.Import, error)
+	GetImport(ctx context.Context, userID int, id int64) (models.Import, error)
+}
+
+type importService struct {
+	imports *repository.ImportRepository
+	notes   *repository.NoteRepository
+	cache   *cache.NotesCache
+	audit   *audit.Recorder
+	queue   *jobs.Queue
+	events  *notify.Broker
+}
+
+// importJob — данные задачи очереди; мета запроса нужна аудиту
+type importJob struct {
+	ImportID int64      `json:"import_id"`
+	Meta     audit.Meta `json:"meta"`
+}
+
+func CreateImportService(imports *repository.ImportRepository, notes *repository.NoteRepository, c *cache.NotesCache, auditor *audit.Recorder, queue *jobs.Queue, events *notify.Broker) *importService {
+	return &importService{
+		imports: imports,
+		notes:   notes,
+		cache:   c,
+		audit:   auditor,
+		queue:   queue,
+		events:  events,
+	}
+}
+
+// Создать задание импорта и запустить его в фоне. Пустой format — определить
+// по содержимому. Файл, который не разбирается целиком, отклоняется сразу.
+func (s *importService) StartImport(ctx context.Context, userID int, format string, data []byte) (models.Import, error) {
+	if userID <= 0 {
+		return models.Import{}, ErrInvalidUserID
+	}
+
+	if format == "" {
+		var err error
+		if format, err = importer.Detect(data); err != nil {
+			return models.Import{}, err
+		}
+	}
+	if !importer.Valid(format) {
+		return models.Import{}, ErrImportFormat
+	}
+	if _, _, err := importer.Parse(format, data); err != nil {
+		return models.Import{}, err
+	}
+
+	imp, err := s.imports.Create(ctx, userID, format, data)
+	if err != nil {
+		return models.Import{}, fmt.Errorf("service: start-import: %w", err)
+	}
+
+	job, err := s.queue.Enqueue(ctx, userID, JobImport, importJob{ImportID: imp.ID, Meta: audit.MetaFrom(ctx)})
+	if err != nil {
+		s.fail(ctx, imp, err)
+		return models.Import{}, fmt.Errorf("service: start-import: %w", err)
+	}
+	if err := s.imports.AttachJob(ctx, imp.ID, job.ID); err != nil {
+		// задание всё равно выполнится, просто без ссылки на задачу
+		logger.Errorf("import=%d: %v", imp.ID, err)
+	} else {
+		imp.JobID = job.ID
+	}
+
+	return imp, nil
+}
+
+// Состояние задания; чужие задания не видны
+func (s *importService) GetImport(ctx context.Context, userID int, id int64) (models.Import, error) {
+	if userID <= 0 {
+		return models.Import{}, ErrInvalidUserID
+	}
+	if id <= 0 {
+		return models.Import{}, ErrImportNotFound
+	}
+
+	imp, err := s.imports.Get(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.Import{}, ErrImportNotFound
+		}
+		return models.Import{}, fmt.Errorf("service: get-import: %w", err)
+	}
+	return imp, nil
+}
+
+// RunJob — обработчик задачи JobImport. Повторная попытка проходит файл
+// заново: уже созданные заметки отсеются как дубликаты.
+func (s *importService) RunJob(ctx context.Context, job models.Job, progress jobs.Progress) error {
+	var p importJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	imp, err := s.imports.ByID(ctx, p.ImportID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if imp.FinishedAt != nil {
+		return nil
+	}
+
+	err = s.run(audit.WithMeta(ctx, p.Meta), imp, progress)
+	// последняя или безнадёжная попытка: очередь больше не повторит задачу
+	if err != nil && ctx.Err() == nil && (jobs.IsPermanent(err) || job.Attempts >= job.MaxAttempts) {
+		s.fail(ctx, imp, err)
+	}
+	return err
+}
+
+// run создаёт заметки по одной: ошибка в одном файле попадает в отчёт и не
+// мешает остальным. Кэш сбрасывается один раз в конце. Отменённое задание
+// сохраняет то, что успело создать.
+func (s *importService) run(ctx context.Context, imp models.Import, progress jobs.Progress) error {
+	if errors.Is(context.Cause(ctx), jobs.ErrCanceled) {
+		imp.Status = models.ImportCanceled
+		s.finish(context.WithoutCancel(ctx), imp)
+		return context.Cause(ctx)
+	}
+
+	source, err := s.imports.Source(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+	total, items, err := importer.Parse(imp.Format, source)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if err := s.imports.Start(ctx, imp.ID, total); err != nil {
+		return err
+	}
+	imp.Status, imp.Total = models.ImportRunning, total
+
+	var created []int
+	var published []notify.Event
+	var version int64
+	for item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		id, v, duplicate, err := s.importItem(ctx, imp, item)
+		imp.Processed++
+		switch {
+		case err != nil:
+			imp.Failed++
+			if len(imp.Errors) < maxImportErrors {
+				imp.Errors = append(imp.Errors, models.ImportError{File: item.File, Message: importErrorMessage(err)})
+			}
+		case duplicate:
+			imp.Duplicates++
+		default:
+			imp.Created++
+			created = append(created, id)
+			version = v
+			published = append(published, notify.Event{Type: notify.NoteCreated, NoteID: id, Note: &models.Note{
+				Id: id, UserID: imp.UserID, Title: item.Title, Content: item.Content, Format: item.Format,
+			}})
+		}
+
+		progress(imp.Processed, imp.Total)
+		if imp.Processed%importProgressEvery == 0 {
+			if err := s.imports.Progress(ctx, imp); err != nil {
+				logger.Errorf("import=%d progress: %v", imp.ID, err)
+			}
+		}
+	}
+
+	// итог пишем и после отмены контекста
+	store := context.WithoutCancel(ctx)
+	if len(created) > 0 {
+		if err := s.cache.InvalidateNotes(store, imp.UserID, created, version); err != nil {
+			fmt.Printf("[CACHE INVALIDATE ERROR] user=%d: %v\n", imp.UserID, err)
+		}
+	}
+	for _, ev := range published {
+		s.events.Publish(store, imp.UserID, ev)
+	}
+
+	if ctx.Err() != nil {
+		if !errors.Is(context.Cause(ctx), jobs.ErrCanceled) {
+			// прервано остановкой сервиса: задание останется running до повтора
+			if err := s.imports.Progress(store, imp); err != nil {
+				logger.Errorf("import=%d progress: %v", imp.ID, err)
+			}
+			return context.Cause(ctx)
+		}
+		imp.Status = models.ImportCanceled
+	} else {
+		imp.Status = models.ImportDone
+	}
+	s.finish(store, imp)
+
+	s.audit.Record(store, audit.Event{
+		Action: audit.ActionNoteImport, ActorID: imp.UserID, UserID: imp.UserID,
+		TargetType: "import", TargetID: fmt.Sprint(imp.ID),
+	})
+	logger.Infof("import=%d user=%d %s: created=%d duplicates=%d failed=%d",
+		imp.ID, imp.UserID, imp.Status, imp.Created, imp.Duplicates, imp.Failed)
+	if imp.Status == models.ImportCanceled {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// importItem создаёт заметку, если такой (тот же заголовок и текст) у
+// пользователя ещё нет
+func (s *importService) importItem(ctx context.Context, imp models.Import, item importer.Item) (int, int64, bool, error) {
+	userID := imp.UserID
+	if item.Err != nil {
+		return 0, 0, false, item.Err
+	}
+	if err := validation.Struct(dto.NoteRequest{Title: item.Title, Content: item.Content, Format: item.Format}); err != nil {
+		return 0, 0, false, err
+	}
+
+	exists, err := s.notes.ExistsByHash(ctx, userID, repository.ContentHash(item.Title, item.Content))
+	if err != nil {
+		logger.Errorf("import=%d file=%q: %v", imp.ID, item.File, err)
+		return 0, 0, false, errImportInternal
+	}
+	if exists {
+		return 0, 0, true, nil
+	}
+
+	id, version, err := s.notes.CreateImported(ctx, models.StoredNote{
+		Note:      models.Note{UserID: userID, Title: item.Title, Content: item.Content, Format: item.Format},
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	})
+	if err != nil {
+		logger.Errorf("import=%d file=%q: %v", imp.ID, item.File, err)
+		return 0, 0, false, errImportInternal
+	}
+	return id, version, false, nil
+}
+
+// Текст для отчёта: нарушения проверки без общего префикса
+func importErrorMessage(err error) string {
+	var verr *validation.Error
+	if errors.As(err, &verr) {
+		msgs := make([]string, 0, len(verr.Violations))
+		for _, v := range verr.Violations {
+			msgs = append(msgs, v.Message)
+		}
+		return strings.Join(msgs, "; ")
+	}
+	return err.Error()
+}
+
+func (s *importService) fail(ctx context.Context, imp models.Import, err error) {
+	logger.Errorf("import=%d failed: %v", imp.ID, err)
+	imp.Status, imp.Error = models.ImportFailed, "import failed"
+	s.finish(ctx, imp)
+}
+
+func (s *importService) finish(ctx context.Context, imp models.Import) {
+	if err := s.imports.Finish(ctx, imp); err != nil {
+		logger.Errorf("import=%d finish: %v", imp.ID, err)
+	}
+}
@@ -2,42 +2,98 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"myproject/audit"
 	"myproject/cache"
 	"myproject/dto"
+	"myproject/export"
 	"myproject/models"
+	"myproject/notify"
+	"myproject/render"
 	"myproject/repository"
-	"strings"
+	"myproject/validation"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// сколько ждать, пока другая реплика заполнит кэш, прежде чем идти в БД самим
+	cacheFillWait     = 2 * time.Second
+	cacheFillPoll     = 50 * time.Millisecond
+	cacheRefreshLimit = 5 * time.Second
 )
 
 var (
-	ErrInvalidID      = errors.New("invalid note ID")
-	ErrInvalidUserID  = errors.New("invalid user ID")
-	ErrNoteNotFound   = errors.New("note not found")
-	ErrTitleRequired  = errors.New("title is required")
-	ErrTitleTooLong   = errors.New("title too long")
-	ErrContentTooLong = errors.New("content too long")
+	ErrInvalidID       = errors.New("invalid note ID")
+	ErrInvalidUserID   = errors.New("invalid user ID")
+	ErrNoteNotFound    = errors.New("note not found")
+	ErrNothingToUpdate = errors.New("nothing to update")
+	ErrUnknownBatchOp  = errors.New("op must be one of: create, update, delete")
+	ErrBatchAborted    = errors.New("not applied: another operation of the atomic batch failed")
 )
 
 type NoteService interface {
-    GetNote(ctx context.Context, userID, id int) (models.Note, error)
-    GetAllNotes(ctx context.Context, userID int) ([]models.Note, error)
-    CreateNote(ctx context.Context, userID int, title, content string) (int, error)
-    DeleteNote(ctx context.Context, userID, id int) error
-    UpdateNote(ctx context.Context, userID, id int, req dto.NoteUpdateRequest) (models.Note, error)
+	GetNote(ctx context.Context, userID, id int) (models.Note, error)
+	GetAllNotes(ctx context.Context, userID int) ([]models.Note, error)
+	CreateNote(ctx context.Context, userID int, req dto.NoteRequest) (int, error)
+	DeleteNote(ctx context.Context, userID, id int) error
+	UpdateNote(ctx context.Context, userID, id int, req dto.NoteUpdateRequest) (models.Note, error)
+	CountNotes(ctx context.Context, userID int) (int, error)
+	BatchNotes(ctx context.Context, userID int, req dto.BatchRequest) ([]BatchResult, bool, error)
+	ExportNotes(ctx context.Context, userID int, format string, w io.Writer) error
+	RenderNote(ctx context.Context, userID, id int) (string, error)
+	GetNotesDueBefore(ctx context.Context, userID int, before string) ([]models.Note, error)
+	GetVersionedNote(ctx context.Context, userID, id int) (models.SyncNote, error)
+	SaveContent(ctx context.Context, userID, id int, content string, baseVersion int64) (models.SyncNote, error)
 }
 
+// CollabNotifier — совместное редактирование (collab.Notifier): текст
+// заметки записан в обход него или заметку удалили, открытые сеансы нужно
+// начать заново с notes.content
+type CollabNotifier interface {
+	ContentChanged(ctx context.Context, noteID int)
+}
+
+// BatchResult — итог одной операции пакета. Note — заметка после create или
+// update, у delete — только Id. Err — ошибка именно этой операции.
+type BatchResult struct {
+	Op   string
+	Note models.Note
+	Err  error
+}
 
 type noteService struct {
-	repo *repository.NoteRepository
-	cache *cache.NotesCache
+	repo   *repository.NoteRepository
+	users  *repository.UserRepository
+	cache  *cache.NotesCache
+	audit  *audit.Recorder
+	events *notify.Broker
+	collab CollabNotifier
+
+	// склеивает одновременные промахи по одному пользователю внутри процесса
+	lists singleflight.Group
 }
 
-func CreateNoteService(repo *repository.NoteRepository, c *cache.NotesCache) *noteService {
+func CreateNoteService(repo *repository.NoteRepository, users *repository.UserRepository, c *cache.NotesCache, auditor *audit.Recorder, events *notify.Broker, collab CollabNotifier) *noteService {
 	return &noteService{
-		repo:  repo,
-		cache: c,
+		repo:   repo,
+		users:  users,
+		cache:  c,
+		audit:  auditor,
+		events: events,
+		collab: collab,
+	}
+}
+
+// contentChanged сбрасывает сеансы совместного редактирования заметки
+func contentChanged(ctx context.Context, c CollabNotifier, noteID int) {
+	if c != nil {
+		c.ContentChanged(ctx, noteID)
 	}
 }
 
@@ -50,17 +106,52 @@ func (s *noteService) GetNote(ctx context.Context, userID, id int) (models.Note,
 		return models.Note{}, ErrInvalidID
 	}
 
-	note, err := s.repo.GetById(ctx, userID, id)
+	// 1. Пытаемся взять из кэша, в том числе закэшированный промах
+	if s.cache != nil {
+		note, found, ok, err := s.cache.GetNote(ctx, userID, id)
+		if err != nil {
+			fmt.Printf("[CACHE ERROR] user=%d note=%d: %v\n", userID, id, err)
+		} else if ok {
+			if !found {
+				return models.Note{}, ErrNoteNotFound
+			}
+			return note, nil
+		}
+	}
+
+	// 2. Берём из БД
+	note, version, err := s.repo.GetById(ctx, userID, id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
+			if s.cache != nil {
+				if err := s.cache.SetNotFound(ctx, userID, id, version); err != nil {
+					fmt.Printf("[CACHE SET ERROR] user=%d note=%d: %v\n", userID, id, err)
+				}
+			}
 			return models.Note{}, ErrNoteNotFound
 		}
 		return models.Note{}, fmt.Errorf("service: get-note-by-id id = %d: %w", id, err)
 	}
 
+	// 3. Кладём в кэш, если за время чтения заметки не менялись
+	if s.cache != nil {
+		if err := s.cache.FillNote(ctx, note, version); err != nil {
+			fmt.Printf("[CACHE SET ERROR] user=%d note=%d: %v\n", userID, id, err)
+		}
+	}
+
 	return note, nil
 }
 
+// Записать изменённую заметку в кэш; ошибка кэша не должна ломать запрос
+func (s *noteService) cacheNote(ctx context.Context, note models.Note, version int64) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.SetNote(ctx, note, version); err != nil {
+		fmt.Printf("[CACHE SET ERROR] user=%d note=%d: %v\n", note.UserID, note.Id, err)
+	}
+}
 
 // Получить все заметки пользователя
 func (s *noteService) GetAllNotes(ctx context.Context, userID int) ([]models.Note, error) {
@@ -68,60 +159,134 @@ func (s *noteService) GetAllNotes(ctx context.Context, userID int) ([]models.Not
 		return nil, ErrInvalidUserID
 	}
 
-	// 1. Пытаемся взять из кэша
-	if s.cache != nil {
-		if notes, ok, err := s.cache.GetNotes(ctx, userID); err == nil && ok {
-			fmt.Printf("[CACHE HIT] user=%d\n", userID)
-			return notes, nil
-		} else if err != nil {
-			fmt.Printf("[CACHE ERROR] user=%d: %v\n", userID, err)
+	// 1. Пытаемся взять из кэша; устаревший список отдаём сразу,
+	// а обновляем его в фоне
+	if notes, ok, stale, err := s.cache.GetNotes(ctx, userID); err == nil && ok {
+		if stale {
+			fmt.Printf("[CACHE STALE] user=%d\n", userID)
+			go s.refreshNotes(userID)
 		} else {
-			fmt.Printf("[CACHE MISS] user=%d\n", userID)
+			fmt.Printf("[CACHE HIT] user=%d\n", userID)
 		}
+		return notes, nil
+	} else if err != nil {
+		fmt.Printf("[CACHE ERROR] user=%d: %v\n", userID, err)
+	} else {
+		fmt.Printf("[CACHE MISS] user=%d\n", userID)
 	}
 
-	// 2. Берём из БД
-	notes, err := s.repo.GetAll(ctx, userID)
+	// 2. Берём из БД — один запрос на пользователя, сколько бы ни было промахов
+	v, err, _ := s.lists.Do(strconv.Itoa(userID), func() (any, error) {
+		return s.loadNotes(context.WithoutCancel(ctx), userID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("service: get-all-notes: %w", err)
 	}
+	return v.([]models.Note), nil
+}
 
-	// 3. Кладём в кэш
-	if s.cache != nil {
-		if err := s.cache.SetNotes(ctx, userID, notes); err != nil {
-			fmt.Printf("[CACHE SET ERROR] user=%d: %v\n", userID, err)
+// loadNotes читает список из БД и кладёт в кэш. Если список уже перечитывает
+// другая реплика, сначала ждём, пока он появится в кэше.
+func (s *noteService) loadNotes(ctx context.Context, userID int) ([]models.Note, error) {
+	release, locked, err := s.cache.LockNotes(ctx, userID)
+	if err != nil {
+		fmt.Printf("[CACHE LOCK ERROR] user=%d: %v\n", userID, err)
+	}
+	defer release()
+
+	if !locked && err == nil {
+		deadline := time.Now().Add(cacheFillWait)
+		for time.Now().Before(deadline) {
+			time.Sleep(cacheFillPoll)
+			if notes, ok, _, err := s.cache.GetNotes(ctx, userID); err == nil && ok {
+				return notes, nil
+			}
 		}
+		fmt.Printf("[CACHE LOCK TIMEOUT] user=%d\n", userID)
+	}
+
+	notes, version, err := s.repo.GetAll(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
+	// без блокировки не пишем: кэш заполнит её владелец
+	if locked {
+		if err := s.cache.SetNotes(ctx, userID, notes, version); err != nil {
+			fmt.Printf("[CACHE SET ERROR] user=%d: %v\n", userID, err)
+		}
+	}
 	return notes, nil
 }
 
+// refreshNotes обновляет устаревший список в фоне. Если обновлением уже
+// занят этот процесс или другая реплика, ничего не делает.
+func (s *noteService) refreshNotes(userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheRefreshLimit)
+	defer cancel()
+
+	// отдельный ключ: ожидающие промахи не должны получить пустой результат
+	// отказавшегося обновления
+	_, _, _ = s.lists.Do("refresh:"+strconv.Itoa(userID), func() (any, error) {
+		release, locked, err := s.cache.LockNotes(ctx, userID)
+		defer release()
+		if err != nil || !locked {
+			return nil, err
+		}
+
+		notes, version, err := s.repo.GetAll(ctx, userID)
+		if err != nil {
+			fmt.Printf("[CACHE REFRESH ERROR] user=%d: %v\n", userID, err)
+			return nil, err
+		}
+		if err := s.cache.SetNotes(ctx, userID, notes, version); err != nil {
+			fmt.Printf("[CACHE SET ERROR] user=%d: %v\n", userID, err)
+		}
+		return notes, nil
+	})
+}
+
 // Создать заметку для пользователя
-func (s *noteService) CreateNote(ctx context.Context, userID int, title, content string) (int, error) {
+func (s *noteService) CreateNote(ctx context.Context, userID int, req dto.NoteRequest) (int, error) {
 	if userID <= 0 {
 		return 0, ErrInvalidUserID
 	}
 
-	if strings.TrimSpace(title) == "" {
-		return 0, ErrTitleRequired
+	if err := validation.Struct(req); err != nil {
+		return 0, err
 	}
-	if len(title) > 255 {
-		return 0, ErrTitleTooLong
+	if req.Format == "" {
+		req.Format = models.FormatPlain
 	}
-	if len(content) > 5000 {
-		return 0, ErrContentTooLong
+
+	created := models.Note{UserID: userID, Title: req.Title, Content: req.Content, Format: req.Format}
+	if req.DueAt != nil || req.RemindAt != nil {
+		loc, err := userLocation(ctx, s.users, userID)
+		if err != nil {
+			return 0, fmt.Errorf("service: create-note: %w", err)
+		}
+		if created.DueAt, err = parseTimeField("due_at", req.DueAt, loc); err != nil {
+			return 0, err
+		}
+		if created.RemindAt, err = parseTimeField("remind_at", req.RemindAt, loc); err != nil {
+			return 0, err
+		}
 	}
 
-	id, err := s.repo.Create(ctx, userID, title, content)
+	id, version, err := s.repo.Create(ctx, created)
 	if err != nil {
 		return 0, fmt.Errorf("service: create-note: %w", err)
 	}
+	created.Id = id
 
-	if s.cache != nil {
-		if err := s.cache.Invalidate(ctx, userID); err != nil {
-			fmt.Printf("cache invalidate error for user %d: %v\n", userID, err)
-		}
-	}
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionNoteCreate, ActorID: userID, UserID: userID,
+		TargetType: "note", TargetID: fmt.Sprint(id),
+		After: created,
+	})
+
+	s.cacheNote(ctx, created, version)
+	s.events.Publish(ctx, userID, notify.Event{Type: notify.NoteCreated, NoteID: id, Note: &created})
 
 	return id, nil
 }
@@ -135,23 +300,32 @@ func (s *noteService) DeleteNote(ctx context.Context, userID, id int) error {
 		return ErrInvalidID
 	}
 
-	if err := s.repo.Delete(ctx, userID, id); err != nil {
+	// прежнее состояние — для хэша в журнале аудита
+	before, version, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return ErrNoteNotFound
 		}
 		return fmt.Errorf("service: delete-note id = %d: %w", id, err)
 	}
+	contentChanged(ctx, s.collab, id)
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionNoteDelete, ActorID: userID, UserID: userID,
+		TargetType: "note", TargetID: fmt.Sprint(id),
+		Before: before,
+	})
 
 	if s.cache != nil {
-		if err := s.cache.Invalidate(ctx, userID); err != nil {
-			fmt.Printf("cache invalidate error for user %d: %v\n", userID, err)
+		if err := s.cache.DeleteNote(ctx, userID, id, version); err != nil {
+			fmt.Printf("cache delete error for user %d note %d: %v\n", userID, id, err)
 		}
 	}
+	s.events.Publish(ctx, userID, notify.Event{Type: notify.NoteDeleted, NoteID: id})
 
 	return nil
 }
 
-
 // Частично обновить заметку пользователя (PATCH)
 func (s *noteService) UpdateNote(ctx context.Context, userID, id int, req dto.NoteUpdateRequest) (models.Note, error) {
 	if userID <= 0 {
@@ -161,40 +335,364 @@ func (s *noteService) UpdateNote(ctx context.Context, userID, id int, req dto.No
 		return models.Note{}, ErrInvalidID
 	}
 
-	if req.Title == nil && req.Content == nil {
-		return models.Note{}, errors.New("nothing to update")
+	if req.Title == nil && req.Content == nil && req.Format == nil && !req.DueAt.Set && !req.RemindAt.Set {
+		return models.Note{}, ErrNothingToUpdate
 	}
 
-	if req.Title != nil {
-		title := strings.TrimSpace(*req.Title)
-		if len(title) == 0 {
-			return models.Note{}, ErrTitleRequired
+	if err := validation.Struct(req); err != nil {
+		return models.Note{}, err
+	}
+	patch := repository.NotePatch{Title: req.Title, Content: req.Content, Format: req.Format}
+	if req.DueAt.Set || req.RemindAt.Set {
+		loc, err := userLocation(ctx, s.users, userID)
+		if err != nil {
+			return models.Note{}, fmt.Errorf("service: update-note: %w", err)
 		}
-		if len(title) > 250 {
-			return models.Note{}, ErrTitleTooLong
+		if patch.DueAt, err = parseNullableTime("due_at", req.DueAt, loc); err != nil {
+			return models.Note{}, err
 		}
-	}
-
-	if req.Content != nil {
-		if len(*req.Content) > 5000 {
-			return models.Note{}, ErrContentTooLong
+		if patch.RemindAt, err = parseNullableTime("remind_at", req.RemindAt, loc); err != nil {
+			return models.Note{}, err
 		}
 	}
 
-	updated, err := s.repo.Update(ctx, userID, id, req.Title, req.Content)
+	before, updated, version, err := s.repo.Update(ctx, userID, id, patch)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return models.Note{}, ErrNoteNotFound
 		}
 		return models.Note{}, fmt.Errorf("service: update-note: %w", err)
 	}
+	if req.Content != nil {
+		contentChanged(ctx, s.collab, id)
+	}
 
-	if s.cache != nil {
-		if err := s.cache.Invalidate(ctx, userID); err != nil {
-			fmt.Printf("cache invalidate error for user %d: %v\n", userID, err)
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionNoteUpdate, ActorID: userID, UserID: userID,
+		TargetType: "note", TargetID: fmt.Sprint(id),
+		Before: before, After: updated,
+	})
+
+	s.cacheNote(ctx, updated, version)
+	s.events.Publish(ctx, userID, notify.Event{Type: notify.NoteUpdated, NoteID: id, Note: &updated})
+
+	return updated, nil
+}
+
+// parseNullableTime — изменение срока из PATCH; nil — поле не передано
+func parseNullableTime(field string, v dto.Nullable[string], loc *time.Location) (*sql.NullTime, error) {
+	if !v.Set {
+		return nil, nil
+	}
+	if v.Null {
+		return &sql.NullTime{}, nil
+	}
+	t, err := parseTimeField(field, &v.Value, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &sql.NullTime{Time: *t, Valid: true}, nil
+}
+
+// Заметки со сроком раньше before (время как в due_at), ближайшие сначала
+func (s *noteService) GetNotesDueBefore(ctx context.Context, userID int, before string) ([]models.Note, error) {
+	if userID <= 0 {
+		return nil, ErrInvalidUserID
+	}
+	loc, err := userLocation(ctx, s.users, userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: due-notes: %w", err)
+	}
+	limit, err := ParseTime(before, loc)
+	if err != nil {
+		return nil, invalid("due_before", err)
+	}
+
+	due, err := s.repo.DueBefore(ctx, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: due-notes: %w", err)
+	}
+	return due, nil
+}
+
+// GetVersionedNote — заметка с версией (как в /sync) прямо из БД, мимо кэша
+func (s *noteService) GetVersionedNote(ctx context.Context, userID, id int) (models.SyncNote, error) {
+	if userID <= 0 {
+		return models.SyncNote{}, ErrInvalidUserID
+	}
+	if id <= 0 {
+		return models.SyncNote{}, ErrInvalidID
+	}
+	note, err := s.repo.GetVersioned(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.SyncNote{}, ErrNoteNotFound
 		}
+		return models.SyncNote{}, fmt.Errorf("service: get-versioned-note id = %d: %w", id, err)
 	}
+	return note, nil
+}
 
-	return updated, nil
+// SaveContent записывает текст из совместного редактирования, только если
+// заметку с версии baseVersion никто не менял; иначе ErrSyncConflict и
+// текущая заметка. Сеансы редактирования при этом не сбрасываются.
+func (s *noteService) SaveContent(ctx context.Context, userID, id int, content string, baseVersion int64) (models.SyncNote, error) {
+	if err := validation.Struct(dto.NoteUpdateRequest{Content: &content}); err != nil {
+		return models.SyncNote{}, err
+	}
+
+	before, after, version, err := s.repo.UpdateContent(ctx, userID, id, content, baseVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return models.SyncNote{}, ErrNoteNotFound
+		case errors.Is(err, repository.ErrConflict):
+			return after, ErrSyncConflict
+		}
+		return models.SyncNote{}, fmt.Errorf("service: save-content id = %d: %w", id, err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionNoteUpdate, ActorID: userID, UserID: userID,
+		TargetType: "note", TargetID: fmt.Sprint(id),
+		Before: before, After: after.Note,
+	})
+
+	s.cacheNote(ctx, after.Note, version)
+	s.events.Publish(ctx, userID, notify.Event{Type: notify.NoteUpdated, NoteID: id, Note: &after.Note})
+
+	return after, nil
+}
+
+// Количество заметок любого пользователя — для admin/support
+func (s *noteService) CountNotes(ctx context.Context, userID int) (int, error) {
+	if userID <= 0 {
+		return 0, ErrInvalidUserID
+	}
+
+	n, err := s.repo.CountByUser(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("service: count-notes: %w", err)
+	}
+	return n, nil
+}
+
+// Пакет операций в одной транзакции (POST /notes/batch). Каждая операция
+// проверяется так же, как одиночный запрос. В режиме atomic любая ошибка
+// отменяет весь пакет, в режиме partial — только свою операцию. Кэш
+// сбрасывается один раз после коммита. committed=false — ничего не записано.
+func (s *noteService) BatchNotes(ctx context.Context, userID int, req dto.BatchRequest) ([]BatchResult, bool, error) {
+	if userID <= 0 {
+		return nil, false, ErrInvalidUserID
+	}
+	if err := validation.Struct(req); err != nil {
+		return nil, false, err
+	}
+	atomic := req.Mode != dto.BatchPartial
+
+	dated := false
+	for _, op := range req.Operations {
+		dated = dated || op.DueAt.Set || op.RemindAt.Set
+	}
+	loc, err := batchLocation(ctx, s.users, userID, dated)
+	if err != nil {
+		return nil, false, fmt.Errorf("service: batch-notes: %w", err)
+	}
+
+	results := make([]BatchResult, len(req.Operations))
+	ops := make([]repository.BatchOp, 0, len(req.Operations))
+	// номер в запросе для каждой операции, ушедшей в БД
+	index := make([]int, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		results[i].Op = op.Op
+		bop, err := checkBatchOp(op, loc)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		ops = append(ops, bop)
+		index = append(index, i)
+	}
+	if len(ops) == 0 || (atomic && len(ops) < len(req.Operations)) {
+		abortBatch(results)
+		return results, false, nil
+	}
+
+	applied, version, err := s.repo.Batch(ctx, userID, ops, atomic)
+	if err != nil && !errors.Is(err, repository.ErrRolledBack) {
+		return nil, false, fmt.Errorf("service: batch-notes: %w", err)
+	}
+	if err != nil {
+		for j, res := range applied {
+			if res.Err != nil {
+				results[index[j]].Err = batchOpError(index[j], res.Err)
+			}
+		}
+		abortBatch(results)
+		return results, false, nil
+	}
+
+	changed := make([]int, 0, len(ops))
+	published := make([]notify.Event, 0, len(ops))
+	for j, res := range applied {
+		i := index[j]
+		if res.Err != nil {
+			results[i].Err = batchOpError(i, res.Err)
+			continue
+		}
+
+		ev := audit.Event{ActorID: userID, UserID: userID, TargetType: "note"}
+		note := notify.Event{NoteID: res.Before.Id}
+		switch ops[j].Kind {
+		case repository.BatchCreate:
+			results[i].Note = res.After
+			ev.Action, ev.After = audit.ActionNoteCreate, res.After
+			note.Type, note.NoteID, note.Note = notify.NoteCreated, res.After.Id, &res.After
+		case repository.BatchUpdate:
+			results[i].Note = res.After
+			ev.Action, ev.Before, ev.After = audit.ActionNoteUpdate, res.Before, res.After
+			note.Type, note.Note = notify.NoteUpdated, &res.After
+			if ops[j].Content != nil {
+				contentChanged(ctx, s.collab, res.Before.Id)
+			}
+		case repository.BatchDelete:
+			results[i].Note = models.Note{Id: res.Before.Id, UserID: userID}
+			ev.Action, ev.Before = audit.ActionNoteDelete, res.Before
+			note.Type = notify.NoteDeleted
+			contentChanged(ctx, s.collab, res.Before.Id)
+		}
+		ev.TargetID = fmt.Sprint(results[i].Note.Id)
+		s.audit.Record(ctx, ev)
+		changed = append(changed, results[i].Note.Id)
+		published = append(published, note)
+	}
+
+	if len(changed) > 0 {
+		if err := s.cache.InvalidateNotes(ctx, userID, changed, version); err != nil {
+			fmt.Printf("[CACHE INVALIDATE ERROR] user=%d: %v\n", userID, err)
+		}
+	}
+	// события — после сброса кэша: получивший их клиент прочтёт уже новое
+	for _, ev := range published {
+		s.events.Publish(ctx, userID, ev)
+	}
+	return results, true, nil
 }
 
+// checkBatchOp — те же проверки, что у одиночных CreateNote/UpdateNote/DeleteNote.
+// Возвращает операцию для репозитория; местное время сроков — в поясе loc.
+func checkBatchOp(op dto.BatchOperation, loc *time.Location) (repository.BatchOp, error) {
+	bop := repository.BatchOp{Kind: op.Op, ID: op.ID, Title: op.Title, Content: op.Content, Format: op.Format}
+	switch op.Op {
+	case repository.BatchCreate:
+		req := dto.NoteRequest{}
+		if op.Title != nil {
+			req.Title = *op.Title
+		}
+		if op.Content != nil {
+			req.Content = *op.Content
+		}
+		if op.Format != nil {
+			req.Format = *op.Format
+		}
+		if err := validation.Struct(req); err != nil {
+			return bop, err
+		}
+	case repository.BatchUpdate:
+		if op.ID <= 0 {
+			return bop, ErrInvalidID
+		}
+		if op.Title == nil && op.Content == nil && op.Format == nil && !op.DueAt.Set && !op.RemindAt.Set {
+			return bop, ErrNothingToUpdate
+		}
+		if err := validation.Struct(dto.NoteUpdateRequest{Title: op.Title, Content: op.Content, Format: op.Format}); err != nil {
+			return bop, err
+		}
+	case repository.BatchDelete:
+		if op.ID <= 0 {
+			return bop, ErrInvalidID
+		}
+		return bop, nil
+	default:
+		return bop, ErrUnknownBatchOp
+	}
+
+	var err error
+	if bop.DueAt, err = parseNullableTime("due_at", op.DueAt, loc); err != nil {
+		return bop, err
+	}
+	if bop.RemindAt, err = parseNullableTime("remind_at", op.RemindAt, loc); err != nil {
+		return bop, err
+	}
+	return bop, nil
+}
+
+func batchOpError(i int, err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNoteNotFound
+	}
+	return fmt.Errorf("service: batch-notes op=%d: %w", i, err)
+}
+
+// Всё, что не упало само, в откатанном пакете помечается как неприменённое
+func abortBatch(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+	}
+}
+
+// Выгрузить все заметки пользователя в w. Читаем мимо кэша, курсором из
+// одного снимка БД. Ошибка до первой записи в w означает, что ничего не
+// отправлено; после — что выгрузка оборвана.
+func (s *noteService) ExportNotes(ctx context.Context, userID int, format string, w io.Writer) error {
+	if userID <= 0 {
+		return ErrInvalidUserID
+	}
+	if !export.Valid(format) {
+		return export.ErrUnknownFormat
+	}
+
+	cur, err := s.repo.OpenCursor(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("service: export-notes: %w", err)
+	}
+	defer cur.Close()
+
+	if err := export.Write(w, format, cur, time.Now()); err != nil {
+		return fmt.Errorf("service: export-notes: %w", err)
+	}
+	return nil
+}
+
+// Заметка в виде безопасного HTML. Результат кэшируется по содержимому:
+// пока текст и формат не менялись, повторный рендер не нужен.
+func (s *noteService) RenderNote(ctx context.Context, userID, id int) (string, error) {
+	note, err := s.GetNote(ctx, userID, id)
+	if err != nil {
+		return "", err
+	}
+
+	key := render.Key(note.Format, note.Content)
+	if s.cache != nil {
+		html, ok, err := s.cache.GetRendered(ctx, userID, key)
+		if err != nil {
+			fmt.Printf("[CACHE ERROR] user=%d note=%d render: %v\n", userID, id, err)
+		} else if ok {
+			return html, nil
+		}
+	}
+
+	html, err := render.HTML(note.Format, note.Content)
+	if err != nil {
+		return "", fmt.Errorf("service: render-note id = %d: %w", id, err)
+	}
+
+	if s.cache != nil {
+		if err := s.cache.SetRendered(ctx, userID, key, html); err != nil {
+			fmt.Printf("[CACHE SET ERROR] user=%d note=%d render: %v\n", userID, id, err)
+		}
+	}
+	return html, nil
+}
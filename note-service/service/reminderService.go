@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"myproject/internal/logger"
+	"myproject/jobs"
+	"myproject/models"
+	"myproject/repository"
+)
+
+// Задачи напоминаний. JobNoteReminder ставит триггер на notes с run_at =
+// remind_at; JobReminderWebhook ставит её обработчик, если задан вебхук.
+const (
+	JobNoteReminder    = "note.reminder"
+	JobReminderWebhook = "note.reminder.webhook"
+)
+
+// ReminderPublisher отправляет событие note_reminder (в Kafka)
+type ReminderPublisher interface {
+	PublishReminder(ctx context.Context, r models.Reminder) error
+}
+
+// ReminderConfig — необязательный вебхук: POST с событием в JSON, подпись
+// тела — HMAC-SHA256 ключом WebhookSecret в заголовке X-Signature
+type ReminderConfig struct {
+	WebhookURL     string
+	WebhookSecret  []byte
+	WebhookTimeout time.Duration
+}
+
+type reminderService struct {
+	notes     *repository.NoteRepository
+	users     *repository.UserRepository
+	queue     *jobs.Queue
+	publisher ReminderPublisher
+	client    *http.Client
+	cfg       ReminderConfig
+}
+
+// reminderJob — данные задачи JobNoteReminder
+type reminderJob struct {
+	NoteID   int       `json:"note_id"`
+	UserID   int       `json:"user_id"`
+	RemindAt time.Time `json:"remind_at"`
+}
+
+func CreateReminderService(notes *repository.NoteRepository, users *repository.UserRepository, queue *jobs.Queue, publisher ReminderPublisher, cfg ReminderConfig) *reminderService {
+	return &reminderService{
+		notes:     notes,
+		users:     users,
+		queue:     queue,
+		publisher: publisher,
+		client:    &http.Client{Timeout: cfg.WebhookTimeout},
+		cfg:       cfg,
+	}
+}
+
+// RunReminder — обработчик JobNoteReminder. Задачу выполняет одна реплика;
+// если заметку удалили или напоминание перенесли, задача ничего не делает —
+// перенесённое отправит своя задача. Повтор после сбоя отправит событие ещё
+// раз с тем же reminder_id.
+func (s *reminderService) RunReminder(ctx context.Context, job models.Job, _ jobs.Progress) error {
+	var p reminderJob
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+
+	note, err := s.notes.Find(ctx, p.NoteID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if note.RemindAt == nil || !note.RemindAt.Equal(p.RemindAt) {
+		return nil
+	}
+
+	user, err := s.users.Get(ctx, note.UserID)
+	if err != nil {
+		return err
+	}
+	loc := location(user.Timezone)
+	r := models.Reminder{
+		ID:        fmt.Sprintf("%d-%d", note.Id, note.RemindAt.UnixMicro()),
+		NoteID:    note.Id,
+		UserID:    note.UserID,
+		Title:     note.Title,
+		RemindAt:  *note.RemindAt,
+		DueAt:     note.DueAt,
+		Timezone:  loc.String(),
+		LocalTime: note.RemindAt.In(loc).Format(time.RFC3339),
+		Email:     user.Email,
+		Locale:    user.Locale,
+	}
+
+	if err := s.publisher.PublishReminder(ctx, r); err != nil {
+		return fmt.Errorf("publish reminder %s: %w", r.ID, err)
+	}
+	logger.Infof("reminder %s sent note=%d user=%d", r.ID, r.NoteID, r.UserID)
+
+	// вебхук — отдельной задачей: его повторы не дублируют событие в Kafka
+	if s.cfg.WebhookURL != "" {
+		if _, err := s.queue.Enqueue(ctx, 0, JobReminderWebhook, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunWebhook — обработчик JobReminderWebhook. Idempotency-Key — reminder_id.
+// Ответ 4xx (кроме 408 и 429) повтором не исправить.
+func (s *reminderService) RunWebhook(ctx context.Context, job models.Job, _ jobs.Progress) error {
+	var r models.Reminder
+	if err := json.Unmarshal(job.Payload, &r); err != nil {
+		return jobs.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	body := []byte(job.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", r.ID)
+	if len(s.cfg.WebhookSecret) > 0 {
+		mac := hmac.New(sha256.New, s.cfg.WebhookSecret)
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reminder webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return jobs.Permanent(fmt.Errorf("reminder webhook: status %d", resp.StatusCode))
+	}
+	return fmt.Errorf("reminder webhook: status %d", resp.StatusCode)
+}
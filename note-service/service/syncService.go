@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/audit"
+	"myproject/cache"
+	"myproject/dto"
+	"myproject/internal/logger"
+	"myproject/models"
+	"myproject/notify"
+	"myproject/repository"
+	"myproject/validation"
+)
+
+const (
+	SyncPageDefault = 500
+	SyncPageMax     = 1000
+)
+
+var (
+	ErrSyncToken        = errors.New("invalid sync token")
+	ErrSyncTokenExpired = errors.New("sync token expired: full resync required")
+	ErrSyncConflict     = errors.New("note was changed on the server after base_version")
+	ErrBaseVersion      = errors.New("base_version is required for update and delete")
+)
+
+// SyncService — синхронизация офлайн-клиентов. GET /sync отдаёт всё, что
+// изменилось после токена; POST /sync применяет изменения клиента, если
+// заметку с base_version никто не менял, иначе возвращает конфликт.
+type SyncService interface {
+	Changes(ctx context.Context, userID int, since string, limit int) (SyncPage, error)
+	Push(ctx context.Context, userID int, req dto.SyncRequest) ([]SyncResult, error)
+}
+
+// SyncPage — страница изменений; Next — токен для следующего запроса
+type SyncPage struct {
+	Notes   []models.SyncNote
+	Deleted []models.Tombstone
+	Next    string
+	More    bool
+}
+
+// SyncResult — итог одного изменения клиента. При ErrSyncConflict Note —
+// текущая заметка на сервере, Deleted — если на сервере её удалили.
+type SyncResult struct {
+	Op        string
+	ClientID  string
+	Note      *models.SyncNote
+	Deleted   *models.Tombstone
+	Duplicate bool
+	Err       error
+}
+
+type syncService struct {
+	repo   *repository.NoteRepository
+	users  *repository.UserRepository
+	cache  *cache.NotesCache
+	audit  *audit.Recorder
+	events *notify.Broker
+	collab CollabNotifier
+}
+
+func CreateSyncService(repo *repository.NoteRepository, users *repository.UserRepository, c *cache.NotesCache, auditor *audit.Recorder, events *notify.Broker, collab CollabNotifier) *syncService {
+	return &syncService{
+		repo:   repo,
+		users:  users,
+		cache:  c,
+		audit:  auditor,
+		events: events,
+		collab: collab,
+	}
+}
+
+// Изменения после токена since; пустой токен — полная синхронизация.
+// Токен непрозрачен для клиента: позиция в последовательности изменений
+// пользователя.
+func (s *syncService) Changes(ctx context.Context, userID int, since string, limit int) (SyncPage, error) {
+	if userID <= 0 {
+		return SyncPage{}, ErrInvalidUserID
+	}
+	pos := repository.SyncPos{Seq: -1, Full: true}
+	if since != "" {
+		var err error
+		if pos, err = decodeSyncToken(since); err != nil {
+			return SyncPage{}, err
+		}
+	}
+	if limit <= 0 {
+		limit = SyncPageDefault
+	}
+	limit = min(limit, SyncPageMax)
+
+	ch, err := s.repo.Changes(ctx, userID, pos, limit)
+	if err != nil {
+		if errors.Is(err, repository.ErrSyncExpired) {
+			return SyncPage{}, ErrSyncTokenExpired
+		}
+		return SyncPage{}, fmt.Errorf("service: sync-changes: %w", err)
+	}
+	return SyncPage{Notes: ch.Notes, Deleted: ch.Deleted, Next: encodeSyncToken(ch.Next), More: ch.More}, nil
+}
+
+// Применить изменения клиента одной транзакцией. Конфликт или ошибка
+// одного изменения не отменяют остальные. Повтор create с тем же client_id
+// не создаёт вторую заметку, а возвращает уже созданную.
+func (s *syncService) Push(ctx context.Context, userID int, req dto.SyncRequest) ([]SyncResult, error) {
+	if userID <= 0 {
+		return nil, ErrInvalidUserID
+	}
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	dated := false
+	for _, ch := range req.Changes {
+		dated = dated || ch.DueAt.Set || ch.RemindAt.Set
+	}
+	loc, err := batchLocation(ctx, s.users, userID, dated)
+	if err != nil {
+		return nil, fmt.Errorf("service: sync-push: %w", err)
+	}
+
+	results := make([]SyncResult, len(req.Changes))
+	ops := make([]repository.SyncOp, 0, len(req.Changes))
+	index := make([]int, 0, len(req.Changes))
+	for i, ch := range req.Changes {
+		results[i].Op, results[i].ClientID = ch.Op, ch.ClientID
+		bop, err := checkSyncChange(ch, loc)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		op := repository.SyncOp{
+			Kind: ch.Op, ID: ch.ID, ClientID: ch.ClientID,
+			Title: bop.Title, Content: bop.Content, Format: bop.Format, DueAt: bop.DueAt, RemindAt: bop.RemindAt,
+		}
+		if ch.BaseVersion != nil {
+			op.BaseVersion = *ch.BaseVersion
+		}
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+	if len(ops) == 0 {
+		return results, nil
+	}
+
+	applied, version, err := s.repo.ApplySync(ctx, userID, ops)
+	if err != nil {
+		return nil, fmt.Errorf("service: sync-push: %w", err)
+	}
+
+	changed := make([]int, 0, len(ops))
+	published := make([]notify.Event, 0, len(ops))
+	for j, res := range applied {
+		i := index[j]
+		r := &results[i]
+		r.Deleted, r.Duplicate = res.Deleted, res.Duplicate
+		if res.Note.Id != 0 {
+			note := res.Note
+			r.Note = &note
+		}
+		switch {
+		case errors.Is(res.Err, repository.ErrConflict):
+			r.Err = ErrSyncConflict
+			continue
+		case res.Err != nil:
+			r.Err = batchOpError(i, res.Err)
+			continue
+		case res.Duplicate, ops[j].Kind == repository.BatchDelete && res.Before.Id == 0:
+			// уже применено раньше: ни аудита, ни событий
+			continue
+		}
+
+		ev := audit.Event{ActorID: userID, UserID: userID, TargetType: "note"}
+		note := notify.Event{}
+		switch ops[j].Kind {
+		case repository.BatchCreate:
+			ev.Action, ev.After = audit.ActionNoteCreate, res.Note.Note
+			note.Type, note.NoteID, note.Note = notify.NoteCreated, res.Note.Id, &r.Note.Note
+		case repository.BatchUpdate:
+			ev.Action, ev.Before, ev.After = audit.ActionNoteUpdate, res.Before, res.Note.Note
+			note.Type, note.NoteID, note.Note = notify.NoteUpdated, res.Note.Id, &r.Note.Note
+			if ops[j].Content != nil {
+				contentChanged(ctx, s.collab, res.Note.Id)
+			}
+		case repository.BatchDelete:
+			ev.Action, ev.Before = audit.ActionNoteDelete, res.Before
+			note.Type, note.NoteID = notify.NoteDeleted, res.Before.Id
+			contentChanged(ctx, s.collab, res.Before.Id)
+		}
+		ev.TargetID = fmt.Sprint(note.NoteID)
+		s.audit.Record(ctx, ev)
+		changed = append(changed, note.NoteID)
+		published = append(published, note)
+	}
+
+	if len(changed) > 0 {
+		if err := s.cache.InvalidateNotes(ctx, userID, changed, version); err != nil {
+			fmt.Printf("[CACHE INVALIDATE ERROR] user=%d: %v\n", userID, err)
+		}
+	}
+	for _, ev := range published {
+		s.events.Publish(ctx, userID, ev)
+	}
+	return results, nil
+}
+
+// checkSyncChange — проверки операции пакета и base_version
+func checkSyncChange(ch dto.SyncChange, loc *time.Location) (repository.BatchOp, error) {
+	if err := validation.Struct(ch); err != nil {
+		return repository.BatchOp{}, err
+	}
+	op, err := checkBatchOp(dto.BatchOperation{
+		Op: ch.Op, ID: ch.ID, Title: ch.Title, Content: ch.Content, Format: ch.Format, DueAt: ch.DueAt, RemindAt: ch.RemindAt,
+	}, loc)
+	if err != nil {
+		return op, err
+	}
+	if ch.Op != repository.BatchCreate && ch.BaseVersion == nil {
+		return op, ErrBaseVersion
+	}
+	return op, nil
+}
+
+// RunTombstoneRetention раз в сутки удаляет надгробия удалённых заметок
+// старше retentionDays. Клиент, не синхронизировавшийся дольше, получит
+// sync_token_expired и синхронизируется заново.
+func (s *syncService) RunTombstoneRetention(ctx context.Context, retentionDays int) {
+	if retentionDays <= 0 {
+		return
+	}
+
+	purge := func() {
+		n, err := s.repo.PurgeTombstones(ctx, retentionDays)
+		if err != nil {
+			logger.Errorf("sync retention: %v", err)
+			return
+		}
+		if n > 0 {
+			logger.Infof("sync retention: removed %d tombstones older than %d days", n, retentionDays)
+		}
+	}
+
+	purge()
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
+
+// Токен — base64url от "seq.afterID" (полная синхронизация — с префиксом "f")
+func encodeSyncToken(p repository.SyncPos) string {
+	raw := fmt.Sprintf("%d.%d", p.Seq, p.AfterID)
+	if p.Full {
+		raw = "f" + raw
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSyncToken(token string) (repository.SyncPos, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return repository.SyncPos{}, ErrSyncToken
+	}
+	raw, full := strings.CutPrefix(string(b), "f")
+	seqPart, idPart, ok := strings.Cut(raw, ".")
+	seq, err1 := strconv.ParseInt(seqPart, 10, 64)
+	afterID, err2 := strconv.Atoi(idPart)
+	if !ok || err1 != nil || err2 != nil || seq < -1 || afterID < 0 || (seq < 0 && !full) {
+		return repository.SyncPos{}, ErrSyncToken
+	}
+	return repository.SyncPos{Seq: seq, AfterID: afterID, Full: full}, nil
+}
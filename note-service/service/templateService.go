@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"myproject/dto"
+	"myproject/models"
+	"myproject/repository"
+	"myproject/templating"
+	"myproject/validation"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateExists   = errors.New("template with this name and locale already exists")
+	ErrTemplateReadOnly = errors.New("system templates can be changed only by administrators")
+)
+
+type TemplateService interface {
+	ListTemplates(ctx context.Context, userID int, locale string) ([]models.Template, error)
+	GetTemplate(ctx context.Context, userID int, id int64) (models.Template, error)
+	CreateTemplate(ctx context.Context, userID int, system bool, req dto.TemplateRequest) (models.Template, error)
+	UpdateTemplate(ctx context.Context, userID int, admin bool, id int64, req dto.TemplateUpdateRequest) (models.Template, error)
+	DeleteTemplate(ctx context.Context, userID int, admin bool, id int64) error
+	CreateNoteFromTemplate(ctx context.Context, userID int, id int64, req dto.NoteFromTemplateRequest) (int, error)
+	CreateWelcomeNote(ctx context.Context, user models.UserProfile) (int, error)
+}
+
+// TemplateConfig — какой системный шаблон приветственный и на какой локали
+// он берётся, если шаблона на языке пользователя нет
+type TemplateConfig struct {
+	WelcomeName   string
+	DefaultLocale string
+}
+
+type templateService struct {
+	repo  *repository.TemplateRepository
+	users *repository.UserRepository
+	notes NoteService
+	cfg   TemplateConfig
+	now   func() time.Time
+}
+
+func CreateTemplateService(repo *repository.TemplateRepository, users *repository.UserRepository, notes NoteService, cfg TemplateConfig) *templateService {
+	return &templateService{
+		repo:  repo,
+		users: users,
+		notes: notes,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Шаблоны пользователя и системные; locale — только этой локали
+func (s *templateService) ListTemplates(ctx context.Context, userID int, locale string) ([]models.Template, error) {
+	if userID <= 0 {
+		return nil, ErrInvalidUserID
+	}
+	list, err := s.repo.List(ctx, userID, locale)
+	if err != nil {
+		return nil, fmt.Errorf("service: list-templates: %w", err)
+	}
+	return list, nil
+}
+
+func (s *templateService) GetTemplate(ctx context.Context, userID int, id int64) (models.Template, error) {
+	if userID <= 0 {
+		return models.Template{}, ErrInvalidUserID
+	}
+	if id <= 0 {
+		return models.Template{}, ErrInvalidID
+	}
+	t, err := s.repo.Get(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.Template{}, ErrTemplateNotFound
+		}
+		return models.Template{}, fmt.Errorf("service: get-template: %w", err)
+	}
+	return t, nil
+}
+
+// Создать шаблон пользователя; system — системный (право проверяет маршрут)
+func (s *templateService) CreateTemplate(ctx context.Context, userID int, system bool, req dto.TemplateRequest) (models.Template, error) {
+	if userID <= 0 {
+		return models.Template{}, ErrInvalidUserID
+	}
+	if err := validation.Struct(req); err != nil {
+		return models.Template{}, err
+	}
+
+	t := models.Template{
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Locale:  req.Locale,
+		Title:   req.Title,
+		Content: req.Content,
+		Format:  req.Format,
+		Fields:  req.Fields,
+	}
+	if system {
+		t.UserID = 0
+	}
+	if err := checkTemplate(&t); err != nil {
+		return models.Template{}, err
+	}
+
+	created, err := s.repo.Create(ctx, t)
+	if err != nil {
+		if errors.Is(err, repository.ErrTemplateExists) {
+			return models.Template{}, ErrTemplateExists
+		}
+		return models.Template{}, fmt.Errorf("service: create-template: %w", err)
+	}
+	return created, nil
+}
+
+// Изменить шаблон; системные — только admin
+func (s *templateService) UpdateTemplate(ctx context.Context, userID int, admin bool, id int64, req dto.TemplateUpdateRequest) (models.Template, error) {
+	if req.Name == nil && req.Locale == nil && req.Title == nil && req.Content == nil && req.Format == nil && req.Fields == nil {
+		return models.Template{}, ErrNothingToUpdate
+	}
+	if err := validation.Struct(req); err != nil {
+		return models.Template{}, err
+	}
+
+	t, err := s.writable(ctx, userID, admin, id)
+	if err != nil {
+		return models.Template{}, err
+	}
+	if req.Name != nil {
+		t.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Locale != nil {
+		t.Locale = *req.Locale
+	}
+	if req.Title != nil {
+		t.Title = *req.Title
+	}
+	if req.Content != nil {
+		t.Content = *req.Content
+	}
+	if req.Format != nil {
+		t.Format = *req.Format
+	}
+	if req.Fields != nil {
+		t.Fields = req.Fields
+	}
+	if err := checkTemplate(&t); err != nil {
+		return models.Template{}, err
+	}
+
+	updated, err := s.repo.Update(ctx, t)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return models.Template{}, ErrTemplateNotFound
+		case errors.Is(err, repository.ErrTemplateExists):
+			return models.Template{}, ErrTemplateExists
+		}
+		return models.Template{}, fmt.Errorf("service: update-template: %w", err)
+	}
+	return updated, nil
+}
+
+func (s *templateService) DeleteTemplate(ctx context.Context, userID int, admin bool, id int64) error {
+	if _, err := s.writable(ctx, userID, admin, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTemplateNotFound
+		}
+		return fmt.Errorf("service: delete-template: %w", err)
+	}
+	return nil
+}
+
+// writable — шаблон, который пользователь может менять
+func (s *templateService) writable(ctx context.Context, userID int, admin bool, id int64) (models.Template, error) {
+	t, err := s.GetTemplate(ctx, userID, id)
+	if err != nil {
+		return models.Template{}, err
+	}
+	if t.System && !admin {
+		return models.Template{}, ErrTemplateReadOnly
+	}
+	return t, nil
+}
+
+// CreateNoteFromTemplate создаёт заметку из шаблона. Поля, которых нет в
+// запросе, берут значения по умолчанию; поля, которых нет в шаблоне, — ошибка.
+func (s *templateService) CreateNoteFromTemplate(ctx context.Context, userID int, id int64, req dto.NoteFromTemplateRequest) (int, error) {
+	t, err := s.GetTemplate(ctx, userID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := make(map[string]string, len(t.Fields))
+	for name, def := range t.Fields {
+		fields[name] = def
+	}
+	for name, val := range req.Fields {
+		if _, ok := t.Fields[name]; !ok {
+			return 0, invalid("fields", fmt.Errorf("%w: %q", templating.ErrUnknownVariable, name))
+		}
+		fields[name] = val
+	}
+	title := t.Title
+	if req.Title != nil {
+		title = *req.Title
+	}
+
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("service: note-from-template: %w", err)
+	}
+	return s.createNote(ctx, t, title, templating.Vars{
+		Now:    s.now().UTC(),
+		UserID: userID,
+		Email:  user.Email,
+		Fields: fields,
+	})
+}
+
+// CreateWelcomeNote запоминает профиль нового пользователя и создаёт ему
+// заметку из системного шаблона cfg.WelcomeName на его языке: "pt-BR" →
+// "pt-BR", "pt", затем cfg.DefaultLocale.
+func (s *templateService) CreateWelcomeNote(ctx context.Context, user models.UserProfile) (int, error) {
+	if user.UserID <= 0 {
+		return 0, ErrInvalidUserID
+	}
+	if err := s.users.Save(ctx, user); err != nil {
+		return 0, fmt.Errorf("service: welcome-note: %w", err)
+	}
+
+	t, err := s.repo.FindSystem(ctx, s.cfg.WelcomeName, localeChain(user.Locale, s.cfg.DefaultLocale))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, fmt.Errorf("service: welcome-note %q: %w", s.cfg.WelcomeName, ErrTemplateNotFound)
+		}
+		return 0, fmt.Errorf("service: welcome-note: %w", err)
+	}
+	return s.createNote(ctx, t, t.Title, templating.Vars{
+		Now:    s.now().UTC(),
+		UserID: user.UserID,
+		Email:  user.Email,
+		Fields: t.Fields,
+	})
+}
+
+func (s *templateService) createNote(ctx context.Context, t models.Template, title string, vars templating.Vars) (int, error) {
+	title, err := templating.Render(title, vars)
+	if err != nil {
+		return 0, invalid("title", err)
+	}
+	content, err := templating.Render(t.Content, vars)
+	if err != nil {
+		return 0, invalid("content", err)
+	}
+	return s.notes.CreateNote(ctx, vars.UserID, dto.NoteRequest{Title: title, Content: content, Format: t.Format})
+}
+
+// checkTemplate проверяет имена полей и переменные в тексте шаблона
+func checkTemplate(t *models.Template) error {
+	if t.Fields == nil {
+		t.Fields = map[string]string{}
+	}
+	if t.Format == "" {
+		t.Format = models.FormatPlain
+	}
+	if err := templating.CheckFields(t.Fields); err != nil {
+		return invalid("fields", err)
+	}
+	if err := templating.Check(t.Title, t.Fields); err != nil {
+		return invalid("title", err)
+	}
+	if err := templating.Check(t.Content, t.Fields); err != nil {
+		return invalid("content", err)
+	}
+	return nil
+}
+
+// invalid — ошибка шаблона как нарушение проверки поля field
+func invalid(field string, err error) error {
+	return &validation.Error{Violations: []validation.Violation{
+		{Field: field, Code: "invalid", Message: err.Error()},
+	}}
+}
+
+// localeChain — локали для поиска шаблона, от точной к запасной
+func localeChain(locale, def string) []string {
+	var chain []string
+	add := func(l string) {
+		for _, c := range chain {
+			if c == l {
+				return
+			}
+		}
+		if l != "" {
+			chain = append(chain, l)
+		}
+	}
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	add(locale)
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		add(lang)
+	}
+	add(def)
+	return chain
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"myproject/repository"
+)
+
+var (
+	ErrBadTime     = errors.New("time must be RFC 3339 or local time like 2026-03-01T09:00")
+	ErrBadTimezone = errors.New("unknown time zone")
+)
+
+// Местное время без смещения — в часовом поясе пользователя
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseTime разбирает время из запроса: RFC 3339 либо местное время в поясе
+// loc (2006-01-02T15:04:05, 2006-01-02T15:04 или дата — начало дня)
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, ErrBadTime
+}
+
+// location — часовой пояс из профиля; пустой или неизвестный — UTC
+func location(tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func userLocation(ctx context.Context, users *repository.UserRepository, userID int) (*time.Location, error) {
+	p, err := users.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user timezone: %w", err)
+	}
+	return location(p.Timezone), nil
+}
+
+// batchLocation — пояс пользователя для пакета операций; если ни одна не
+// задаёт срок (dated=false), профиль не читается
+func batchLocation(ctx context.Context, users *repository.UserRepository, userID int, dated bool) (*time.Location, error) {
+	if !dated {
+		return time.UTC, nil
+	}
+	return userLocation(ctx, users, userID)
+}
+
+// parseTimeField — необязательное время из поля field запроса
+func parseTimeField(field string, s *string, loc *time.Location) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := ParseTime(*s, loc)
+	if err != nil {
+		return nil, invalid(field, err)
+	}
+	return &t, nil
+}
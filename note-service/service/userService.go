@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"myproject/dto"
+	"myproject/models"
+	"myproject/repository"
+	"myproject/validation"
+)
+
+type UserService interface {
+	GetSettings(ctx context.Context, userID int) (dto.UserSettings, error)
+	UpdateSettings(ctx context.Context, userID int, req dto.UserSettings) (dto.UserSettings, error)
+}
+
+type userService struct {
+	users *repository.UserRepository
+}
+
+func CreateUserService(users *repository.UserRepository) *userService {
+	return &userService{users: users}
+}
+
+func (s *userService) GetSettings(ctx context.Context, userID int) (dto.UserSettings, error) {
+	if userID <= 0 {
+		return dto.UserSettings{}, ErrInvalidUserID
+	}
+	p, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return dto.UserSettings{}, fmt.Errorf("service: get-settings: %w", err)
+	}
+	return dto.UserSettings{Timezone: p.Timezone, Locale: p.Locale}, nil
+}
+
+// UpdateSettings меняет переданные поля. Новый пояс действует на время,
+// которое придёт потом: уже заданные сроки и напоминания не сдвигаются.
+func (s *userService) UpdateSettings(ctx context.Context, userID int, req dto.UserSettings) (dto.UserSettings, error) {
+	if userID <= 0 {
+		return dto.UserSettings{}, ErrInvalidUserID
+	}
+	if err := validation.Struct(req); err != nil {
+		return dto.UserSettings{}, err
+	}
+	req.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Timezone == "" && req.Locale == "" {
+		return dto.UserSettings{}, ErrNothingToUpdate
+	}
+	if req.Timezone != "" {
+		// "Local" — пояс сервера, а не пользователя
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			return dto.UserSettings{}, invalid("timezone", fmt.Errorf("%w: %q", ErrBadTimezone, req.Timezone))
+		}
+	}
+
+	err := s.users.Save(ctx, models.UserProfile{UserID: userID, Locale: req.Locale, Timezone: req.Timezone})
+	if err != nil {
+		return dto.UserSettings{}, fmt.Errorf("service: update-settings: %w", err)
+	}
+	return s.GetSettings(ctx, userID)
+}
@@ -0,0 +1,117 @@
+// Package templating подставляет переменные в шаблоны заметок:
+//
+//	{{date}}, {{time}}, {{datetime}} — текущие дата и время
+//	{{user.id}}, {{user.email}}      — владелец создаваемой заметки
+//	{{имя}}                          — поле шаблона (fields)
+//
+// Пробелы внутри скобок допустимы: {{ date }}. Незакрытые «{{» остаются
+// как есть.
+package templating
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownVariable = errors.New("unknown template variable")
+	ErrBadFieldName    = errors.New("field names must match [a-z_][a-z0-9_]* and not shadow built-in variables")
+)
+
+// Встроенные переменные
+const (
+	VarDate      = "date"
+	VarTime      = "time"
+	VarDateTime  = "datetime"
+	VarUserID    = "user.id"
+	VarUserEmail = "user.email"
+)
+
+var fieldName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func builtin(name string) bool {
+	switch name {
+	case VarDate, VarTime, VarDateTime, VarUserID, VarUserEmail:
+		return true
+	}
+	return false
+}
+
+// Vars — значения для подстановки. Fields — поля шаблона с уже
+// подставленными значениями по умолчанию.
+type Vars struct {
+	Now    time.Time
+	UserID int
+	Email  string
+	Fields map[string]string
+}
+
+// CheckFields проверяет имена полей шаблона
+func CheckFields(fields map[string]string) error {
+	for name := range fields {
+		if !fieldName.MatchString(name) || builtin(name) {
+			return fmt.Errorf("%w: %q", ErrBadFieldName, name)
+		}
+	}
+	return nil
+}
+
+// Check проверяет, что в тексте только встроенные переменные и поля шаблона
+func Check(text string, fields map[string]string) error {
+	_, err := expand(text, func(name string) (string, bool) {
+		if builtin(name) {
+			return "", true
+		}
+		_, ok := fields[name]
+		return "", ok
+	})
+	return err
+}
+
+// Render подставляет переменные в text
+func Render(text string, v Vars) (string, error) {
+	return expand(text, func(name string) (string, bool) {
+		switch name {
+		case VarDate:
+			return v.Now.Format("2006-01-02"), true
+		case VarTime:
+			return v.Now.Format("15:04"), true
+		case VarDateTime:
+			return v.Now.Format("2006-01-02 15:04"), true
+		case VarUserID:
+			return strconv.Itoa(v.UserID), true
+		case VarUserEmail:
+			return v.Email, true
+		}
+		val, ok := v.Fields[name]
+		return val, ok
+	})
+}
+
+func expand(text string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+2:], "}}")
+		if end < 0 {
+			break
+		}
+		name := strings.TrimSpace(text[start+2 : start+2+end])
+		val, ok := lookup(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrUnknownVariable, name)
+		}
+		b.WriteString(text[:start])
+		b.WriteString(val)
+		text = text[start+2+end+2:]
+	}
+	b.WriteString(text)
+	return b.String(), nil
+}
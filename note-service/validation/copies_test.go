@@ -0,0 +1,30 @@
+package validation
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Копия пакета в user-service должна совпадать с этой (кроме limits.go).
+// Вне репозитория (например, в образе Docker) проверка пропускается.
+func TestSameAsUserService(t *testing.T) {
+	other := filepath.Join("..", "..", "user-service", "validation")
+	if _, err := os.Stat(other); err != nil {
+		t.Skip("user-service not found next to note-service")
+	}
+	for _, name := range []string{"validation.go", "validation_test.go"} {
+		mine, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := os.ReadFile(filepath.Join(other, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(mine, theirs) {
+			t.Errorf("%s differs from user-service/validation/%s", name, name)
+		}
+	}
+}
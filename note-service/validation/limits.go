@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+type limit struct {
+	env string
+	def int
+}
+
+// Лимиты длины в символах и размера пакетов; переопределяются переменными окружения
+var limits = map[string]limit{
+	"note.title":   {env: "NOTE_TITLE_MAX_CHARS", def: 255},
+	"note.content": {env: "NOTE_CONTENT_MAX_CHARS", def: 5000},
+	"note.batch":   {env: "NOTE_BATCH_MAX_OPS", def: 500},
+}
+
+var (
+	limitsOnce sync.Once
+	resolved   map[string]int
+)
+
+// Limit возвращает значение лимита по имени из тега. Неизвестное имя —
+// ошибка в теге, поэтому паника.
+func Limit(name string) int {
+	limitsOnce.Do(func() {
+		resolved = make(map[string]int, len(limits))
+		for k, l := range limits {
+			resolved[k] = l.def
+			if v := os.Getenv(l.env); v != "" {
+				if n, err := strconv.Atoi(v); err == nil && n > 0 {
+					resolved[k] = n
+				}
+			}
+		}
+	})
+	n, ok := resolved[name]
+	if !ok {
+		panic(fmt.Sprintf("validation: unknown limit %q", name))
+	}
+	return n
+}
@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNoteLimitsCountRunes(t *testing.T) {
+	type note struct {
+		Title   string `json:"title" validate:"notblank,maxrunes=note.title"`
+		Content string `json:"content" validate:"maxrunes=note.content"`
+	}
+	// кириллица — два байта на символ: лимит в байтах отрезал бы вдвое раньше
+	title := strings.Repeat("я", Limit("note.title"))
+	content := strings.Repeat("ж", Limit("note.content"))
+
+	if err := Struct(note{Title: title, Content: content}); err != nil {
+		t.Fatalf("at the limit: %v", err)
+	}
+
+	err := Struct(note{Title: title + "я", Content: content + "ж"})
+	var verr *Error
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("over the limit: %v", err)
+	}
+	for _, v := range verr.Violations {
+		if v.Code != "too_long" {
+			t.Errorf("%s: code %s, want too_long", v.Field, v.Code)
+		}
+	}
+	if want := "title must be at most 255 characters"; verr.Violations[0].Message != want {
+		t.Errorf("message %q, want %q", verr.Violations[0].Message, want)
+	}
+}
@@ -0,0 +1,162 @@
+// Package validation — декларативная проверка DTO по тегам validate.
+//
+// Кроме стандартных правил go-playground/validator доступны:
+//
+//	notblank        — строка не пустая после TrimSpace
+//	maxrunes=<имя>  — не длиннее лимита <имя> в символах (рунах), а не байтах
+//	minrunes=<имя>  — не короче лимита <имя>
+//	maxbytes=<N>    — не длиннее N байт (для bcrypt и т.п.)
+//	maxitems=<имя>  — в срезе не больше элементов, чем лимит <имя>
+//	email           — адрес разбирается net/mail и не содержит имени
+//
+// Лимиты берутся из конфигурации (см. limits.go), поэтому в тегах только имена.
+// Проверяются все поля сразу: Error содержит все нарушения.
+//
+// Пакет есть в note-service и user-service: сервисы — отдельные модули и
+// собираются каждый из своего каталога, общего модуля у них нет. validation.go
+// и validation_test.go в обоих одинаковы (это проверяет copies_test.go в
+// note-service), свои у сервиса только лимиты в limits.go.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Violation — нарушение правила в одном поле; Field — имя из json-тега
+type Violation struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Error — все нарушения, найденные в одном DTO
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Message)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+var (
+	once     sync.Once
+	validate *validator.Validate
+)
+
+func instance() *validator.Validate {
+	once.Do(func() {
+		v := validator.New(validator.WithRequiredStructEnabled())
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+		mustRegister(v, "notblank", func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		})
+		mustRegister(v, "maxrunes", func(fl validator.FieldLevel) bool {
+			return utf8.RuneCountInString(fl.Field().String()) <= Limit(fl.Param())
+		})
+		mustRegister(v, "minrunes", func(fl validator.FieldLevel) bool {
+			return utf8.RuneCountInString(fl.Field().String()) >= Limit(fl.Param())
+		})
+		mustRegister(v, "maxbytes", func(fl validator.FieldLevel) bool {
+			n, err := strconv.Atoi(fl.Param())
+			return err == nil && len(fl.Field().String()) <= n
+		})
+		mustRegister(v, "maxitems", func(fl validator.FieldLevel) bool {
+			return fl.Field().Len() <= Limit(fl.Param())
+		})
+		mustRegister(v, "email", func(fl validator.FieldLevel) bool {
+			return IsEmail(fl.Field().String())
+		})
+		validate = v
+	})
+	return validate
+}
+
+func mustRegister(v *validator.Validate, tag string, fn validator.Func) {
+	if err := v.RegisterValidation(tag, fn); err != nil {
+		panic(fmt.Sprintf("validation: register %s: %v", tag, err))
+	}
+}
+
+// IsEmail — адрес вида local@domain без отображаемого имени и угловых скобок
+func IsEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return false
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	return domain != "" && !strings.HasPrefix(domain, "[")
+}
+
+// Struct проверяет DTO (или указатель на него). Возвращает *Error со всеми
+// нарушениями либо nil.
+func Struct(dto any) error {
+	err := instance().Struct(dto)
+	if err == nil {
+		return nil
+	}
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		// неверный тег или не структура — ошибка программиста
+		panic(fmt.Sprintf("validation: %v", err))
+	}
+
+	out := &Error{Violations: make([]Violation, 0, len(fieldErrs))}
+	for _, fe := range fieldErrs {
+		out.Violations = append(out.Violations, violation(fe))
+	}
+	return out
+}
+
+func violation(fe validator.FieldError) Violation {
+	field := fe.Field()
+	switch fe.Tag() {
+	case "required", "notblank":
+		return Violation{Field: field, Code: "required", Message: field + " is required"}
+	case "maxrunes":
+		return Violation{Field: field, Code: "too_long",
+			Message: fmt.Sprintf("%s must be at most %d characters", field, Limit(fe.Param()))}
+	case "minrunes":
+		return Violation{Field: field, Code: "too_short",
+			Message: fmt.Sprintf("%s must be at least %d characters", field, Limit(fe.Param()))}
+	case "maxbytes":
+		return Violation{Field: field, Code: "too_long",
+			Message: fmt.Sprintf("%s must be at most %s bytes", field, fe.Param())}
+	case "maxitems":
+		return Violation{Field: field, Code: "too_many",
+			Message: fmt.Sprintf("%s must contain at most %d items", field, Limit(fe.Param()))}
+	case "oneof":
+		return Violation{Field: field, Code: "invalid",
+			Message: fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))}
+	case "min", "gte":
+		return Violation{Field: field, Code: "out_of_range",
+			Message: fmt.Sprintf("%s must be at least %s", field, fe.Param())}
+	case "max", "lte":
+		return Violation{Field: field, Code: "out_of_range",
+			Message: fmt.Sprintf("%s must be at most %s", field, fe.Param())}
+	case "email":
+		return Violation{Field: field, Code: "invalid", Message: field + " is not a valid email address"}
+	}
+	return Violation{Field: field, Code: "invalid", Message: field + " is invalid"}
+}
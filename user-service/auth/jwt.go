@@ -6,12 +6,16 @@ import (
     "time"
 
     "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
 )
 
 var ErrInvalidToken = errors.New("invalid token")
 
 type Claims struct {
     UserID int `json:"user_id"`
+    // роль и версия сессии; tv сверяется с users.token_version при проверке
+    Role         string `json:"role,omitempty"`
+    TokenVersion int    `json:"tv,omitempty"`
     jwt.RegisteredClaims
 }
 
@@ -24,9 +28,11 @@ func secret() []byte {
     return []byte(s)
 }
 
-func GenerateToken(userID int) (string, error) {
+func GenerateToken(userID int, role string, tokenVersion int) (string, error) {
     claims := &Claims{
-        UserID: userID,
+        UserID:       userID,
+        Role:         role,
+        TokenVersion: tokenVersion,
         RegisteredClaims: jwt.RegisteredClaims{
             ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
             IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -38,6 +44,14 @@ func GenerateToken(userID int) (string, error) {
 }
 
 func ParseToken(tokenStr string) (int, error) {
+    claims, err := ParseClaims(tokenStr)
+    if err != nil {
+        return 0, err
+    }
+    return claims.UserID, nil
+}
+
+func ParseClaims(tokenStr string) (*Claims, error) {
     token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
         if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
             return nil, ErrInvalidToken
@@ -45,13 +59,69 @@ func ParseToken(tokenStr string) (int, error) {
         return secret(), nil
     })
     if err != nil {
-        return 0, ErrInvalidToken
+        return nil, ErrInvalidToken
     }
 
     claims, ok := token.Claims.(*Claims)
     if !ok || !token.Valid {
-        return 0, ErrInvalidToken
+        return nil, ErrInvalidToken
     }
 
-    return claims.UserID, nil
+    return claims, nil
+}
+
+// MFA-токен подтверждает только первый шаг входа (пароль).
+// Подписывается отдельным ключом, чтобы его нельзя было предъявить как access-токен.
+const mfaTokenTTL = 5 * time.Minute
+
+func mfaSecret() []byte {
+    return DerivedKey("mfa")
+}
+
+// DerivedKey — отдельный ключ подписи для служебных токенов (mfa, oidc-state и т.п.),
+// чтобы их нельзя было подменить друг другом или access-токеном
+func DerivedKey(purpose string) []byte {
+    return append(secret(), []byte(":"+purpose)...)
+}
+
+// MFAChallenge — первый шаг входа, подтверждённый mfa_token. ID (jti)
+// отличает токены одного пользователя: по нему считаются попытки второго
+// шага, и после успеха или лимита ошибок токен гасится.
+type MFAChallenge struct {
+    UserID    int
+    ID        string
+    ExpiresAt time.Time
+}
+
+func GenerateMFAToken(userID int) (string, error) {
+    claims := &Claims{
+        UserID: userID,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ID:        uuid.NewString(),
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaTokenTTL)),
+            IssuedAt:  jwt.NewNumericDate(time.Now()),
+        },
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+    return token.SignedString(mfaSecret())
+}
+
+func ParseMFAToken(tokenStr string) (MFAChallenge, error) {
+    token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
+        if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, ErrInvalidToken
+        }
+        return mfaSecret(), nil
+    })
+    if err != nil {
+        return MFAChallenge{}, ErrInvalidToken
+    }
+
+    claims, ok := token.Claims.(*Claims)
+    if !ok || !token.Valid || claims.ID == "" || claims.ExpiresAt == nil {
+        return MFAChallenge{}, ErrInvalidToken
+    }
+
+    return MFAChallenge{UserID: claims.UserID, ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, nil
 }
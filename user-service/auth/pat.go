@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Префикс позволяет note-service отличить PAT от JWT без разбора токена
+const PATPrefix = "pat_"
+
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+)
+
+var knownScopes = map[string]bool{
+	ScopeNotesRead:  true,
+	ScopeNotesWrite: true,
+}
+
+func IsKnownScope(scope string) bool {
+	return knownScopes[scope]
+}
+
+// GeneratePAT возвращает токен для пользователя и хэш для хранения в БД
+func GeneratePAT() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("pat: generate: %w", err)
+	}
+	token := PATPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashPAT(token), nil
+}
+
+func HashPAT(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("%d codes, want 10", len(codes))
+	}
+	format := regexp.MustCompile(`^[` + recoveryCodeAlphabet + `]{5}-[` + recoveryCodeAlphabet + `]{5}$`)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !format.MatchString(c) {
+			t.Errorf("code %q does not match xxxxx-xxxxx", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	const code = "abcde-fghjk"
+	want := HashRecoveryCode(code)
+
+	if len(want) != 64 {
+		t.Fatalf("hash %q is not hex sha256", want)
+	}
+	// при вводе вручную регистр, дефис и пробелы не важны
+	for _, typed := range []string{"ABCDE-FGHJK", "abcdefghjk", "abcde fghjk", " abcde-fghjk "} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from %q", typed, code)
+		}
+	}
+	if HashRecoveryCode("abcde-fghjm") == want {
+		t.Fatal("different codes share a hash")
+	}
+}
@@ -0,0 +1,15 @@
+package auth
+
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+func IsKnownRole(role string) bool {
+	switch role {
+	case RoleUser, RoleAdmin, RoleSupport:
+		return true
+	}
+	return false
+}
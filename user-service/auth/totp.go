@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// допускаем расхождение часов клиента на один шаг в каждую сторону
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpIssuer() string {
+	if s := os.Getenv("TOTP_ISSUER"); s != "" {
+		return s
+	}
+	return "go-notes"
+}
+
+// GenerateTOTPSecret возвращает случайный секрет (160 бит) в base32
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("totp: generate secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// Секрет TOTP хранится в БД зашифрованным (AES-256-GCM) ключом из
+// TOTP_ENCRYPTION_KEY. id пользователя входит в аутентифицируемые данные,
+// поэтому секрет, переставленный в чужую строку, не расшифруется.
+const sealedTOTPPrefix = "v1:"
+
+var ErrTOTPSecretCorrupt = errors.New("totp: cannot decrypt secret")
+
+func totpCipher() (cipher.AEAD, error) {
+	k := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if k == "" {
+		// только для локальной разработки
+		k = string(secret()) + ":totp"
+	}
+	key := sha256.Sum256([]byte(k))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealTOTPSecret шифрует секрет пользователя для записи в БД
+func SealTOTPSecret(secret string, userID int) (string, error) {
+	aead, err := totpCipher()
+	if err != nil {
+		return "", fmt.Errorf("totp: seal secret: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("totp: seal secret: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(fmt.Sprint(userID)))
+	return sealedTOTPPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenTOTPSecret расшифровывает секрет, записанный SealTOTPSecret
+func OpenTOTPSecret(stored string, userID int) (string, error) {
+	raw, ok := strings.CutPrefix(stored, sealedTOTPPrefix)
+	if !ok {
+		return "", ErrTOTPSecretCorrupt
+	}
+	data, err := base64.RawStdEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrTOTPSecretCorrupt
+	}
+	aead, err := totpCipher()
+	if err != nil {
+		return "", fmt.Errorf("totp: open secret: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return "", ErrTOTPSecretCorrupt
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(fmt.Sprint(userID)))
+	if err != nil {
+		return "", ErrTOTPSecretCorrupt
+	}
+	return string(plain), nil
+}
+
+// TOTPURI собирает otpauth:// ссылку для приложений-аутентификаторов
+func TOTPURI(secret, account string) string {
+	issuer := totpIssuer()
+	label := url.PathEscape(issuer + ":" + account)
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ValidateTOTP проверяет код и возвращает номер шага, на котором он совпал.
+// Номер шага нужен вызывающему, чтобы не принять один и тот же код дважды.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	step := now.Unix() / int64(totpPeriod.Seconds())
+	for i := -totpSkew; i <= totpSkew; i++ {
+		candidate := step + int64(i)
+		if hmac.Equal([]byte(hotp(key, candidate)), []byte(code)) {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// hotp реализует RFC 4226 с динамическим усечением
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	return truncate(mac.Sum(nil))
+}
+
+// truncate — динамическое усечение HMAC до totpDigits цифр (RFC 4226, 5.3)
+func truncate(sum []byte) string {
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
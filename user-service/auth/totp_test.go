@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// секрет из приложений D RFC 4226 и B RFC 6238
+const (
+	rfcKey    = "12345678901234567890"
+	rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+)
+
+func TestHOTPRFC4226(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := hotp([]byte(rfcKey), int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	// пример из RFC 4226, 5.4: offset 0xa, 0x50ef7f19 = 1357872921
+	sum, _ := hex.DecodeString("1f8698690e02ca16618550ef7f19da8e945b555a")
+	if got := truncate(sum); got != "872921" {
+		t.Fatalf("truncate = %s, want 872921", got)
+	}
+
+	// старший бит отбрасывается, ведущие нули сохраняются
+	sum = make([]byte, 20)
+	copy(sum, []byte{0x80, 0x00, 0x00, 0x01})
+	if got := truncate(sum); got != "000001" {
+		t.Fatalf("truncate = %s, want 000001", got)
+	}
+}
+
+func TestHOTPCounterEncoding(t *testing.T) {
+	// счётчик — 8 байт big-endian, старшие 32 бита не теряются
+	counter := int64(1)<<32 | 7
+	mac := hmac.New(sha1.New, []byte(rfcKey))
+	mac.Write([]byte{0, 0, 0, 1, 0, 0, 0, 7})
+	want := truncate(mac.Sum(nil))
+
+	if got := hotp([]byte(rfcKey), counter); got != want {
+		t.Fatalf("hotp(2^32+7) = %s, want %s", got, want)
+	}
+	if hotp([]byte(rfcKey), counter) == hotp([]byte(rfcKey), 7) {
+		t.Fatal("high counter bits ignored")
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	// RFC 6238, приложение B, SHA1; у 8-значных кодов берём младшие 6 цифр —
+	// усечение то же, меняется только модуль
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		step, ok := ValidateTOTP(rfcSecret, c.code, time.Unix(c.unix, 0))
+		if !ok || step != c.unix/30 {
+			t.Errorf("T=%d: ValidateTOTP(%s) = %d, %v; want step %d", c.unix, c.code, step, ok, c.unix/30)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	const step = 1000
+	code := hotp([]byte(rfcKey), step)
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+
+	cases := []struct {
+		name string
+		now  time.Time
+		ok   bool
+	}{
+		{"two steps early", at((step-1)*30 - 1), false},
+		{"one step early, first second", at((step - 1) * 30), true},
+		{"same step", at(step*30 + 15), true},
+		{"one step late, last second", at((step+2)*30 - 1), true},
+		{"two steps late", at((step + 2) * 30), false},
+	}
+	for _, c := range cases {
+		got, ok := ValidateTOTP(rfcSecret, code, c.now)
+		if ok != c.ok || (ok && got != step) {
+			t.Errorf("%s: ValidateTOTP = %d, %v; want ok=%v", c.name, got, ok, c.ok)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	cases := []struct {
+		name, secret, code string
+		ok                 bool
+	}{
+		{"spaces around", rfcSecret, " 287082 ", true},
+		{"lower-case secret", strings.ToLower(rfcSecret), "287082", true},
+		{"eight digits", rfcSecret, "94287082", false},
+		{"five digits", rfcSecret, "28708", false},
+		{"bad secret", "not base32!", "287082", false},
+		{"wrong code", rfcSecret, "287083", false},
+	}
+	for _, c := range cases {
+		if _, ok := ValidateTOTP(c.secret, c.code, now); ok != c.ok {
+			t.Errorf("%s: ok = %v, want %v", c.name, ok, c.ok)
+		}
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	t.Setenv("TOTP_ENCRYPTION_KEY", "test-key")
+
+	sealed, err := SealTOTPSecret(rfcSecret, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, rfcSecret) {
+		t.Fatalf("sealed secret contains plaintext: %s", sealed)
+	}
+	again, _ := SealTOTPSecret(rfcSecret, 7)
+	if again == sealed {
+		t.Fatal("same ciphertext twice: nonce is not random")
+	}
+
+	if got, err := OpenTOTPSecret(sealed, 7); err != nil || got != rfcSecret {
+		t.Fatalf("OpenTOTPSecret = %q, %v", got, err)
+	}
+	if _, err := OpenTOTPSecret(sealed, 8); err != ErrTOTPSecretCorrupt {
+		t.Fatalf("another user's row: %v, want ErrTOTPSecretCorrupt", err)
+	}
+	if _, err := OpenTOTPSecret(rfcSecret, 7); err != ErrTOTPSecretCorrupt {
+		t.Fatalf("plaintext row: %v, want ErrTOTPSecretCorrupt", err)
+	}
+
+	t.Setenv("TOTP_ENCRYPTION_KEY", "other-key")
+	if _, err := OpenTOTPSecret(sealed, 7); err != ErrTOTPSecretCorrupt {
+		t.Fatalf("wrong key: %v, want ErrTOTPSecretCorrupt", err)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/midleware"
+	"user-service/models"
+	"user-service/problem"
+	"user-service/service"
+)
+
+func pathUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		problem.Write(c, problem.Invalid("id", "invalid", "invalid id in path"))
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /admin/users?q=&limit=&offset=
+func SearchUsers(s service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+		if err != nil {
+			problem.Write(c, problem.Invalid("limit", "invalid", "invalid limit"))
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil {
+			problem.Write(c, problem.Invalid("offset", "invalid", "invalid offset"))
+			return
+		}
+
+		users, total, err := s.SearchUsers(c.Request.Context(), c.Query("q"), limit, offset)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		if users == nil {
+			users = []models.User{}
+		}
+		if limit == 0 {
+			limit = len(users)
+		}
+
+		c.JSON(http.StatusOK, UsersPage{Items: users, Total: total, Limit: limit, Offset: offset})
+	}
+}
+
+func GetUser(s service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathUserID(c)
+		if !ok {
+			return
+		}
+
+		u, err := s.GetUser(c.Request.Context(), id)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+func SetUserDisabled(s service.AdminService, disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathUserID(c)
+		if !ok {
+			return
+		}
+		actorID, _ := midleware.GetUserID(c)
+
+		if err := s.SetUserDisabled(c.Request.Context(), actorID, id, disabled); err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func ForceLogout(s service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathUserID(c)
+		if !ok {
+			return
+		}
+
+		actorID, _ := midleware.GetUserID(c)
+
+		if err := s.ForceLogout(c.Request.Context(), actorID, id); err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func SetUserRole(s service.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := pathUserID(c)
+		if !ok {
+			return
+		}
+		actorID, _ := midleware.GetUserID(c)
+
+		var req SetRoleRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		if err := s.SetUserRole(c.Request.Context(), actorID, id, req.Role); err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/audit"
+	"user-service/midleware"
+	"user-service/models"
+	"user-service/problem"
+	"user-service/repository"
+)
+
+const maxAuditPageSize = 200
+
+// limit/offset из query; по умолчанию 50 записей
+func auditPage(c *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		problem.Write(c, problem.Invalid("limit", "out_of_range", "limit must be between 1 and 200"))
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		problem.Write(c, problem.Invalid("offset", "invalid", "invalid offset"))
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+func respondAudit(c *gin.Context, r *audit.Recorder, f repository.AuditFilter) {
+	entries, err := r.List(c.Request.Context(), f)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// GET /users/me/audit — события по своему аккаунту
+func GetMyAudit(r *audit.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+		limit, offset, ok := auditPage(c)
+		if !ok {
+			return
+		}
+
+		respondAudit(c, r, repository.AuditFilter{
+			UserID: userID,
+			Action: c.Query("action"),
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+}
+
+// GET /admin/audit?user_id=&action= — весь журнал для администраторов
+func GetAudit(r *audit.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, offset, ok := auditPage(c)
+		if !ok {
+			return
+		}
+
+		userID := 0
+		if v := c.Query("user_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				problem.Write(c, problem.Invalid("user_id", "invalid", "invalid user_id"))
+				return
+			}
+			userID = id
+		}
+
+		respondAudit(c, r, repository.AuditFilter{
+			UserID: userID,
+			Action: c.Query("action"),
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+}
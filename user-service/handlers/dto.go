@@ -1,8 +1,17 @@
 package handlers
 
+import (
+    "strings"
+    "time"
+
+    "user-service/models"
+)
+
+// Правила проверки — в тегах validate (см. пакет validation). Пароль
+// ограничен 72 байтами: дальше bcrypt его не учитывает.
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,maxrunes=email,email"`
+	Password string `json:"password" validate:"required,minrunes=password.min,maxbytes=72"`
 }
 
 type RegisterResponse struct {
@@ -10,12 +19,87 @@ type RegisterResponse struct {
 	Email string `json:"email"`
 }
 
+func (r *RegisterRequest) normalize() {
+	r.Email = strings.TrimSpace(r.Email)
+}
+
 type LoginRequest struct {
     Email    string `json:"email"`
     Password string `json:"password"`
 }
 
+// При включённой 2FA вместо token возвращается mfa_token для /auth/login/2fa
 type LoginResponse struct {
+    Token       string `json:"token,omitempty"`
+    MFARequired bool   `json:"mfa_required,omitempty"`
+    MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+type TwoFactorLoginRequest struct {
+    MFAToken     string `json:"mfa_token" validate:"required"`
+    Code         string `json:"code"`
+    RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorSetupResponse struct {
+    Secret     string `json:"secret"`
+    OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmRequest struct {
+    Code string `json:"code" validate:"notblank"`
+}
+
+type TwoFactorConfirmResponse struct {
+    RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorDisableRequest struct {
+    Password string `json:"password" validate:"required"`
+}
+
+
+type CreateTokenRequest struct {
+    Name          string   `json:"name" validate:"notblank,maxrunes=token.name"`
+    Scopes        []string `json:"scopes"`
+    ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func (r *CreateTokenRequest) normalize() {
+    r.Name = strings.TrimSpace(r.Name)
+}
+
+type CreateTokenResponse struct {
+    models.AccessToken
     Token string `json:"token"`
 }
 
+type IntrospectRequest struct {
+    Token string `json:"token" validate:"required"`
+}
+
+// Формат по мотивам RFC 7662: для неактивного токена только active=false
+type IntrospectResponse struct {
+    Active    bool       `json:"active"`
+    TokenType string     `json:"token_type,omitempty"` // "pat" или "jwt"
+    UserID    int        `json:"user_id,omitempty"`
+    Role      string     `json:"role,omitempty"`
+    Scopes    []string   `json:"scopes,omitempty"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type UsersPage struct {
+    Items  []models.User `json:"items"`
+    Total  int           `json:"total"`
+    Limit  int           `json:"limit"`
+    Offset int           `json:"offset"`
+}
+
+type SetRoleRequest struct {
+    Role string `json:"role" validate:"notblank"`
+}
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password" validate:"required"`
+    NewPassword     string `json:"new_password" validate:"required,minrunes=password.min,maxbytes=72"`
+}
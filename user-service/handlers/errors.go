@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/midleware"
+	"user-service/oidc"
+	"user-service/problem"
+	"user-service/service"
+	"user-service/validation"
+)
+
+// errorTable — соответствие доменных ошибок ответам API. Коды стабильны:
+// клиенты опираются на них, а не на текст detail.
+var errorTable = problem.Table{
+	// регистрация и вход
+	{Err: service.ErrEmailAlreadyTaken, Status: http.StatusConflict, Code: "email_taken"},
+	{Err: service.ErrInvalidCredentials, Status: http.StatusUnauthorized, Code: "invalid_credentials"},
+	{Err: service.ErrInvalidPassword, Status: http.StatusUnauthorized, Code: "invalid_password"},
+	{Err: service.ErrAccountDisabled, Status: http.StatusForbidden, Code: "account_disabled"},
+	{Err: service.ErrSessionRevoked, Status: http.StatusUnauthorized, Code: "session_revoked"},
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: "user_not_found"},
+
+	// 2FA
+	{Err: service.ErrTOTPAlreadyEnabled, Status: http.StatusConflict, Code: "totp_already_enabled"},
+	{Err: service.ErrTOTPNotEnabled, Status: http.StatusConflict, Code: "totp_not_enabled"},
+	{Err: service.ErrTOTPSetupRequired, Status: http.StatusConflict, Code: "totp_setup_required"},
+	{Err: service.ErrTOTPCodeRequired, Status: http.StatusBadRequest, Code: "required", Field: "code"},
+	{Err: service.ErrInvalidTOTPCode, Status: http.StatusUnauthorized, Code: "invalid_totp_code"},
+	{Err: service.ErrMFATokenInvalid, Status: http.StatusUnauthorized, Code: "invalid_mfa_token"},
+	{Err: service.ErrMFALocked, Status: http.StatusTooManyRequests, Code: "mfa_locked"},
+
+	// SSO
+	{Err: service.ErrExternalEmailUnverified, Status: http.StatusForbidden, Code: "email_unverified"},
+	{Err: oidc.ErrUnknownProvider, Status: http.StatusNotFound, Code: "unknown_provider"},
+	{Err: oidc.ErrInvalidFlow, Status: http.StatusBadRequest, Code: "invalid_login_flow"},
+	{Err: oidc.ErrInvalidIDToken, Status: http.StatusUnauthorized, Code: "invalid_id_token"},
+
+	// персональные токены
+	{Err: service.ErrTokenScopes, Status: http.StatusBadRequest, Code: "invalid", Field: "scopes"},
+	{Err: service.ErrTokenTTL, Status: http.StatusBadRequest, Code: "out_of_range", Field: "expires_in_days"},
+	{Err: service.ErrTokenNotFound, Status: http.StatusNotFound, Code: "token_not_found"},
+	{Err: service.ErrTokenInactive, Status: http.StatusUnauthorized, Code: "token_inactive"},
+
+	// администрирование
+	{Err: service.ErrInvalidRole, Status: http.StatusBadRequest, Code: "invalid", Field: "role"},
+	{Err: service.ErrInvalidPageSize, Status: http.StatusBadRequest, Code: "out_of_range", Field: "limit"},
+	{Err: service.ErrCannotEditSelf, Status: http.StatusConflict, Code: "cannot_edit_self"},
+}
+
+func respondWithError(c *gin.Context, err error) {
+	if p, ok := errorTable.Lookup(err); ok {
+		problem.Write(c, p)
+		return
+	}
+	log.Printf("request_id=%s internal error: %v", c.GetString(midleware.RequestIDKey), err)
+	problem.Write(c, problem.Internal())
+}
+
+func respondUnauthorized(c *gin.Context) {
+	problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized"))
+}
+
+func respondInvalidJSON(c *gin.Context, err error) {
+	problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidJSON, "invalid JSON: "+err.Error()))
+}
+
+// DTO, которым нужна нормализация (например, обрезка пробелов) до проверки
+type normalizer interface {
+	normalize()
+}
+
+// bindJSON разбирает тело и проверяет DTO по тегам validate; при ошибке
+// сам отвечает клиентом и возвращает false
+func bindJSON(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		respondInvalidJSON(c, err)
+		return false
+	}
+	if n, ok := req.(normalizer); ok {
+		n.normalize()
+	}
+	if err := validation.Struct(req); err != nil {
+		respondWithError(c, err)
+		return false
+	}
+	return true
+}
+
+// Ошибка подписи JWT — не доменная, но клиенту нужен тот же формат
+func respondTokenIssueError(c *gin.Context, err error) {
+	log.Printf("request_id=%s could not generate token: %v", c.GetString(midleware.RequestIDKey), err)
+	problem.Write(c, problem.New(http.StatusInternalServerError, problem.CodeInternal, "could not generate token"))
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/oidc"
+	"user-service/problem"
+	"user-service/service"
+)
+
+const oidcFlowCookie = "oidc_flow"
+
+func oidcCookieSecure() bool {
+	return os.Getenv("OIDC_COOKIE_SECURE") == "true"
+}
+
+func setFlowCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, value, maxAge, "/auth/oidc", "", oidcCookieSecure(), true)
+}
+
+// Начало входа через SSO: редирект на провайдера с state, nonce и PKCE
+func OIDCStart(reg *oidc.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := reg.Get(c.Param("provider"))
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		flow, err := oidc.NewFlow(p.Name())
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		authURL, err := p.AuthCodeURL(c.Request.Context(), flow)
+		if err != nil {
+			log.Printf("oidc start: %v", err)
+			problem.Write(c, problem.New(http.StatusBadGateway, "identity_provider_unavailable", "identity provider unavailable"))
+			return
+		}
+
+		cookie, err := oidc.EncodeFlow(flow)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		setFlowCookie(c, cookie, int(oidc.FlowTTL().Seconds()))
+
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// Возврат от провайдера: сверяем state, меняем code на id_token и входим
+func OIDCCallback(reg *oidc.Registry, s service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := reg.Get(c.Param("provider"))
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		raw, err := c.Cookie(oidcFlowCookie)
+		if err != nil {
+			respondWithError(c, oidc.ErrInvalidFlow)
+			return
+		}
+		// кука одноразовая
+		setFlowCookie(c, "", -1)
+
+		flow, err := oidc.DecodeFlow(raw)
+		if err != nil || flow.Provider != p.Name() || c.Query("state") != flow.State {
+			respondWithError(c, oidc.ErrInvalidFlow)
+			return
+		}
+
+		if e := c.Query("error"); e != "" {
+			problem.Write(c, problem.New(http.StatusUnauthorized, "identity_provider_error", "identity provider error: "+e))
+			return
+		}
+		code := c.Query("code")
+		if code == "" {
+			problem.Write(c, problem.Invalid("code", "required", "code is required"))
+			return
+		}
+
+		rawIDToken, err := p.Exchange(c.Request.Context(), code, flow.Verifier)
+		if err != nil {
+			log.Printf("oidc callback: %v", err)
+			problem.Write(c, problem.New(http.StatusBadGateway, "code_exchange_failed", "could not exchange authorization code"))
+			return
+		}
+
+		identity, err := p.VerifyIDToken(c.Request.Context(), rawIDToken, flow.Nonce)
+		if err != nil {
+			log.Printf("oidc callback: %v", err)
+			respondWithError(c, oidc.ErrInvalidIDToken)
+			return
+		}
+
+		user, err := s.LoginWithIdentity(c.Request.Context(), p.Name(), identity.Subject, identity.Email, identity.EmailVerified)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		respondWithLogin(c, user)
+	}
+}
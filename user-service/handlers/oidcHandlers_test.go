@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"user-service/audit"
+	"user-service/oidc"
+	"user-service/repository"
+	"user-service/service"
+)
+
+const (
+	testClientID     = "notes-app"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://notes.local/auth/oidc/corp/callback"
+)
+
+// mockProvider — минимальный OIDC-провайдер: discovery, authorize, token и JWKS.
+// Код выдаётся на authorize и проверяется на token вместе с PKCE.
+type mockProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	// кого «залогинил» пользователь у провайдера
+	subject       string
+	email         string
+	emailVerified bool
+	nonce         string // если задан, подменяет nonce из запроса
+
+	mu        sync.Mutex
+	codes     map[string]issuedCode
+	exchanges int
+}
+
+type issuedCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, codes: map[string]issuedCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig", "alg": "RS256",
+			"n": enc.EncodeToString(key.N.Bytes()),
+			"e": enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL ||
+		q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" ||
+		q.Get("code_challenge") == "" || q.Get("nonce") == "" || q.Get("state") == "" {
+		m.t.Errorf("authorize: unexpected request %s", r.URL.RawQuery)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + q.Get("state")
+	m.mu.Lock()
+	m.codes[code] = issuedCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, testRedirectURL+"?"+back.Encode(), http.StatusFound)
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.exchanges++
+	issued, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	id, secret, _ := r.BasicAuth()
+	if id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	nonce := issued.nonce
+	if m.nonce != "" {
+		nonce = m.nonce
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.srv.URL,
+		"aud":            testClientID,
+		"sub":            m.subject,
+		"email":          m.email,
+		"email_verified": m.emailVerified,
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = "k1"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+type oidcFixture struct {
+	provider *mockProvider
+	router   *gin.Engine
+	mock     sqlmock.Sqlmock
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	gin.SetMode(gin.TestMode)
+
+	p := newMockProvider(t)
+	reg := oidc.NewRegistry(map[string]oidc.ProviderConfig{"corp": {
+		Name: "corp", Issuer: p.srv.URL, ClientID: testClientID, ClientSecret: testClientSecret,
+		RedirectURL: testRedirectURL, Scopes: []string{"openid", "email"},
+	}})
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	users := service.NewUserService(repository.NewUserRepository(db), nil, audit.NewRecorder(nil))
+
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/start", OIDCStart(reg))
+	r.GET("/auth/oidc/:provider/callback", OIDCCallback(reg, users))
+
+	return &oidcFixture{provider: p, router: r, mock: mock}
+}
+
+// start проходит /start и authorize у провайдера; возвращает куку потока
+// и query, с которым провайдер вернул браузер на callback
+func (f *oidcFixture) start(t *testing.T) (*http.Cookie, url.Values) {
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/corp/start", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("start: status %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie || !cookies[0].HttpOnly {
+		t.Fatalf("start: unexpected cookies %v", cookies)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookies[0], back.Query()
+}
+
+func (f *oidcFixture) callback(cookie *http.Cookie, q url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/corp/callback?"+q.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+var userRowColumns = []string{
+	"id", "email", "password", "created_at", "totp_secret", "totp_enabled", "totp_last_step",
+	"role", "disabled_at", "token_version", "mfa_failures", "mfa_locked_until",
+}
+
+const (
+	byIdentityQuery = `FROM users\s+WHERE id = \(SELECT user_id FROM user_identities WHERE provider = \$1 AND subject = \$2\)`
+	byEmailQuery    = `FROM users WHERE lower\(email\) = lower\(\$1\)`
+)
+
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status || !strings.Contains(w.Body.String(), `"`+code+`"`) {
+		t.Fatalf("status %d %s, want %d %s", w.Code, w.Body.String(), status, code)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmailCaseInsensitively(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.provider.subject, f.provider.email, f.provider.emailVerified = "sub-1", "  Alice@Example.COM ", true
+
+	f.mock.ExpectQuery(byIdentityQuery).WithArgs("corp", "sub-1").WillReturnRows(sqlmock.NewRows(userRowColumns))
+	f.mock.ExpectQuery(byEmailQuery).WithArgs("alice@example.com").WillReturnRows(
+		sqlmock.NewRows(userRowColumns).AddRow(7, "alice@example.com", "hash", time.Now(), "", false, 0,
+			"user", nil, 0, 0, nil))
+	f.mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_identities")).
+		WithArgs(7, "corp", "sub-1", "alice@example.com").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	cookie, q := f.start(t)
+	w := f.callback(cookie, q)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var resp LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("no token in %s", w.Body.String())
+	}
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.provider.subject, f.provider.email, f.provider.emailVerified = "sub-2", "alice@example.com", false
+
+	// без привязки по subject дальше email не смотрим — ни поиска, ни привязки
+	f.mock.ExpectQuery(byIdentityQuery).WithArgs("corp", "sub-2").WillReturnRows(sqlmock.NewRows(userRowColumns))
+
+	cookie, q := f.start(t)
+	assertProblem(t, f.callback(cookie, q), http.StatusForbidden, "email_unverified")
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	cookie, q := f.start(t)
+	q.Set("state", "forged")
+	assertProblem(t, f.callback(cookie, q), http.StatusBadRequest, "invalid_login_flow")
+
+	_, q = f.start(t)
+	assertProblem(t, f.callback(nil, q), http.StatusBadRequest, "invalid_login_flow")
+
+	if f.provider.exchanges != 0 {
+		t.Fatalf("code exchanged %d times despite invalid state", f.provider.exchanges)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.provider.subject, f.provider.email, f.provider.emailVerified = "sub-3", "alice@example.com", true
+	f.provider.nonce = "replayed-nonce"
+
+	cookie, q := f.start(t)
+	assertProblem(t, f.callback(cookie, q), http.StatusUnauthorized, "invalid_id_token")
+	if err := f.mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCCallbackRejectsWrongPKCEVerifier(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.provider.subject, f.provider.email, f.provider.emailVerified = "sub-4", "alice@example.com", true
+
+	cookie, q := f.start(t)
+	flow, err := oidc.DecodeFlow(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// перехваченный code без исходного verifier обменять нельзя
+	flow.Verifier = strings.Repeat("x", 64)
+	forged, err := oidc.EncodeFlow(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie.Value = forged
+
+	assertProblem(t, f.callback(cookie, q), http.StatusBadGateway, "code_exchange_failed")
+	if f.provider.exchanges != 1 {
+		t.Fatalf("exchanges = %d, want 1", f.provider.exchanges)
+	}
+}
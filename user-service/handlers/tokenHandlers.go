@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/auth"
+	"user-service/midleware"
+	"user-service/models"
+	"user-service/problem"
+	"user-service/service"
+)
+
+func CreateToken(s service.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		var req CreateTokenRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		t, plain, err := s.CreateToken(c.Request.Context(), userID, req.Name, req.Scopes, req.ExpiresInDays)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, CreateTokenResponse{AccessToken: t, Token: plain})
+	}
+}
+
+func ListTokens(s service.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		tokens, err := s.ListTokens(c.Request.Context(), userID)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		if tokens == nil {
+			tokens = []models.AccessToken{}
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func RevokeToken(s service.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil || id <= 0 {
+			problem.Write(c, problem.Invalid("id", "invalid", "invalid id in path"))
+			return
+		}
+
+		if err := s.RevokeToken(c.Request.Context(), userID, id); err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Внутренний эндпоинт: note-service проверяет здесь токен из заголовка Authorization.
+// PAT ищется по хэшу; для JWT сверяется версия сессии и блокировка аккаунта.
+func IntrospectToken(tokens service.TokenService, users service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req IntrospectRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		if !strings.HasPrefix(req.Token, auth.PATPrefix) {
+			introspectJWT(c, users, req.Token)
+			return
+		}
+
+		t, err := tokens.Introspect(c.Request.Context(), req.Token)
+		if err != nil {
+			if errors.Is(err, service.ErrTokenInactive) {
+				c.JSON(http.StatusOK, IntrospectResponse{Active: false})
+				return
+			}
+			respondWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, IntrospectResponse{
+			Active:    true,
+			TokenType: "pat",
+			UserID:    t.UserID,
+			Scopes:    t.Scopes,
+			ExpiresAt: &t.ExpiresAt,
+		})
+	}
+}
+
+func introspectJWT(c *gin.Context, users service.UserService, token string) {
+	claims, err := auth.ParseClaims(token)
+	if err != nil {
+		c.JSON(http.StatusOK, IntrospectResponse{Active: false})
+		return
+	}
+
+	role, err := users.ValidateSession(c.Request.Context(), claims.UserID, claims.TokenVersion)
+	if err != nil {
+		if errors.Is(err, service.ErrAccountDisabled) ||
+			errors.Is(err, service.ErrSessionRevoked) ||
+			errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusOK, IntrospectResponse{Active: false})
+			return
+		}
+		respondWithError(c, err)
+		return
+	}
+
+	resp := IntrospectResponse{
+		Active:    true,
+		TokenType: "jwt",
+		UserID:    claims.UserID,
+		Role:      role,
+		Scopes:    []string{auth.ScopeNotesRead, auth.ScopeNotesWrite},
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = &claims.ExpiresAt.Time
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/auth"
+	"user-service/midleware"
+	"user-service/service"
+)
+
+func SetupTwoFactor(s service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		secret, uri, err := s.SetupTOTP(c.Request.Context(), userID)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, TwoFactorSetupResponse{Secret: secret, OTPAuthURI: uri})
+	}
+}
+
+func ConfirmTwoFactor(s service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		var req TwoFactorConfirmRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		codes, err := s.ConfirmTOTP(c.Request.Context(), userID, req.Code)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, TwoFactorConfirmResponse{RecoveryCodes: codes})
+	}
+}
+
+func DisableTwoFactor(s service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := midleware.GetUserID(c)
+		if !ok || userID <= 0 {
+			respondUnauthorized(c)
+			return
+		}
+
+		var req TwoFactorDisableRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		if err := s.DisableTOTP(c.Request.Context(), userID, req.Password); err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Второй шаг входа: обмен mfa_token + код на обычный JWT
+func LoginTwoFactor(s service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TwoFactorLoginRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		challenge, err := auth.ParseMFAToken(req.MFAToken)
+		if err != nil {
+			respondWithError(c, service.ErrMFATokenInvalid)
+			return
+		}
+
+		user, err := s.VerifySecondFactor(c.Request.Context(), challenge, req.Code, req.RecoveryCode)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		token, err := auth.GenerateToken(user.Id, user.Role, user.TokenVersion)
+		if err != nil {
+			respondTokenIssueError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, LoginResponse{Token: token})
+	}
+}
@@ -1,12 +1,13 @@
 package handlers
 
 import (
-    "errors"
     "net/http"
 
     "github.com/gin-gonic/gin"
 
     "user-service/auth"
+    "user-service/midleware"
+    "user-service/models"
     "user-service/service"
 )
 
@@ -14,25 +15,14 @@ import (
 func RegisterUser(s service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RegisterRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+		if !bindJSON(c, &req) {
 			return
 		}
 
 		user, err := s.RegisterUser(c.Request.Context(), req.Email, req.Password)
 		if err != nil {
-			switch err {
-			case service.ErrEmailRequired,
-				service.ErrEmailInvalid,
-				service.ErrPasswordRequired,
-				service.ErrPasswordTooShort,
-				service.ErrEmailAlreadyTaken:
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			default:
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
-				return
-			}
+			respondWithError(c, err)
+			return
 		}
 
 		c.JSON(http.StatusCreated, RegisterResponse{
@@ -45,28 +35,69 @@ func RegisterUser(s service.UserService) gin.HandlerFunc {
 func LoginUser(s service.UserService) gin.HandlerFunc {
     return func(c *gin.Context) {
         var req LoginRequest
-        if err := c.ShouldBindJSON(&req); err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
+        if !bindJSON(c, &req) {
             return
         }
 
         user, err := s.LoginUser(c.Request.Context(), req.Email, req.Password)
         if err != nil {
-            if errors.Is(err, service.ErrInvalidCredentials) {
-                c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
-                return
-            }
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+            respondWithError(c, err)
             return
         }
 
-        token, err := auth.GenerateToken(user.Id)
+        respondWithLogin(c, user)
+    }
+}
+
+// Выдать JWT, а при включённой 2FA — только mfa_token для второго шага
+func respondWithLogin(c *gin.Context, user models.User) {
+    if user.TOTPEnabled {
+        mfaToken, err := auth.GenerateMFAToken(user.Id)
         if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
+            respondTokenIssueError(c, err)
             return
         }
+        c.JSON(http.StatusOK, LoginResponse{MFARequired: true, MFAToken: mfaToken})
+        return
+    }
 
-        c.JSON(http.StatusOK, LoginResponse{Token: token})
+    token, err := auth.GenerateToken(user.Id, user.Role, user.TokenVersion)
+    if err != nil {
+        respondTokenIssueError(c, err)
+        return
     }
+
+    c.JSON(http.StatusOK, LoginResponse{Token: token})
 }
 
+
+// POST /users/me/password — смена пароля; возвращает новый токен,
+// потому что все прежние сессии завершаются
+func ChangePassword(s service.UserService) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, ok := midleware.GetUserID(c)
+        if !ok || userID <= 0 {
+            respondUnauthorized(c)
+            return
+        }
+
+        var req ChangePasswordRequest
+        if !bindJSON(c, &req) {
+            return
+        }
+
+        user, err := s.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword)
+        if err != nil {
+            respondWithError(c, err)
+            return
+        }
+
+        token, err := auth.GenerateToken(user.Id, user.Role, user.TokenVersion)
+        if err != nil {
+            respondTokenIssueError(c, err)
+            return
+        }
+
+        c.JSON(http.StatusOK, LoginResponse{Token: token})
+    }
+}
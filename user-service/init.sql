@@ -4,3 +4,119 @@ CREATE TABLE IF NOT EXISTS users (
     password   TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
+
+-- email без учёта регистра: храним в нижнем регистре, уникальность по lower(email)
+UPDATE users SET email = lower(email)
+ WHERE email <> lower(email)
+   AND NOT EXISTS (SELECT 1 FROM users u WHERE u.email = lower(users.email));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
+
+-- двухфакторная аутентификация (TOTP); секрет зашифрован ключом из TOTP_ENCRYPTION_KEY
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret    TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+
+-- неудачные попытки второго шага входа подряд и блокировка 2FA после них
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_failures     INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_locked_until TIMESTAMP;
+
+-- попытки второго шага по каждому mfa_token (jti); использованный или
+-- исчерпавший попытки токен больше не принимается
+CREATE TABLE IF NOT EXISTS mfa_attempts (
+    jti        TEXT PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts   INT NOT NULL DEFAULT 0,
+    used_at    TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS mfa_attempts_user_idx ON mfa_attempts (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+-- персональные токены доступа для скриптов и интеграций
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id           SERIAL PRIMARY KEY,
+    user_id      INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL,
+    expires_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_tokens_user_idx ON personal_access_tokens (user_id);
+
+-- привязка внешних OIDC-аккаунтов к пользователям
+CREATE TABLE IF NOT EXISTS user_identities (
+    id         SERIAL PRIMARY KEY,
+    user_id    INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider   TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    email      TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+-- роли, блокировка аккаунта и версия сессии (инкремент = принудительный выход)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role          TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at   TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_role_check') THEN
+        ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin', 'support'));
+    END IF;
+END $$;
+
+-- журнал аудита: только добавление записей
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INT,
+    user_id     INT,
+    action      TEXT NOT NULL,
+    target_type TEXT,
+    target_id   TEXT,
+    request_id  TEXT,
+    ip          TEXT,
+    user_agent  TEXT,
+    before_hash TEXT,
+    after_hash  TEXT,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_idx    ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_created_idx ON audit_log (created_at);
+
+-- изменять записи нельзя; удалять — только очистке по сроку хранения: она
+-- передаёт AUDIT_RETENTION_DAYS в audit.retention_days своей транзакции
+CREATE OR REPLACE FUNCTION audit_log_protect() RETURNS trigger AS $$
+DECLARE
+    retention INT := NULLIF(current_setting('audit.retention_days', true), '')::INT;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        RAISE EXCEPTION 'audit_log is append-only';
+    END IF;
+    IF retention IS NULL OR retention <= 0 THEN
+        RAISE EXCEPTION 'audit_log entries are deleted only by retention';
+    END IF;
+    IF OLD.created_at >= NOW() - make_interval(days => retention) THEN
+        RAISE EXCEPTION 'audit_log entries younger than % days cannot be deleted', retention;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_protect ON audit_log;
+CREATE TRIGGER audit_log_protect BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_protect();
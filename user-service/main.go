@@ -1,21 +1,28 @@
 package main
 
 import (
+    "context"
     "log"
     "net/http"
+    "os"
+    "strconv"
 
     "github.com/gin-gonic/gin"
 
+    "user-service/audit"
+    "user-service/auth"
     "user-service/db"
     "user-service/events"
     "user-service/handlers"
+    "user-service/midleware"
+    "user-service/oidc"
+    "user-service/openapi"
+    "user-service/problem"
     "user-service/repository"
     "user-service/service"
 )
 
 func main() {
-    r := gin.Default()
-
     database, err := db.GetDB()
     if err != nil {
         log.Fatalf("failed to connect to db: %v", err)
@@ -25,17 +32,132 @@ func main() {
     kafkaWriter := events.NewUserRegisteredWriter()
     defer kafkaWriter.Close()
 
+    auditor := audit.NewRecorder(repository.NewAuditRepository(database))
+
     userRepo := repository.NewUserRepository(database)
-    userSvc := service.NewUserService(userRepo, kafkaWriter)
+    userSvc := service.NewUserService(userRepo, kafkaWriter, auditor)
+    tokenRepo := repository.NewTokenRepository(database)
+    tokenSvc := service.NewTokenService(tokenRepo, auditor)
+    adminSvc := service.NewAdminService(userRepo, auditor)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    go auditor.RunRetention(ctx, auditRetentionDays())
+
+    if err := adminSvc.BootstrapAdmin(ctx, os.Getenv("BOOTSTRAP_ADMIN_EMAIL")); err != nil {
+        log.Printf("failed to bootstrap admin: %v", err)
+    }
+
+    oidcConfigs, err := oidc.LoadConfigs()
+    if err != nil {
+        log.Fatalf("failed to load oidc providers: %v", err)
+    }
+
+    r, err := newRouter(api{
+        users:   userSvc,
+        tokens:  tokenSvc,
+        admin:   adminSvc,
+        auditor: auditor,
+        oidc:    oidc.NewRegistry(oidcConfigs),
+    }, openapi.ModeFromEnv())
+    if err != nil {
+        log.Fatalf("failed to build router: %v", err)
+    }
+
+    if err := r.Run(":8082"); err != nil {
+        log.Fatalf("failed to run user-service: %v", err)
+    }
+}
+
+// api — зависимости HTTP-маршрутов
+type api struct {
+    users   service.UserService
+    tokens  service.TokenService
+    admin   service.AdminService
+    auditor *audit.Recorder
+    oidc    *oidc.Registry
+}
+
+// newRouter собирает REST API: ошибки в problem+json, контракт OpenAPI
+// (/openapi.json, /docs и проверка в режиме validate) и маршруты
+func newRouter(a api, validate string) (*gin.Engine, error) {
+    r := gin.New()
+    r.Use(gin.Logger())
+    // паника и неизвестный маршрут — тоже problem+json
+    r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+        problem.Write(c, problem.Internal())
+    }))
+    r.NoRoute(func(c *gin.Context) {
+        problem.Write(c, problem.New(http.StatusNotFound, problem.CodeNotFound, "route not found"))
+    })
+    r.Use(midleware.RequestID())
+
+    spec, err := openapi.Load()
+    if err != nil {
+        return nil, err
+    }
+    if err := openapi.Register(r, spec); err != nil {
+        return nil, err
+    }
+    validator, err := openapi.Validator(spec, validate)
+    if err != nil {
+        return nil, err
+    }
+    r.Use(validator)
 
     r.GET("/health", func(c *gin.Context) {
         c.JSON(http.StatusOK, gin.H{"status": "user-service ok"})
     })
 
-    r.POST("/users/register", handlers.RegisterUser(userSvc))
-    r.POST("/auth/login", handlers.LoginUser(userSvc))
+    r.POST("/users/register", handlers.RegisterUser(a.users))
+    r.POST("/auth/login", handlers.LoginUser(a.users))
+    r.POST("/auth/login/2fa", handlers.LoginTwoFactor(a.users))
+    r.GET("/auth/oidc/:provider/start", handlers.OIDCStart(a.oidc))
+    r.GET("/auth/oidc/:provider/callback", handlers.OIDCCallback(a.oidc, a.users))
 
-    if err := r.Run(":8082"); err != nil {
-        log.Fatalf("failed to run user-service: %v", err)
+    me := r.Group("/users/me")
+    me.Use(midleware.AuthMiddleware(a.users))
+
+    me.POST("/password", handlers.ChangePassword(a.users))
+    me.GET("/audit", handlers.GetMyAudit(a.auditor))
+
+    me.POST("/2fa/setup", handlers.SetupTwoFactor(a.users))
+    me.POST("/2fa/confirm", handlers.ConfirmTwoFactor(a.users))
+    me.POST("/2fa/disable", handlers.DisableTwoFactor(a.users))
+
+    me.GET("/tokens", handlers.ListTokens(a.tokens))
+    me.POST("/tokens", handlers.CreateToken(a.tokens))
+    me.DELETE("/tokens/:id", handlers.RevokeToken(a.tokens))
+
+    internal := r.Group("/internal")
+    internal.Use(midleware.InternalOnly())
+
+    internal.POST("/tokens/introspect", handlers.IntrospectToken(a.tokens, a.users))
+
+    admin := r.Group("/admin")
+    admin.Use(midleware.AuthMiddleware(a.users))
+
+    // support видит пользователей, менять их может только admin
+    staff := midleware.RequireRole(auth.RoleAdmin, auth.RoleSupport)
+    adminOnly := midleware.RequireRole(auth.RoleAdmin)
+
+    admin.GET("/users", staff, handlers.SearchUsers(a.admin))
+    admin.GET("/users/:id", staff, handlers.GetUser(a.admin))
+    admin.POST("/users/:id/disable", adminOnly, handlers.SetUserDisabled(a.admin, true))
+    admin.POST("/users/:id/enable", adminOnly, handlers.SetUserDisabled(a.admin, false))
+    admin.POST("/users/:id/logout", adminOnly, handlers.ForceLogout(a.admin))
+    admin.PUT("/users/:id/role", adminOnly, handlers.SetUserRole(a.admin))
+    admin.GET("/audit", adminOnly, handlers.GetAudit(a.auditor))
+
+    return r, nil
+}
+
+// срок хранения журнала аудита в днях; 0 — хранить бессрочно
+func auditRetentionDays() int {
+    days, err := strconv.Atoi(os.Getenv("AUDIT_RETENTION_DAYS"))
+    if err != nil {
+        return 365
     }
+    return days
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	"user-service/audit"
+	"user-service/auth"
+	"user-service/midleware"
+	"user-service/models"
+	"user-service/oidc"
+	"user-service/openapi"
+	"user-service/repository"
+	"user-service/service"
+)
+
+// Контракт: каждая операция из openapi.yaml проходит через собранный
+// роутер с проверкой в режиме strict. Ответ, который расходится со
+// спецификацией, валидатор заменяет на 500 response_spec_mismatch.
+
+var testTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testUser() models.User {
+	return models.User{Id: 1, Email: "a@example.com", CreatedAt: testTime, Role: auth.RoleAdmin}
+}
+
+type fakeUsers struct{ service.UserService }
+
+func (fakeUsers) RegisterUser(_ context.Context, email, _ string) (models.User, error) {
+	u := testUser()
+	u.Email = email
+	return u, nil
+}
+func (fakeUsers) LoginUser(context.Context, string, string) (models.User, error) {
+	return testUser(), nil
+}
+func (fakeUsers) VerifySecondFactor(context.Context, auth.MFAChallenge, string, string) (models.User, error) {
+	return testUser(), nil
+}
+func (fakeUsers) SetupTOTP(context.Context, int) (string, string, error) {
+	return "JBSWY3DPEHPK3PXP", "otpauth://totp/notes:a@example.com?secret=JBSWY3DPEHPK3PXP", nil
+}
+func (fakeUsers) ConfirmTOTP(context.Context, int, string) ([]string, error) {
+	return []string{"aaaa-bbbb"}, nil
+}
+func (fakeUsers) DisableTOTP(context.Context, int, string) error { return nil }
+func (fakeUsers) ValidateSession(context.Context, int, int) (string, error) {
+	return auth.RoleAdmin, nil
+}
+func (fakeUsers) ChangePassword(context.Context, int, string, string) (models.User, error) {
+	return testUser(), nil
+}
+
+type fakeTokens struct{ service.TokenService }
+
+func testToken() models.AccessToken {
+	return models.AccessToken{ID: 3, UserID: 1, Name: "ci", Scopes: []string{auth.ScopeNotesRead},
+		ExpiresAt: testTime.AddDate(0, 1, 0), CreatedAt: testTime}
+}
+
+func (fakeTokens) CreateToken(context.Context, int, string, []string, int) (models.AccessToken, string, error) {
+	return testToken(), auth.PATPrefix + "secret", nil
+}
+func (fakeTokens) ListTokens(context.Context, int) ([]models.AccessToken, error) {
+	return []models.AccessToken{testToken()}, nil
+}
+func (fakeTokens) RevokeToken(context.Context, int, int) error { return nil }
+func (fakeTokens) Introspect(context.Context, string) (models.AccessToken, error) {
+	return testToken(), nil
+}
+
+type fakeAdmin struct{ service.AdminService }
+
+func (fakeAdmin) SearchUsers(context.Context, string, int, int) ([]models.User, int, error) {
+	return []models.User{testUser()}, 1, nil
+}
+func (fakeAdmin) GetUser(context.Context, int) (models.User, error) { return testUser(), nil }
+func (fakeAdmin) SetUserDisabled(context.Context, int, int, bool) error {
+	return nil
+}
+func (fakeAdmin) ForceLogout(context.Context, int, int) error         { return nil }
+func (fakeAdmin) SetUserRole(context.Context, int, int, string) error { return nil }
+
+type contractCase struct {
+	method, route string // операция в спецификации
+	path          string
+	body          string
+	header        http.Header
+	status        int
+	// заглушки SQL для маршрутов на репозиториях
+	sql func(sqlmock.Sqlmock)
+}
+
+func TestContractStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token, err := auth.GenerateToken(1, auth.RoleAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaToken, err := auth.GenerateMFAToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer := http.Header{"Authorization": {"Bearer " + token}}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, err := newRouter(api{
+		users:   fakeUsers{},
+		tokens:  fakeTokens{},
+		admin:   fakeAdmin{},
+		auditor: audit.NewRecorder(repository.NewAuditRepository(db)),
+		oidc:    oidc.NewRegistry(nil),
+	}, openapi.ValidateStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditRows := func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(regexp.QuoteMeta("FROM audit_log")).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "actor_id", "user_id", "action", "target_type", "target_id",
+			"request_id", "ip", "user_agent", "before_hash", "after_hash", "created_at",
+		}).AddRow(1, 1, 1, audit.ActionLogin, "password", "", "rid", "127.0.0.1", "ua", "", "", testTime))
+	}
+
+	cases := []contractCase{
+		{method: "GET", route: "/health", path: "/health", status: 200},
+		{method: "POST", route: "/users/register", path: "/users/register",
+			body: `{"email":"b@example.com","password":"long-enough-password"}`, status: 201},
+		{method: "POST", route: "/auth/login", path: "/auth/login",
+			body: `{"email":"a@example.com","password":"long-enough-password"}`, status: 200},
+		{method: "POST", route: "/auth/login/2fa", path: "/auth/login/2fa",
+			body: `{"mfa_token":"` + mfaToken + `","code":"123456"}`, status: 200},
+		{method: "GET", route: "/auth/oidc/{provider}/start", path: "/auth/oidc/corp/start", status: 404},
+		{method: "GET", route: "/auth/oidc/{provider}/callback", path: "/auth/oidc/corp/callback?state=s&code=c", status: 404},
+		{method: "POST", route: "/users/me/password", path: "/users/me/password", header: bearer,
+			body: `{"current_password":"long-enough-password","new_password":"another-long-password"}`, status: 200},
+		{method: "GET", route: "/users/me/audit", path: "/users/me/audit?limit=10", header: bearer, status: 200, sql: auditRows},
+		{method: "POST", route: "/users/me/2fa/setup", path: "/users/me/2fa/setup", header: bearer, status: 200},
+		{method: "POST", route: "/users/me/2fa/confirm", path: "/users/me/2fa/confirm", header: bearer,
+			body: `{"code":"123456"}`, status: 200},
+		{method: "POST", route: "/users/me/2fa/disable", path: "/users/me/2fa/disable", header: bearer,
+			body: `{"password":"long-enough-password"}`, status: 204},
+		{method: "GET", route: "/users/me/tokens", path: "/users/me/tokens", header: bearer, status: 200},
+		{method: "POST", route: "/users/me/tokens", path: "/users/me/tokens", header: bearer,
+			body: `{"name":"ci","scopes":["notes:read"],"expires_in_days":30}`, status: 201},
+		{method: "DELETE", route: "/users/me/tokens/{id}", path: "/users/me/tokens/3", header: bearer, status: 204},
+		{method: "POST", route: "/internal/tokens/introspect", path: "/internal/tokens/introspect",
+			header: http.Header{midleware.InternalKeyHeader: {"dev-internal-key"}},
+			body:   `{"token":"` + auth.PATPrefix + `secret"}`, status: 200},
+		{method: "GET", route: "/admin/users", path: "/admin/users?q=a&limit=10", header: bearer, status: 200},
+		{method: "GET", route: "/admin/users/{id}", path: "/admin/users/2", header: bearer, status: 200},
+		{method: "POST", route: "/admin/users/{id}/disable", path: "/admin/users/2/disable", header: bearer, status: 204},
+		{method: "POST", route: "/admin/users/{id}/enable", path: "/admin/users/2/enable", header: bearer, status: 204},
+		{method: "POST", route: "/admin/users/{id}/logout", path: "/admin/users/2/logout", header: bearer, status: 204},
+		{method: "PUT", route: "/admin/users/{id}/role", path: "/admin/users/2/role", header: bearer,
+			body: `{"role":"support"}`, status: 204},
+		{method: "GET", route: "/admin/audit", path: "/admin/audit?user_id=1", header: bearer, status: 200, sql: auditRows},
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := map[string]bool{}
+	for _, c := range cases {
+		covered[c.method+" "+c.route] = true
+	}
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			if !covered[method+" "+path] {
+				t.Errorf("operation %s %s has no contract case", method, path)
+			}
+		}
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			if c.sql != nil {
+				c.sql(mock)
+			}
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			if c.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for k, v := range c.header {
+				req.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.status, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package midleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/auth"
+	"user-service/problem"
+)
+
+// ключ, под которым кладём user_id в контекст
+const userIDContextKey = "userID"
+
+// ключ для актуальной роли пользователя
+const roleContextKey = "role"
+
+// SessionValidator сверяет JWT с состоянием пользователя в БД
+// (блокировка, принудительный выход) и возвращает актуальную роль
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID, tokenVersion int) (string, error)
+}
+
+func AuthMiddleware(sessions SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "missing Authorization header"))
+			return
+		}
+
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid Authorization header"))
+			return
+		}
+
+		claims, err := auth.ParseClaims(parts[1])
+		if err != nil {
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid token"))
+			return
+		}
+
+		role, err := sessions.ValidateSession(c.Request.Context(), claims.UserID, claims.TokenVersion)
+		if err != nil {
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "invalid token"))
+			return
+		}
+
+		c.Set(userIDContextKey, claims.UserID)
+		c.Set(roleContextKey, role)
+
+		c.Next()
+	}
+}
+
+// RequireRole пропускает только пользователей с одной из указанных ролей
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetRole(c)
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		problem.Write(c, problem.New(http.StatusForbidden, problem.CodeForbidden, "forbidden"))
+	}
+}
+
+// Хелпер для хендлеров
+func GetUserID(c *gin.Context) (int, bool) {
+	v, ok := c.Get(userIDContextKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(int)
+	return id, ok
+}
+
+func GetRole(c *gin.Context) string {
+	v, _ := c.Get(roleContextKey)
+	role, _ := v.(string)
+	return role
+}
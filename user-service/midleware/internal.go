@@ -0,0 +1,34 @@
+package midleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/problem"
+)
+
+const InternalKeyHeader = "X-Internal-Key"
+
+func internalKey() string {
+	k := os.Getenv("INTERNAL_API_KEY")
+	if k == "" {
+		// только для локальной разработки
+		k = "dev-internal-key"
+	}
+	return k
+}
+
+// InternalOnly пропускает только запросы других сервисов с общим ключом
+func InternalOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(InternalKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(internalKey())) != 1 {
+			problem.Write(c, problem.New(http.StatusForbidden, problem.CodeForbidden, "forbidden"))
+			return
+		}
+		c.Next()
+	}
+}
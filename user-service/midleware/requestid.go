@@ -0,0 +1,32 @@
+package midleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"user-service/audit"
+)
+
+const RequestIDKey = "request_id"
+
+// RequestID принимает X-Request-ID от клиента или генерирует новый и вместе
+// с IP и User-Agent кладёт его в контекст запроса для журнала аудита
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rid := ctx.GetHeader("X-Request-ID")
+		if rid == "" {
+			rid = uuid.NewString()
+		}
+
+		ctx.Set(RequestIDKey, rid)
+		ctx.Writer.Header().Set("X-Request-ID", rid)
+
+		ctx.Request = ctx.Request.WithContext(audit.WithMeta(ctx.Request.Context(), audit.Meta{
+			RequestID: rid,
+			IP:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		}))
+
+		ctx.Next()
+	}
+}
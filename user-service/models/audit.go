@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Запись журнала аудита: кто (actor) что сделал с чьими данными (user)
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	ActorID    *int      `json:"actor_id"`
+	UserID     *int      `json:"user_id"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type,omitempty"`
+	TargetID   string    `json:"target_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	BeforeHash string    `json:"before_hash,omitempty"`
+	AfterHash  string    `json:"after_hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -7,4 +7,25 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // не отдаём наружу
 	CreatedAt time.Time `json:"created_at"`
+
+	TOTPSecret   string `json:"-"` // зашифрован, см. auth.SealTOTPSecret
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"`
+
+	// ошибки второго шага подряд; после каждых нескольких вход по 2FA
+	// блокируется до MFALockedUntil
+	MFAFailures    int        `json:"-"`
+	MFALockedUntil *time.Time `json:"-"`
+
+	Role         string     `json:"role"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	TokenVersion int        `json:"-"`
+}
+
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u User) MFALocked(now time.Time) bool {
+	return u.MFALockedUntil != nil && now.Before(*u.MFALockedUntil)
 }
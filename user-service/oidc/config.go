@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProviderConfig — настройки одного внешнего провайдера (relying party)
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// LoadConfigs читает провайдеров из JSON-файла OIDC_PROVIDERS_FILE и/или
+// из переменных окружения: OIDC_PROVIDERS=corp,google и OIDC_CORP_ISSUER,
+// OIDC_CORP_CLIENT_ID, OIDC_CORP_CLIENT_SECRET, OIDC_CORP_REDIRECT_URL, OIDC_CORP_SCOPES.
+// Переменные окружения перекрывают файл.
+func LoadConfigs() (map[string]ProviderConfig, error) {
+	configs := map[string]ProviderConfig{}
+
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: read providers file: %w", err)
+		}
+		var list []ProviderConfig
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("oidc: parse providers file: %w", err)
+		}
+		for _, pc := range list {
+			configs[strings.ToLower(pc.Name)] = pc
+		}
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		pc := configs[name]
+		pc.Name = name
+		if v := os.Getenv(prefix + "ISSUER"); v != "" {
+			pc.Issuer = v
+		}
+		if v := os.Getenv(prefix + "CLIENT_ID"); v != "" {
+			pc.ClientID = v
+		}
+		if v := os.Getenv(prefix + "CLIENT_SECRET"); v != "" {
+			pc.ClientSecret = v
+		}
+		if v := os.Getenv(prefix + "REDIRECT_URL"); v != "" {
+			pc.RedirectURL = v
+		}
+		if v := os.Getenv(prefix + "SCOPES"); v != "" {
+			pc.Scopes = strings.Fields(strings.ReplaceAll(v, ",", " "))
+		}
+		configs[name] = pc
+	}
+
+	for name, pc := range configs {
+		if pc.Issuer == "" || pc.ClientID == "" || pc.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc: provider %q: issuer, client_id and redirect_url are required", name)
+		}
+		if len(pc.Scopes) == 0 {
+			pc.Scopes = []string{"openid", "email", "profile"}
+		}
+		if !containsScope(pc.Scopes, "openid") {
+			pc.Scopes = append([]string{"openid"}, pc.Scopes...)
+		}
+		configs[name] = pc
+	}
+
+	return configs, nil
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"user-service/auth"
+)
+
+const flowTTL = 10 * time.Minute
+
+var ErrInvalidFlow = errors.New("invalid or expired login flow")
+
+// Flow — состояние незавершённого входа между /start и /callback.
+// Хранится у клиента в подписанной HttpOnly-куке, поэтому сервер остаётся без состояния.
+type Flow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type flowClaims struct {
+	Flow
+	jwt.RegisteredClaims
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func NewFlow(provider string) (Flow, error) {
+	f := Flow{Provider: provider}
+	var err error
+	if f.State, err = randomString(24); err != nil {
+		return Flow{}, fmt.Errorf("oidc: new flow: %w", err)
+	}
+	if f.Nonce, err = randomString(24); err != nil {
+		return Flow{}, fmt.Errorf("oidc: new flow: %w", err)
+	}
+	// RFC 7636: verifier 43..128 символов
+	if f.Verifier, err = randomString(48); err != nil {
+		return Flow{}, fmt.Errorf("oidc: new flow: %w", err)
+	}
+	return f, nil
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func EncodeFlow(f Flow) (string, error) {
+	claims := flowClaims{
+		Flow: f,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(flowTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(auth.DerivedKey("oidc-flow"))
+}
+
+func DecodeFlow(raw string) (Flow, error) {
+	var claims flowClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidFlow
+		}
+		return auth.DerivedKey("oidc-flow"), nil
+	})
+	if err != nil || !token.Valid {
+		return Flow{}, ErrInvalidFlow
+	}
+	return claims.Flow, nil
+}
+
+func FlowTTL() time.Duration {
+	return flowTTL
+}
@@ -0,0 +1,134 @@
+// Package problem — ошибки API в формате RFC 7807 (application/problem+json).
+// Клиенты различают ошибки по code, а не по тексту detail: тексты могут
+// меняться, коды — нет.
+//
+// Пакет одинаков в note-service и user-service (отличается только путь импорта
+// validation): сервисы — отдельные модули без общего кода. Совпадение копий
+// проверяет copies_test.go в note-service.
+package problem
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"user-service/validation"
+)
+
+const ContentType = "application/problem+json"
+
+// type — относительный URI вида /problems/<code>
+const typeBase = "/problems/"
+
+// Общие коды; доменные задаются в таблицах соответствия у хендлеров
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnavailable      = "service_unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// FieldError — ошибка конкретного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// недостающий scope токена (insufficient_scope); user-service его не выдаёт
+	RequiredScope string `json:"required_scope,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   typeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Invalid — 400 validation_failed с ошибкой одного поля
+func Invalid(field, code, message string) *Problem {
+	return New(http.StatusBadRequest, CodeValidation, message).WithField(field, code, message)
+}
+
+func Internal() *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+func (p *Problem) WithField(field, code, message string) *Problem {
+	p.Errors = append(p.Errors, FieldError{Field: field, Code: code, Message: message})
+	return p
+}
+
+// Write отдаёт ошибку и прерывает цепочку обработчиков. request_id берём
+// из заголовка ответа, который уже выставил midleware.RequestID.
+func Write(c *gin.Context, p *Problem) {
+	p.RequestID = c.Writer.Header().Get("X-Request-ID")
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Mapping — строка таблицы соответствия доменной ошибки и ответа API.
+// Если указано Field, ответ — validation_failed с ошибкой этого поля, а Code
+// становится кодом поля.
+type Mapping struct {
+	Err    error
+	Status int
+	Code   string
+	Field  string
+}
+
+type Table []Mapping
+
+// Lookup ищет первую подходящую строку (по errors.Is). Ошибки пакета
+// validation превращаются в validation_failed со всеми нарушениями сразу.
+func (t Table) Lookup(err error) (*Problem, bool) {
+	var verr *validation.Error
+	if errors.As(err, &verr) {
+		return FromValidation(verr), true
+	}
+	for _, m := range t {
+		if !errors.Is(err, m.Err) {
+			continue
+		}
+		if m.Field != "" {
+			p := New(m.Status, CodeValidation, m.Err.Error())
+			return p.WithField(m.Field, m.Code, m.Err.Error()), true
+		}
+		return New(m.Status, m.Code, m.Err.Error()), true
+	}
+	return nil, false
+}
+
+func FromValidation(verr *validation.Error) *Problem {
+	detail := "request has invalid fields"
+	if len(verr.Violations) == 1 {
+		detail = verr.Violations[0].Message
+	}
+	p := New(http.StatusBadRequest, CodeValidation, detail)
+	for _, v := range verr.Violations {
+		p.WithField(v.Field, v.Code, v.Message)
+	}
+	return p
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"user-service/models"
+)
+
+const auditColumns = `id, actor_id, user_id, action, COALESCE(target_type, ''), COALESCE(target_id, ''),
+	COALESCE(request_id, ''), COALESCE(ip, ''), COALESCE(user_agent, ''),
+	COALESCE(before_hash, ''), COALESCE(after_hash, ''), created_at`
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+// Фильтр выборки журнала; нулевые поля не ограничивают выборку
+type AuditFilter struct {
+	UserID int
+	Action string
+	Limit  int
+	Offset int
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (r *AuditRepository) Insert(ctx context.Context, e models.AuditEntry) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO audit_log (actor_id, user_id, action, target_type, target_id,
+		                        request_id, ip, user_agent, before_hash, after_hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		e.ActorID, e.UserID, e.Action, nullString(e.TargetType), nullString(e.TargetID),
+		nullString(e.RequestID), nullString(e.IP), nullString(e.UserAgent),
+		nullString(e.BeforeHash), nullString(e.AfterHash),
+	)
+	if err != nil {
+		return fmt.Errorf("repo: insert-audit action=%s: %w", e.Action, err)
+	}
+	return nil
+}
+
+// Записи от новых к старым
+func (r *AuditRepository) List(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT `+auditColumns+` FROM audit_log
+		 WHERE ($1 = 0 OR user_id = $1) AND ($2 = '' OR action = $2)
+		 ORDER BY id DESC LIMIT $3 OFFSET $4`,
+		f.UserID, f.Action, f.Limit, f.Offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: list-audit: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var actorID, userID sql.NullInt64
+		err := rows.Scan(
+			&e.ID, &actorID, &userID, &e.Action, &e.TargetType, &e.TargetID,
+			&e.RequestID, &e.IP, &e.UserAgent, &e.BeforeHash, &e.AfterHash, &e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repo: scan audit: %w", err)
+		}
+		if actorID.Valid {
+			v := int(actorID.Int64)
+			e.ActorID = &v
+		}
+		if userID.Valid {
+			v := int(userID.Int64)
+			e.UserID = &v
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: rows: %w", err)
+	}
+	return entries, nil
+}
+
+// Удалить записи старше retentionDays дней. Триггер audit_log_protect
+// пропускает удаление, только если срок передан в audit.retention_days той же
+// транзакции, и только для записей старше него.
+func (r *AuditRepository) DeleteOlderThan(ctx context.Context, retentionDays int) (int64, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repo: purge-audit: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`SELECT set_config('audit.retention_days', $1, true)`, strconv.Itoa(retentionDays),
+	); err != nil {
+		return 0, fmt.Errorf("repo: purge-audit: %w", err)
+	}
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM audit_log WHERE created_at < NOW() - make_interval(days => $1)`,
+		retentionDays,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repo: purge-audit: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repo: purge-audit: rowsAffected: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repo: purge-audit: commit: %w", err)
+	}
+	return n, nil
+}
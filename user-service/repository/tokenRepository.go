@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"user-service/models"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+const tokenColumns = `id, user_id, name, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+type TokenRepository struct {
+	DB *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{DB: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row rowScanner) (models.AccessToken, error) {
+	var t models.AccessToken
+	var lastUsed, revoked sql.NullTime
+	err := row.Scan(
+		&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes),
+		&t.ExpiresAt, &lastUsed, &revoked, &t.CreatedAt,
+	)
+	if err != nil {
+		return models.AccessToken{}, err
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+	return t, nil
+}
+
+// Срок жизни считаем на стороне БД, чтобы не зависеть от часового пояса приложения
+func (r *TokenRepository) Create(ctx context.Context, userID int, name, tokenHash string, scopes []string, ttlDays int) (models.AccessToken, error) {
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+	          VALUES ($1, $2, $3, $4, NOW() + make_interval(days => $5))
+	          RETURNING ` + tokenColumns
+	t, err := scanToken(r.DB.QueryRowContext(ctx, query, userID, name, tokenHash, pq.Array(scopes), ttlDays))
+	if err != nil {
+		return models.AccessToken{}, fmt.Errorf("repo: create-token: %w", err)
+	}
+	return t, nil
+}
+
+// Активные (не отозванные и не истёкшие) токены пользователя
+func (r *TokenRepository) ListByUser(ctx context.Context, userID int) ([]models.AccessToken, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT `+tokenColumns+` FROM personal_access_tokens
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo: list-tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.AccessToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repo: scan token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: rows: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *TokenRepository) Revoke(ctx context.Context, userID, id int) error {
+	res, err := r.DB.ExecContext(ctx,
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		id, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: revoke-token id=%d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repo: revoke-token id=%d: rowsAffected: %w", id, err)
+	}
+	if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// Найти действующий токен по хэшу и отметить использование.
+// last_used_at обновляем не чаще раза в минуту, чтобы не писать в БД на каждый запрос.
+func (r *TokenRepository) UseActiveByHash(ctx context.Context, tokenHash string) (models.AccessToken, error) {
+	t, err := scanToken(r.DB.QueryRowContext(ctx,
+		`SELECT `+tokenColumns+` FROM personal_access_tokens
+		 WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		   AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL)`,
+		tokenHash,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AccessToken{}, ErrTokenNotFound
+		}
+		return models.AccessToken{}, fmt.Errorf("repo: get-token: %w", err)
+	}
+
+	_, err = r.DB.ExecContext(ctx,
+		`UPDATE personal_access_tokens SET last_used_at = NOW()
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		t.ID,
+	)
+	if err != nil {
+		return models.AccessToken{}, fmt.Errorf("repo: touch-token: %w", err)
+	}
+	return t, nil
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"user-service/models"
 )
 
 var ErrNotFound = fmt.Errorf("user not found")
 
+const userColumns = `id, email, password, created_at, COALESCE(totp_secret, ''), totp_enabled, COALESCE(totp_last_step, 0),
+	role, disabled_at, token_version, mfa_failures, mfa_locked_until`
+
 type UserRepository struct {
 	DB *sql.DB
 }
@@ -18,6 +23,23 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
+func scanUser(row rowScanner) (models.User, error) {
+	var u models.User
+	var disabledAt, mfaLockedUntil sql.NullTime
+	err := row.Scan(
+		&u.Id, &u.Email, &u.Password, &u.CreatedAt,
+		&u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep,
+		&u.Role, &disabledAt, &u.TokenVersion, &u.MFAFailures, &mfaLockedUntil,
+	)
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+	if mfaLockedUntil.Valid {
+		u.MFALockedUntil = &mfaLockedUntil.Time
+	}
+	return u, err
+}
+
 func (r *UserRepository) Create(ctx context.Context, email, password string) (int, error) {
 	var id int
 	query := `INSERT INTO users (email, password) VALUES ($1, $2) RETURNING id`
@@ -29,11 +51,8 @@ func (r *UserRepository) Create(ctx context.Context, email, password string) (in
 }
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
-	var u models.User
-	query := `SELECT id, email, password, created_at FROM users WHERE email = $1`
-	err := r.DB.QueryRowContext(ctx, query, email).Scan(
-		&u.Id, &u.Email, &u.Password, &u.CreatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1)`
+	u, err := scanUser(r.DB.QueryRowContext(ctx, query, email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.User{}, ErrNotFound
@@ -42,3 +61,355 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (models.U
 	}
 	return u, nil
 }
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	u, err := scanUser(r.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("repo: get-by-id: %w", err)
+	}
+	return u, nil
+}
+
+// Сохранить ещё не подтверждённый TOTP-секрет (2FA пока выключена)
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error {
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND NOT totp_enabled`
+	res, err := r.DB.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return fmt.Errorf("repo: set-totp-secret: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repo: set-totp-secret: rowsAffected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Включить 2FA и заменить коды восстановления — одной транзакцией
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID int, lastStep int64, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repo: enable-totp: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2 AND totp_secret IS NOT NULL`,
+		lastStep, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: enable-totp: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repo: enable-totp: rowsAffected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repo: enable-totp: commit: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("repo: delete-recovery-codes: %w", err)
+	}
+	for _, h := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, h,
+		)
+		if err != nil {
+			return fmt.Errorf("repo: insert-recovery-code: %w", err)
+		}
+	}
+	return nil
+}
+
+// Выключить 2FA, стереть секрет и коды восстановления
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repo: disable-totp: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: disable-totp: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repo: disable-totp: commit: %w", err)
+	}
+	return nil
+}
+
+// Запомнить использованный шаг TOTP. false — код с этим шагом уже предъявляли.
+func (r *UserRepository) MarkTOTPStepUsed(ctx context.Context, userID int, step int64) (bool, error) {
+	res, err := r.DB.ExecContext(ctx,
+		`UPDATE users SET totp_last_step = $1
+		 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("repo: mark-totp-step: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repo: mark-totp-step: rowsAffected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Погасить код восстановления. false — такого неиспользованного кода нет.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	res, err := r.DB.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_at = NOW()
+		 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("repo: use-recovery-code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repo: use-recovery-code: rowsAffected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Засчитать попытку второго шага по mfa_token. false — токен уже
+// использован или исчерпал maxAttempts; попытка засчитывается до проверки
+// кода, чтобы параллельные запросы не обошли лимит.
+func (r *UserRepository) BeginMFAAttempt(ctx context.Context, userID int, jti string, expiresAt time.Time, maxAttempts int) (bool, error) {
+	// попутно убираем истёкшие токены пользователя
+	if _, err := r.DB.ExecContext(ctx,
+		`DELETE FROM mfa_attempts WHERE user_id = $1 AND expires_at < NOW()`, userID); err != nil {
+		return false, fmt.Errorf("repo: begin-mfa-attempt: cleanup: %w", err)
+	}
+	res, err := r.DB.ExecContext(ctx,
+		`INSERT INTO mfa_attempts (jti, user_id, attempts, expires_at) VALUES ($1, $2, 1, $3)
+		 ON CONFLICT (jti) DO UPDATE SET attempts = mfa_attempts.attempts + 1
+		 WHERE mfa_attempts.user_id = $2 AND mfa_attempts.used_at IS NULL AND mfa_attempts.attempts < $4`,
+		jti, userID, expiresAt, maxAttempts,
+	)
+	if err != nil {
+		return false, fmt.Errorf("repo: begin-mfa-attempt: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repo: begin-mfa-attempt: rowsAffected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Ещё одна ошибка второго шага подряд; возвращает их число
+func (r *UserRepository) RecordMFAFailure(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx,
+		`UPDATE users SET mfa_failures = mfa_failures + 1 WHERE id = $1 RETURNING mfa_failures`, userID,
+	).Scan(&n)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("repo: record-mfa-failure: %w", err)
+	}
+	return n, nil
+}
+
+// Заблокировать второй шаг входа до until
+func (r *UserRepository) LockMFA(ctx context.Context, userID int, until time.Time) error {
+	return r.execOne(ctx, "lock-mfa",
+		`UPDATE users SET mfa_locked_until = $2 WHERE id = $1`, userID, until)
+}
+
+// Успешный второй шаг: mfa_token гасится, счётчик ошибок сбрасывается
+func (r *UserRepository) CompleteMFA(ctx context.Context, userID int, jti string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("repo: complete-mfa: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE mfa_attempts SET used_at = NOW() WHERE jti = $1`, jti); err != nil {
+		return fmt.Errorf("repo: complete-mfa: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET mfa_failures = 0, mfa_locked_until = NULL WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("repo: complete-mfa: reset: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repo: complete-mfa: commit: %w", err)
+	}
+	return nil
+}
+
+// Найти пользователя по привязанному внешнему аккаунту
+func (r *UserRepository) GetByIdentity(ctx context.Context, provider, subject string) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users
+	          WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`
+	u, err := scanUser(r.DB.QueryRowContext(ctx, query, provider, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, ErrNotFound
+		}
+		return models.User{}, fmt.Errorf("repo: get-by-identity: %w", err)
+	}
+	return u, nil
+}
+
+func (r *UserRepository) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (provider, subject) DO NOTHING`,
+		userID, provider, subject, email,
+	)
+	if err != nil {
+		return fmt.Errorf("repo: link-identity: %w", err)
+	}
+	return nil
+}
+
+// Создать пользователя сразу с привязанным внешним аккаунтом
+func (r *UserRepository) CreateWithIdentity(ctx context.Context, email, password, provider, subject string) (int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("repo: create-with-identity: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (email, password) VALUES ($1, $2) RETURNING id`,
+		email, password,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("repo: create-with-identity: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`,
+		id, provider, subject, email,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repo: create-with-identity: link: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("repo: create-with-identity: commit: %w", err)
+	}
+	return id, nil
+}
+
+// Поиск пользователей для админки: подстрока email, постранично
+func (r *UserRepository) Search(ctx context.Context, q string, limit, offset int) ([]models.User, int, error) {
+	pattern := "%" + escapeLike(q) + "%"
+
+	var total int
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE email ILIKE $1`, pattern,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("repo: search-users: count: %w", err)
+	}
+
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE email ILIKE $1 ORDER BY id LIMIT $2 OFFSET $3`,
+		pattern, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("repo: search-users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("repo: scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("repo: rows: %w", err)
+	}
+	return users, total, nil
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// Заблокировать/разблокировать аккаунт. Блокировка заодно завершает все сессии.
+func (r *UserRepository) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+	if disabled {
+		query = `UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), token_version = token_version + 1 WHERE id = $1`
+	}
+	return r.execOne(ctx, "set-disabled", query, id)
+}
+
+// Инвалидировать все выданные JWT пользователя
+func (r *UserRepository) BumpTokenVersion(ctx context.Context, id int) error {
+	return r.execOne(ctx, "bump-token-version",
+		`UPDATE users SET token_version = token_version + 1 WHERE id = $1`, id)
+}
+
+func (r *UserRepository) SetRole(ctx context.Context, id int, role string) error {
+	return r.execOne(ctx, "set-role",
+		`UPDATE users SET role = $2, token_version = token_version + 1 WHERE id = $1`, id, role)
+}
+
+func (r *UserRepository) SetRoleByEmail(ctx context.Context, email, role string) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE users SET role = $2 WHERE lower(email) = lower($1)`, email, role)
+	if err != nil {
+		return fmt.Errorf("repo: set-role-by-email: %w", err)
+	}
+	return nil
+}
+
+func (r *UserRepository) execOne(ctx context.Context, op, query string, args ...any) error {
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("repo: %s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repo: %s: rowsAffected: %w", op, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Новый хэш пароля; заодно завершаем все остальные сессии
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	return r.execOne(ctx, "update-password",
+		`UPDATE users SET password = $2, token_version = token_version + 1 WHERE id = $1`, id, passwordHash)
+}
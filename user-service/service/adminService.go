@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"user-service/audit"
+	"user-service/auth"
+	"user-service/models"
+	"user-service/repository"
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrCannotEditSelf  = errors.New("administrators cannot disable or demote themselves")
+	ErrInvalidPageSize = errors.New("limit must be between 1 and 200")
+)
+
+type AdminService interface {
+	SearchUsers(ctx context.Context, q string, limit, offset int) ([]models.User, int, error)
+	GetUser(ctx context.Context, id int) (models.User, error)
+	SetUserDisabled(ctx context.Context, actorID, id int, disabled bool) error
+	ForceLogout(ctx context.Context, actorID, id int) error
+	SetUserRole(ctx context.Context, actorID, id int, role string) error
+	BootstrapAdmin(ctx context.Context, email string) error
+}
+
+type adminService struct {
+	repo  *repository.UserRepository
+	audit *audit.Recorder
+}
+
+func NewAdminService(repo *repository.UserRepository, auditor *audit.Recorder) AdminService {
+	return &adminService{repo: repo, audit: auditor}
+}
+
+func (s *adminService) SearchUsers(ctx context.Context, q string, limit, offset int) ([]models.User, int, error) {
+	if limit == 0 {
+		limit = defaultUsersPageSize
+	}
+	if limit < 1 || limit > maxUsersPageSize {
+		return nil, 0, ErrInvalidPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, total, err := s.repo.Search(ctx, strings.TrimSpace(q), limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("service: search-users: %w", err)
+	}
+	return users, total, nil
+}
+
+func (s *adminService) GetUser(ctx context.Context, id int) (models.User, error) {
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.User{}, ErrUserNotFound
+		}
+		return models.User{}, fmt.Errorf("service: get-user: %w", err)
+	}
+	return u, nil
+}
+
+func (s *adminService) SetUserDisabled(ctx context.Context, actorID, id int, disabled bool) error {
+	if disabled && actorID == id {
+		return ErrCannotEditSelf
+	}
+	if err := s.repo.SetDisabled(ctx, id, disabled); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("service: set-disabled: %w", err)
+	}
+
+	action := audit.ActionUserEnabled
+	if disabled {
+		action = audit.ActionUserDisabled
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action: action, ActorID: actorID, UserID: id,
+		TargetType: "user", TargetID: fmt.Sprint(id),
+		Before: map[string]any{"disabled": !disabled}, After: map[string]any{"disabled": disabled},
+	})
+	return nil
+}
+
+func (s *adminService) ForceLogout(ctx context.Context, actorID, id int) error {
+	if err := s.repo.BumpTokenVersion(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("service: force-logout: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionForceLogout, ActorID: actorID, UserID: id,
+		TargetType: "user", TargetID: fmt.Sprint(id),
+	})
+	return nil
+}
+
+func (s *adminService) SetUserRole(ctx context.Context, actorID, id int, role string) error {
+	if !auth.IsKnownRole(role) {
+		return ErrInvalidRole
+	}
+	if actorID == id && role != auth.RoleAdmin {
+		return ErrCannotEditSelf
+	}
+
+	before, err := s.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetRole(ctx, id, role); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("service: set-role: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionRoleChanged, ActorID: actorID, UserID: id,
+		TargetType: "user", TargetID: fmt.Sprint(id),
+		Before: map[string]any{"role": before.Role}, After: map[string]any{"role": role},
+	})
+	return nil
+}
+
+// Назначить первого администратора по email из конфигурации
+func (s *adminService) BootstrapAdmin(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil
+	}
+	if err := s.repo.SetRoleByEmail(ctx, email, auth.RoleAdmin); err != nil {
+		return fmt.Errorf("service: bootstrap-admin: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"user-service/audit"
+	"user-service/events"
+	"user-service/models"
+	"user-service/repository"
+)
+
+// Пароль-заглушка для пользователей, пришедших через SSO: это не bcrypt-хэш,
+// поэтому вход по паролю для них невозможен, пока пароль не задан явно
+const externalAccountPassword = "!"
+
+// Вход через внешнего OIDC-провайдера.
+// Ищем привязку provider+subject; если её нет — привязываем к существующему
+// пользователю с тем же (подтверждённым провайдером) email или создаём нового.
+func (s *userService) LoginWithIdentity(ctx context.Context, provider, subject, email string, emailVerified bool) (models.User, error) {
+	u, err := s.repo.GetByIdentity(ctx, provider, subject)
+	if err == nil {
+		if u.Disabled() {
+			return models.User{}, ErrAccountDisabled
+		}
+		s.auditOIDCLogin(ctx, u.Id, provider)
+		return u, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, fmt.Errorf("service: get-by-identity: %w", err)
+	}
+
+	email = normalizeEmail(email)
+
+	// без подтверждённого email привязка позволила бы захватить чужой аккаунт
+	if email == "" || !emailVerified {
+		return models.User{}, ErrExternalEmailUnverified
+	}
+
+	u, err = s.repo.GetByEmail(ctx, email)
+	if err == nil {
+		if u.Disabled() {
+			return models.User{}, ErrAccountDisabled
+		}
+		if err := s.repo.LinkIdentity(ctx, u.Id, provider, subject, email); err != nil {
+			return models.User{}, fmt.Errorf("service: link-identity: %w", err)
+		}
+		s.audit.Record(ctx, audit.Event{
+			Action: audit.ActionIdentityLinked, ActorID: u.Id, UserID: u.Id,
+			TargetType: "identity", TargetID: provider,
+		})
+		s.auditOIDCLogin(ctx, u.Id, provider)
+		return u, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return models.User{}, fmt.Errorf("service: check-email: %w", err)
+	}
+
+	id, err := s.repo.CreateWithIdentity(ctx, email, externalAccountPassword, provider, subject)
+	if err != nil {
+		return models.User{}, fmt.Errorf("service: create-with-identity: %w", err)
+	}
+
+	if s.kafka != nil {
+		if err := events.PublishUserRegistered(ctx, s.kafka, id, email); err != nil {
+			fmt.Printf("failed to publish user_registered event: %v\n", err)
+		}
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionRegister, ActorID: id, UserID: id,
+		TargetType: "identity", TargetID: provider,
+		After: map[string]any{"id": id, "email": email},
+	})
+	s.auditOIDCLogin(ctx, id, provider)
+
+	return s.getUser(ctx, id)
+}
+
+// Успешная аутентификация у провайдера; при включённой 2FA
+// итоговый user.login запишется после второго шага
+func (s *userService) auditOIDCLogin(ctx context.Context, userID int, provider string) {
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionLoginOIDC, ActorID: userID, UserID: userID,
+		TargetType: "identity", TargetID: provider,
+	})
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"user-service/audit"
+	"user-service/auth"
+	"user-service/models"
+	"user-service/repository"
+)
+
+const (
+	defaultTokenTTLDays = 30
+	maxTokenTTLDays     = 365
+)
+
+var (
+	ErrTokenScopes   = errors.New("at least one valid scope is required")
+	ErrTokenTTL      = errors.New("expires_in_days must be between 1 and 365")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenInactive = errors.New("token is invalid, expired or revoked")
+)
+
+type TokenService interface {
+	CreateToken(ctx context.Context, userID int, name string, scopes []string, ttlDays int) (models.AccessToken, string, error)
+	ListTokens(ctx context.Context, userID int) ([]models.AccessToken, error)
+	RevokeToken(ctx context.Context, userID, id int) error
+	Introspect(ctx context.Context, token string) (models.AccessToken, error)
+}
+
+type tokenService struct {
+	repo  *repository.TokenRepository
+	audit *audit.Recorder
+}
+
+func NewTokenService(repo *repository.TokenRepository, auditor *audit.Recorder) TokenService {
+	return &tokenService{repo: repo, audit: auditor}
+}
+
+// Выпустить токен. Открытое значение возвращается только здесь, один раз.
+func (s *tokenService) CreateToken(ctx context.Context, userID int, name string, scopes []string, ttlDays int) (models.AccessToken, string, error) {
+	// имя проверяет CreateTokenRequest (теги validate)
+	name = strings.TrimSpace(name)
+
+	if ttlDays == 0 {
+		ttlDays = defaultTokenTTLDays
+	}
+	if ttlDays < 1 || ttlDays > maxTokenTTLDays {
+		return models.AccessToken{}, "", ErrTokenTTL
+	}
+
+	uniq := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, sc := range scopes {
+		if !auth.IsKnownScope(sc) {
+			return models.AccessToken{}, "", ErrTokenScopes
+		}
+		if !seen[sc] {
+			seen[sc] = true
+			uniq = append(uniq, sc)
+		}
+	}
+	if len(uniq) == 0 {
+		return models.AccessToken{}, "", ErrTokenScopes
+	}
+
+	plain, hash, err := auth.GeneratePAT()
+	if err != nil {
+		return models.AccessToken{}, "", fmt.Errorf("service: create-token: %w", err)
+	}
+
+	t, err := s.repo.Create(ctx, userID, name, hash, uniq, ttlDays)
+	if err != nil {
+		return models.AccessToken{}, "", fmt.Errorf("service: create-token: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionTokenCreated, ActorID: userID, UserID: userID,
+		TargetType: "token", TargetID: fmt.Sprint(t.ID),
+		After: map[string]any{"name": t.Name, "scopes": t.Scopes, "expires_at": t.ExpiresAt},
+	})
+	return t, plain, nil
+}
+
+func (s *tokenService) ListTokens(ctx context.Context, userID int) ([]models.AccessToken, error) {
+	tokens, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: list-tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (s *tokenService) RevokeToken(ctx context.Context, userID, id int) error {
+	if err := s.repo.Revoke(ctx, userID, id); err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			return ErrTokenNotFound
+		}
+		return fmt.Errorf("service: revoke-token: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionTokenRevoked, ActorID: userID, UserID: userID,
+		TargetType: "token", TargetID: fmt.Sprint(id),
+	})
+	return nil
+}
+
+// Проверка токена для других сервисов (note-service)
+func (s *tokenService) Introspect(ctx context.Context, token string) (models.AccessToken, error) {
+	if !strings.HasPrefix(token, auth.PATPrefix) {
+		return models.AccessToken{}, ErrTokenInactive
+	}
+
+	t, err := s.repo.UseActiveByHash(ctx, auth.HashPAT(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			return models.AccessToken{}, ErrTokenInactive
+		}
+		return models.AccessToken{}, fmt.Errorf("service: introspect-token: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"user-service/audit"
+	"user-service/auth"
+	"user-service/models"
+	"user-service/repository"
+)
+
+const recoveryCodesCount = 10
+
+// Попыток второго шага на один mfa_token; столько же ошибок подряд блокируют
+// вход по 2FA на mfaLockBase, каждая следующая серия — вдвое дольше, но не
+// дольше mfaLockMax
+const (
+	mfaMaxAttempts = 5
+	mfaLockBase    = time.Minute
+	mfaLockMax     = time.Hour
+)
+
+func (s *userService) getUser(ctx context.Context, userID int) (models.User, error) {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return models.User{}, ErrUserNotFound
+		}
+		return models.User{}, fmt.Errorf("service: get-user: %w", err)
+	}
+	return u, nil
+}
+
+// Начать подключение 2FA: выдать секрет и otpauth-ссылку для QR-кода
+func (s *userService) SetupTOTP(ctx context.Context, userID int) (string, string, error) {
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if u.TOTPEnabled {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("service: setup-totp: %w", err)
+	}
+
+	sealed, err := auth.SealTOTPSecret(secret, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("service: setup-totp: %w", err)
+	}
+
+	if err := s.repo.SetPendingTOTPSecret(ctx, userID, sealed); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// между чтением и записью 2FA успели включить
+			return "", "", ErrTOTPAlreadyEnabled
+		}
+		return "", "", fmt.Errorf("service: setup-totp: %w", err)
+	}
+
+	return secret, auth.TOTPURI(secret, u.Email), nil
+}
+
+// Подтвердить 2FA первым кодом из приложения и выдать коды восстановления.
+// Коды показываются один раз — в БД лежат только их хэши.
+func (s *userService) ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, ErrTOTPCodeRequired
+	}
+
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if u.TOTPSecret == "" {
+		return nil, ErrTOTPSetupRequired
+	}
+
+	secret, err := auth.OpenTOTPSecret(u.TOTPSecret, userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: confirm-totp: %w", err)
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, fmt.Errorf("service: confirm-totp: %w", err)
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(c))
+	}
+
+	if err := s.repo.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTOTPSetupRequired
+		}
+		return nil, fmt.Errorf("service: confirm-totp: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionTOTPEnabled, ActorID: userID, UserID: userID, TargetType: "user", TargetID: fmt.Sprint(userID)})
+
+	return codes, nil
+}
+
+// Второй шаг входа: код из приложения или одноразовый код восстановления.
+// Каждый mfa_token принимается один раз и не больше mfaMaxAttempts попыток,
+// после mfaMaxAttempts ошибок подряд второй шаг временно блокируется.
+func (s *userService) VerifySecondFactor(ctx context.Context, challenge auth.MFAChallenge, code, recoveryCode string) (models.User, error) {
+	code = strings.TrimSpace(code)
+	recoveryCode = strings.TrimSpace(recoveryCode)
+	if code == "" && recoveryCode == "" {
+		return models.User{}, ErrTOTPCodeRequired
+	}
+
+	userID := challenge.UserID
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return models.User{}, ErrInvalidTOTPCode
+		}
+		return models.User{}, err
+	}
+	if !u.TOTPEnabled {
+		return models.User{}, ErrTOTPNotEnabled
+	}
+	if u.Disabled() {
+		return models.User{}, ErrAccountDisabled
+	}
+	if u.MFALocked(time.Now()) {
+		return models.User{}, ErrMFALocked
+	}
+
+	fresh, err := s.repo.BeginMFAAttempt(ctx, userID, challenge.ID, challenge.ExpiresAt, mfaMaxAttempts)
+	if err != nil {
+		return models.User{}, fmt.Errorf("service: verify-second-factor: %w", err)
+	}
+	if !fresh {
+		return models.User{}, ErrMFATokenInvalid
+	}
+
+	method := "totp"
+	if code != "" {
+		secret, err := auth.OpenTOTPSecret(u.TOTPSecret, userID)
+		if err != nil {
+			return models.User{}, fmt.Errorf("service: verify-totp: %w", err)
+		}
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return models.User{}, s.secondFactorFailed(ctx, userID, method)
+		}
+		// один и тот же код нельзя предъявить повторно
+		fresh, err := s.repo.MarkTOTPStepUsed(ctx, userID, step)
+		if err != nil {
+			return models.User{}, fmt.Errorf("service: verify-totp: %w", err)
+		}
+		if !fresh {
+			return models.User{}, s.secondFactorFailed(ctx, userID, method)
+		}
+	} else {
+		method = "recovery_code"
+		used, err := s.repo.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			return models.User{}, fmt.Errorf("service: use-recovery-code: %w", err)
+		}
+		if !used {
+			return models.User{}, s.secondFactorFailed(ctx, userID, method)
+		}
+	}
+
+	if err := s.repo.CompleteMFA(ctx, userID, challenge.ID); err != nil {
+		return models.User{}, fmt.Errorf("service: verify-second-factor: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionLogin, ActorID: userID, UserID: userID, TargetType: method})
+	return u, nil
+}
+
+// secondFactorFailed считает ошибку второго шага и возвращает ответ клиенту:
+// после каждых mfaMaxAttempts ошибок подряд второй шаг блокируется
+func (s *userService) secondFactorFailed(ctx context.Context, userID int, method string) error {
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionLoginFailed, UserID: userID, TargetType: method})
+
+	n, err := s.repo.RecordMFAFailure(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("service: record-mfa-failure: %w", err)
+	}
+	if n%mfaMaxAttempts != 0 {
+		return ErrInvalidTOTPCode
+	}
+
+	// 1, 2, 4… минут; сдвиг ограничен, чтобы не переполнить Duration
+	lock := min(mfaLockBase<<min(n/mfaMaxAttempts-1, 10), mfaLockMax)
+	if err := s.repo.LockMFA(ctx, userID, time.Now().Add(lock)); err != nil {
+		return fmt.Errorf("service: lock-mfa: %w", err)
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action: audit.ActionTOTPLocked, UserID: userID, TargetType: "user", TargetID: fmt.Sprint(userID),
+		After: map[string]any{"failures": n, "locked_for": lock.String()},
+	})
+	return ErrMFALocked
+}
+
+// Выключить 2FA — только после повторного ввода пароля
+func (s *userService) DisableTOTP(ctx context.Context, userID int, password string) error {
+	u, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !u.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+
+	if err := s.repo.DisableTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("service: disable-totp: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionTOTPDisabled, ActorID: userID, UserID: userID, TargetType: "user", TargetID: fmt.Sprint(userID)})
+	return nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"user-service/audit"
+	"user-service/auth"
+	"user-service/repository"
+)
+
+var userRowColumns = []string{
+	"id", "email", "password", "created_at", "totp_secret", "totp_enabled", "totp_last_step",
+	"role", "disabled_at", "token_version", "mfa_failures", "mfa_locked_until",
+}
+
+func newTestService(t *testing.T) (*userService, sqlmock.Sqlmock) {
+	t.Helper()
+	t.Setenv("TOTP_ENCRYPTION_KEY", "test-key")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewUserService(repository.NewUserRepository(db), nil, audit.NewRecorder(nil)).(*userService)
+	return s, mock
+}
+
+func expectUser(mock sqlmock.Sqlmock, totpSecret string, enabled bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = $1")).WithArgs(1).WillReturnRows(
+		sqlmock.NewRows(userRowColumns).AddRow(1, "a@example.com", "hash", time.Now(), totpSecret, enabled, 0,
+			"user", nil, 0, 0, nil))
+}
+
+func expectMFAAttempt(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM mfa_attempts")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO mfa_attempts")).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func challenge(id string) auth.MFAChallenge {
+	return auth.MFAChallenge{UserID: 1, ID: id, ExpiresAt: time.Now().Add(time.Minute)}
+}
+
+// sealedSecret сверяет, что в БД уходит не открытый секрет
+type sealedSecret struct{ plain *string }
+
+func (m sealedSecret) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok {
+		return false
+	}
+	plain, err := auth.OpenTOTPSecret(stored, 1)
+	*m.plain = plain
+	return err == nil && stored != plain
+}
+
+func TestSetupTOTPStoresSealedSecret(t *testing.T) {
+	s, mock := newTestService(t)
+	var stored string
+
+	expectUser(mock, "", false)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET totp_secret = $1")).
+		WithArgs(sealedSecret{&stored}, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	secret, _, err := s.SetupTOTP(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != secret {
+		t.Fatalf("stored secret opens to %q, want %q", stored, secret)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoveryCodeIsOneTime(t *testing.T) {
+	s, mock := newTestService(t)
+	const code = "ABCDE-FGHJK"
+	useCode := regexp.QuoteMeta("UPDATE recovery_codes SET used_at = NOW()")
+
+	// первый вход: код погашен
+	expectUser(mock, "sealed", true)
+	expectMFAAttempt(mock)
+	mock.ExpectExec(useCode).WithArgs(1, auth.HashRecoveryCode(code)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE mfa_attempts SET used_at")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET mfa_failures = 0")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := s.VerifySecondFactor(context.Background(), challenge("jti-1"), "", code); err != nil {
+		t.Fatal(err)
+	}
+
+	// второй вход тем же кодом: неиспользованного кода с этим хэшем нет
+	expectUser(mock, "sealed", true)
+	expectMFAAttempt(mock)
+	mock.ExpectExec(useCode).WithArgs(1, auth.HashRecoveryCode(code)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET mfa_failures = mfa_failures + 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"mfa_failures"}).AddRow(1))
+
+	if _, err := s.VerifySecondFactor(context.Background(), challenge("jti-2"), "", code); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("second use: %v, want ErrInvalidTOTPCode", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,54 +9,74 @@ import (
  	"golang.org/x/crypto/bcrypt"
     "github.com/segmentio/kafka-go"
 
+    "user-service/audit"
+    "user-service/auth"
     "user-service/events"
 	"user-service/models"
 	"user-service/repository"
 )
 
 var (
-    ErrEmailRequired     = errors.New("email is required")
-    ErrEmailInvalid      = errors.New("email is invalid")
-    ErrPasswordRequired  = errors.New("password is required")
-    ErrPasswordTooShort  = errors.New("password is too short")
     ErrEmailAlreadyTaken = errors.New("email already registered")
 
     ErrInvalidCredentials = errors.New("invalid email or password")
+
+    ErrUserNotFound         = errors.New("user not found")
+    ErrTOTPAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+    ErrTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+    ErrTOTPSetupRequired    = errors.New("two-factor setup has not been started")
+    ErrTOTPCodeRequired     = errors.New("code is required")
+    ErrInvalidTOTPCode      = errors.New("invalid two-factor code")
+    ErrMFATokenInvalid      = errors.New("invalid or expired mfa token")
+    ErrMFALocked            = errors.New("too many invalid two-factor codes, try again later")
+    ErrInvalidPassword      = errors.New("invalid password")
+
+    ErrExternalEmailUnverified = errors.New("identity provider did not return a verified email")
+
+    ErrAccountDisabled = errors.New("account is disabled")
+    ErrSessionRevoked  = errors.New("session has been revoked")
 )
 
 
 type UserService interface {
     RegisterUser(ctx context.Context, email, password string) (models.User, error)
     LoginUser(ctx context.Context, email, password string) (models.User, error)
+
+    SetupTOTP(ctx context.Context, userID int) (secret, uri string, err error)
+    ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error)
+    VerifySecondFactor(ctx context.Context, challenge auth.MFAChallenge, code, recoveryCode string) (models.User, error)
+    DisableTOTP(ctx context.Context, userID int, password string) error
+
+    LoginWithIdentity(ctx context.Context, provider, subject, email string, emailVerified bool) (models.User, error)
+
+    ValidateSession(ctx context.Context, userID, tokenVersion int) (string, error)
+    ChangePassword(ctx context.Context, userID int, current, newPassword string) (models.User, error)
 }
 
 
 type userService struct {
 	repo *repository.UserRepository
     kafka *kafka.Writer
+    audit *audit.Recorder
 }
 
-func NewUserService(repo *repository.UserRepository, writer *kafka.Writer) UserService {
+func NewUserService(repo *repository.UserRepository, writer *kafka.Writer, auditor *audit.Recorder) UserService {
 	return &userService{
 		repo:  repo,
 		kafka: writer,
+		audit: auditor,
 	}
 }
 
+// Email храним и сравниваем в нижнем регистре: один адрес — один аккаунт,
+// как бы его ни написали в форме или у провайдера
+func normalizeEmail(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Формат email и длину пароля проверяет RegisterRequest (теги validate)
 func (s *userService) RegisterUser(ctx context.Context, email, password string) (models.User, error) {
-    email = strings.TrimSpace(email)
-    if email == "" {
-        return models.User{}, ErrEmailRequired
-    }
-    if !strings.Contains(email, "@") {
-        return models.User{}, ErrEmailInvalid
-    }
-    if len(password) == 0 {
-        return models.User{}, ErrPasswordRequired
-    }
-    if len(password) < 6 {
-        return models.User{}, ErrPasswordTooShort
-    }
+    email = normalizeEmail(email)
 
     // проверим, нет ли уже такого email
     _, err := s.repo.GetByEmail(ctx, email)
@@ -87,6 +107,15 @@ func (s *userService) RegisterUser(ctx context.Context, email, password string)
 	    }
     }
 
+    s.audit.Record(ctx, audit.Event{
+        Action:     audit.ActionRegister,
+        ActorID:    id,
+        UserID:     id,
+        TargetType: "user",
+        TargetID:   fmt.Sprint(id),
+        After:      map[string]any{"id": id, "email": email},
+    })
+
     return models.User{
         Id:       id,
         Email:    email,
@@ -95,7 +124,7 @@ func (s *userService) RegisterUser(ctx context.Context, email, password string)
 }
 
 func (s *userService) LoginUser(ctx context.Context, email, password string) (models.User, error) {
-    email = strings.TrimSpace(email)
+    email = normalizeEmail(email)
     if email == "" || password == "" {
         return models.User{}, ErrInvalidCredentials
     }
@@ -103,6 +132,7 @@ func (s *userService) LoginUser(ctx context.Context, email, password string) (mo
     u, err := s.repo.GetByEmail(ctx, email)
     if err != nil {
         if errors.Is(err, repository.ErrNotFound) {
+            s.audit.Record(ctx, audit.Event{Action: audit.ActionLoginFailed, TargetType: "password"})
             return models.User{}, ErrInvalidCredentials
         }
         return models.User{}, fmt.Errorf("service: login-get-by-email: %w", err)
@@ -110,9 +140,71 @@ func (s *userService) LoginUser(ctx context.Context, email, password string) (mo
 
     // сравниваем хэш и введённый пароль
     if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+        s.audit.Record(ctx, audit.Event{Action: audit.ActionLoginFailed, UserID: u.Id, TargetType: "password"})
         return models.User{}, ErrInvalidCredentials
     }
 
+    // о блокировке сообщаем только после проверки пароля
+    if u.Disabled() {
+        s.audit.Record(ctx, audit.Event{Action: audit.ActionLoginFailed, UserID: u.Id, TargetType: "disabled"})
+        return models.User{}, ErrAccountDisabled
+    }
+
+    // при включённой 2FA вход фиксируется после второго шага
+    if !u.TOTPEnabled {
+        s.audit.Record(ctx, audit.Event{Action: audit.ActionLogin, ActorID: u.Id, UserID: u.Id, TargetType: "password"})
+    }
+
     return u, nil
 }
 
+// Сменить пароль. Все выданные ранее JWT перестают действовать,
+// вызывающий получает пользователя с новой версией сессии.
+// Длину нового пароля проверяет ChangePasswordRequest.
+func (s *userService) ChangePassword(ctx context.Context, userID int, current, newPassword string) (models.User, error) {
+    u, err := s.getUser(ctx, userID)
+    if err != nil {
+        return models.User{}, err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(current)); err != nil {
+        return models.User{}, ErrInvalidPassword
+    }
+
+    hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+    if err != nil {
+        return models.User{}, fmt.Errorf("service: hash-password: %w", err)
+    }
+
+    if err := s.repo.UpdatePassword(ctx, userID, string(hash)); err != nil {
+        return models.User{}, fmt.Errorf("service: change-password: %w", err)
+    }
+
+    s.audit.Record(ctx, audit.Event{
+        Action:     audit.ActionPasswordChanged,
+        ActorID:    userID,
+        UserID:     userID,
+        TargetType: "user",
+        TargetID:   fmt.Sprint(userID),
+        Before:     u.Password,
+        After:      string(hash),
+    })
+
+    return s.getUser(ctx, userID)
+}
+
+// Проверить, что сессия (JWT) ещё действует: аккаунт не заблокирован и не было
+// принудительного выхода. Возвращает актуальную роль пользователя.
+func (s *userService) ValidateSession(ctx context.Context, userID, tokenVersion int) (string, error) {
+    u, err := s.getUser(ctx, userID)
+    if err != nil {
+        return "", err
+    }
+    if u.Disabled() {
+        return "", ErrAccountDisabled
+    }
+    if u.TokenVersion != tokenVersion {
+        return "", ErrSessionRevoked
+    }
+    return u.Role, nil
+}
+
@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+type limit struct {
+	env string
+	def int
+}
+
+// Лимиты длины в символах; переопределяются переменными окружения
+var limits = map[string]limit{
+	"email":        {env: "EMAIL_MAX_CHARS", def: 254},
+	"password.min": {env: "PASSWORD_MIN_CHARS", def: 6},
+	"token.name":   {env: "TOKEN_NAME_MAX_CHARS", def: 100},
+}
+
+var (
+	limitsOnce sync.Once
+	resolved   map[string]int
+)
+
+// Limit возвращает значение лимита по имени из тега. Неизвестное имя —
+// ошибка в теге, поэтому паника.
+func Limit(name string) int {
+	limitsOnce.Do(func() {
+		resolved = make(map[string]int, len(limits))
+		for k, l := range limits {
+			resolved[k] = l.def
+			if v := os.Getenv(l.env); v != "" {
+				if n, err := strconv.Atoi(v); err == nil && n > 0 {
+					resolved[k] = n
+				}
+			}
+		}
+	})
+	n, ok := resolved[name]
+	if !ok {
+		panic(fmt.Sprintf("validation: unknown limit %q", name))
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUserLimitsCountRunes(t *testing.T) {
+	type token struct {
+		Name     string `json:"name" validate:"notblank,maxrunes=token.name"`
+		Password string `json:"password" validate:"required,minrunes=password.min"`
+	}
+	// кириллица — два байта на символ: лимиты считают символы, а не байты
+	name := strings.Repeat("я", Limit("token.name"))
+	short := strings.Repeat("ж", Limit("password.min")-1)
+
+	if err := Struct(token{Name: name, Password: short + "ж"}); err != nil {
+		t.Fatalf("at the limits: %v", err)
+	}
+
+	err := Struct(token{Name: name + "я", Password: short})
+	var verr *Error
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("past the limits: %v", err)
+	}
+	if v := verr.Violations[0]; v.Code != "too_long" || v.Message != "name must be at most 100 characters" {
+		t.Errorf("name: %+v", v)
+	}
+	if v := verr.Violations[1]; v.Code != "too_short" || v.Message != "password must be at least 6 characters" {
+		t.Errorf("password: %+v", v)
+	}
+}
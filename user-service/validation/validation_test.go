@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsEmail(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"a@b", true},
+		{"alice@example.com", true},
+		{"a.b+tag@sub.example.com", true},
+		{"a@", false},
+		{"@b", false},
+		{"a", false},
+		{"", false},
+		{`"x" <a@b>`, false},
+		{"x <a@b>", false},
+		{"<a@b>", false},
+		{" a@b", false},
+		{"a@[127.0.0.1]", false},
+		{"a@b, c@d", false},
+	}
+	for _, c := range cases {
+		if got := IsEmail(c.in); got != c.ok {
+			t.Errorf("IsEmail(%q) = %v, want %v", c.in, got, c.ok)
+		}
+	}
+}
+
+func TestStructReportsAllViolations(t *testing.T) {
+	type dto struct {
+		Name   string `json:"name" validate:"notblank"`
+		Email  string `json:"email" validate:"required,email"`
+		Kind   string `json:"kind" validate:"oneof=a b"`
+		Secret string `json:"-" validate:"maxbytes=3"`
+		Count  int    `json:"count" validate:"min=1"`
+	}
+	err := Struct(dto{Name: "  ", Email: "x <a@b>", Kind: "c", Secret: "ёё", Count: 1})
+
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("Struct = %v, want *Error", err)
+	}
+	want := []Violation{
+		{Field: "name", Code: "required", Message: "name is required"},
+		{Field: "email", Code: "invalid", Message: "email is not a valid email address"},
+		{Field: "kind", Code: "invalid", Message: "kind must be one of: a, b"},
+		{Field: "Secret", Code: "too_long", Message: "Secret must be at most 3 bytes"},
+	}
+	if len(verr.Violations) != len(want) {
+		t.Fatalf("violations %+v, want %+v", verr.Violations, want)
+	}
+	for i, v := range verr.Violations {
+		if v != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, v, want[i])
+		}
+	}
+}
+
+func TestStructValid(t *testing.T) {
+	type dto struct {
+		Name  string `json:"name" validate:"notblank"`
+		Email string `json:"email" validate:"omitempty,email"`
+	}
+	if err := Struct(&dto{Name: "имя"}); err != nil {
+		t.Fatal(err)
+	}
+}